@@ -0,0 +1,333 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Kind is the type of an alert
+type Kind string
+
+const (
+	// OutOfRange is raised when an average leaves the configured range
+	OutOfRange Kind = "out_of_range"
+	// BackInRange is raised when the average returns into the range
+	BackInRange Kind = "back_in_range"
+)
+
+// Range is the temperature range an experiment is configured with, both
+// thresholds are inclusive
+type Range struct {
+	Lower float64
+	Upper float64
+}
+
+// Contains reports whether value lies within the range
+func (r Range) Contains(value float64) bool {
+	return value >= r.Lower && value <= r.Upper
+}
+
+// Policy debounces alerts. An excursion is only raised once it lasted both
+// MinSamples consecutive samples and MinDuration of measurement time, and it
+// only ends once the average is Hysteresis inside the threshold it crossed.
+// The zero Policy raises on every crossing.
+type Policy struct {
+	MinSamples  int
+	MinDuration time.Duration
+	Hysteresis  float64
+}
+
+// Validate checks the policy on its own, and against rng unless it is nil
+func (p Policy) Validate(rng *Range) error {
+	switch {
+	case p.MinSamples < 0:
+		return errors.New("min_samples must not be negative")
+	case p.MinDuration < 0:
+		return errors.New("min_duration must not be negative")
+	case p.Hysteresis < 0 || math.IsNaN(p.Hysteresis) || math.IsInf(p.Hysteresis, 0):
+		return errors.New("hysteresis must be a non-negative number")
+	case rng != nil && p.Hysteresis >= rng.Upper-rng.Lower && p.Hysteresis > 0:
+		return errors.New("hysteresis must be smaller than the width of the range")
+	}
+	return nil
+}
+
+// Sample is the average of one measurement group
+type Sample struct {
+	MeasurementID string
+	Timestamp     float64
+	Value         float64
+	// Running is false during stabilization, when no alerts are raised
+	Running bool
+}
+
+// Alert reports a sample that moved the experiment out of or back into its
+// range
+type Alert struct {
+	Kind   Kind
+	Sample Sample
+	Range  Range
+	// ExcursionStart is the timestamp of the first sample of the excursion
+	ExcursionStart float64
+}
+
+// side is where a sample lies relative to the range
+type side int
+
+const (
+	inside side = iota
+	below
+	above
+)
+
+// State is what the detector remembers of an experiment between samples
+type State struct {
+	evaluated bool
+	last      float64
+	// out is set while an excursion is raised, side is where it currently is
+	out  bool
+	side side
+	// pending counts the samples of an excursion that is not raised yet,
+	// since is the timestamp of its first sample
+	pending int
+	since   float64
+}
+
+// experiment holds the range and state of one experiment
+type experiment struct {
+	rng   Range
+	state State
+}
+
+// Detector raises alerts when the averages of a running experiment cross
+// its configured range. Samples are evaluated in two steps, so the caller
+// can deliver an alert before the state moves on: Evaluate returns the
+// alert and the next state, Commit stores it. Hold keeps other samples of
+// the experiment out in between.
+type Detector struct {
+	defaults Policy
+
+	mu          sync.Mutex
+	experiments map[string]*experiment
+	policies    map[string]Policy
+	holds       map[string]*hold
+}
+
+// hold serialises the samples of one experiment, it is dropped once no
+// sample waits for it
+type hold struct {
+	mu      sync.Mutex
+	waiting int
+}
+
+// NewDetector creates a detector without experiments, applying defaults to
+// experiments without a policy of their own
+func NewDetector(defaults Policy) *Detector {
+	return &Detector{
+		defaults:    defaults,
+		experiments: make(map[string]*experiment),
+		policies:    make(map[string]Policy),
+		holds:       make(map[string]*hold),
+	}
+}
+
+// Hold blocks until no other sample of the experiment is held, so its
+// Evaluate and Commit are not interleaved with another sample's: an alert
+// is never judged on a state that is about to change. The returned function
+// releases the experiment.
+func (d *Detector) Hold(id string) (release func()) {
+	d.mu.Lock()
+	h, ok := d.holds[id]
+	if !ok {
+		h = &hold{}
+		d.holds[id] = h
+	}
+	h.waiting++
+	d.mu.Unlock()
+
+	h.mu.Lock()
+	return func() {
+		h.mu.Unlock()
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if h.waiting--; h.waiting == 0 {
+			delete(d.holds, id)
+		}
+	}
+}
+
+// Configure sets the range of an experiment, keeping its state if it was
+// configured before. A policy override that was set before the range was
+// known and does not fit it is dropped, the experiment then uses the
+// default policy. The returned error reports a policy that does not fit,
+// a default hysteresis too wide for the range is limited to it.
+func (d *Detector) Configure(id string, rng Range) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if exp, ok := d.experiments[id]; ok {
+		exp.rng = rng
+	} else {
+		d.experiments[id] = &experiment{rng: rng}
+	}
+
+	if p, ok := d.policies[id]; ok {
+		if err := p.Validate(&rng); err != nil {
+			delete(d.policies, id)
+			return fmt.Errorf("dropped alert policy of experiment %s: %w", id, err)
+		}
+		return nil
+	}
+	if err := d.defaults.Validate(&rng); err != nil {
+		return fmt.Errorf("default alert policy does not fit experiment %s: %w", id, err)
+	}
+	return nil
+}
+
+// Known reports whether the experiment's range is known
+func (d *Detector) Known(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.experiments[id]
+	return ok
+}
+
+// Forget drops an experiment and its policy
+func (d *Detector) Forget(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.experiments, id)
+	delete(d.policies, id)
+}
+
+// SetPolicy overrides the default policy of an experiment. It may be set
+// before the experiment is configured. A pending excursion is judged by
+// the new policy from its next sample on.
+func (d *Detector) SetPolicy(id string, p Policy) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var rng *Range
+	if exp, ok := d.experiments[id]; ok {
+		rng = &exp.rng
+	}
+	if err := p.Validate(rng); err != nil {
+		return err
+	}
+	d.policies[id] = p
+	return nil
+}
+
+// ResetPolicy makes an experiment use the default policy again
+func (d *Detector) ResetPolicy(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.policies, id)
+}
+
+// Policy returns the policy of an experiment and whether it overrides the
+// default
+func (d *Detector) Policy(id string) (Policy, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if p, ok := d.policies[id]; ok {
+		return p, true
+	}
+	return d.defaults, false
+}
+
+// Evaluate returns the alert the sample raises, if any, and the state after
+// it. ok is false if the experiment is unknown or the sample is not newer
+// than the last one evaluated, such as a redelivered or corrected group; the
+// state must then not be committed.
+func (d *Detector) Evaluate(id string, s Sample) (alert *Alert, next State, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	exp, found := d.experiments[id]
+	if !found || (exp.state.evaluated && s.Timestamp <= exp.state.last) {
+		return nil, State{}, false
+	}
+
+	policy, ok := d.policies[id]
+	if !ok {
+		policy = d.defaults
+	}
+
+	next = exp.state
+	next.evaluated = true
+	next.last = s.Timestamp
+	if !s.Running {
+		return nil, next, true
+	}
+	return step(&next, exp.rng, policy, s), next, true
+}
+
+// step moves state on by one sample of a running experiment and returns the
+// alert it raises
+func step(state *State, rng Range, policy Policy, s Sample) *Alert {
+	current := inside
+	switch {
+	case s.Value < rng.Lower:
+		current = below
+	case s.Value > rng.Upper:
+		current = above
+	}
+
+	if state.out {
+		if !recovered(rng, policy, state.side, s.Value) {
+			if current != inside {
+				state.side = current
+			}
+			return nil
+		}
+		alert := &Alert{Kind: BackInRange, Sample: s, Range: rng, ExcursionStart: state.since}
+		*state = State{evaluated: true, last: state.last}
+		return alert
+	}
+
+	if current == inside {
+		// The excursion ended before it was raised
+		state.pending, state.since = 0, 0
+		return nil
+	}
+	if state.pending == 0 {
+		state.since = s.Timestamp
+	}
+	state.pending++
+	state.side = current
+
+	elapsed := time.Duration((s.Timestamp - state.since) * float64(time.Second))
+	if state.pending < policy.MinSamples || elapsed < policy.MinDuration {
+		return nil
+	}
+	state.out = true
+	state.pending = 0
+	return &Alert{Kind: OutOfRange, Sample: s, Range: rng, ExcursionStart: state.since}
+}
+
+// recovered reports whether value ends an excursion on the given side: it
+// must be inside the range by at least the hysteresis from the threshold
+// that was crossed
+func recovered(rng Range, policy Policy, side side, value float64) bool {
+	if !rng.Contains(value) {
+		return false
+	}
+	switch side {
+	case above:
+		return value <= math.Max(rng.Upper-policy.Hysteresis, rng.Lower)
+	case below:
+		return value >= math.Min(rng.Lower+policy.Hysteresis, rng.Upper)
+	default:
+		return true
+	}
+}
+
+// Commit stores the state returned by Evaluate
+func (d *Detector) Commit(id string, state State) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if exp, ok := d.experiments[id]; ok {
+		exp.state = state
+	}
+}
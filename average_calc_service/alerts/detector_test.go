@@ -0,0 +1,265 @@
+package alerts
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDetector(t *testing.T) {
+	d := NewDetector(Policy{})
+	d.Configure("exp", Range{Lower: 10, Upper: 20})
+
+	steps := []struct {
+		ts      float64
+		value   float64
+		running bool
+		want    Kind // empty for no alert
+	}{
+		{1, 5, false, ""}, // stabilization is not checked
+		{2, 15, true, ""}, // in range
+		{3, 20, true, ""}, // thresholds are inclusive
+		{4, 21, true, OutOfRange},
+		{5, 25, true, ""}, // still out
+		{6, 9, true, ""},  // out on the other side
+		{7, 10, true, BackInRange},
+		{8, 9.9, true, OutOfRange},
+	}
+	for _, step := range steps {
+		alert, next, ok := d.Evaluate("exp", Sample{Timestamp: step.ts, Value: step.value, Running: step.running})
+		if !ok {
+			t.Fatalf("t=%v: Evaluate() not ok", step.ts)
+		}
+		d.Commit("exp", next)
+
+		switch {
+		case step.want == "" && alert != nil:
+			t.Errorf("t=%v: unexpected %s alert", step.ts, alert.Kind)
+		case step.want != "" && (alert == nil || alert.Kind != step.want):
+			t.Errorf("t=%v: alert = %+v, want %s", step.ts, alert, step.want)
+		case alert != nil && (alert.Sample.Value != step.value || alert.Range != (Range{10, 20})):
+			t.Errorf("t=%v: alert = %+v", step.ts, alert)
+		}
+	}
+}
+
+func TestDetectorUncommittedStateRaisesAgain(t *testing.T) {
+	d := NewDetector(Policy{})
+	d.Configure("exp", Range{Lower: 10, Upper: 20})
+
+	// A failed delivery does not commit, the retried sample raises again
+	if alert, _, _ := d.Evaluate("exp", Sample{Timestamp: 1, Value: 30, Running: true}); alert == nil {
+		t.Fatal("Evaluate() raised no alert")
+	}
+	alert, next, _ := d.Evaluate("exp", Sample{Timestamp: 1, Value: 30, Running: true})
+	if alert == nil {
+		t.Fatal("retried Evaluate() raised no alert")
+	}
+	d.Commit("exp", next)
+
+	// Once committed, the redelivered or an older sample is skipped
+	if _, _, ok := d.Evaluate("exp", Sample{Timestamp: 1, Value: 15, Running: true}); ok {
+		t.Error("Evaluate() of a redelivered sample is ok")
+	}
+	if _, _, ok := d.Evaluate("unknown", Sample{Timestamp: 1, Value: 30, Running: true}); ok {
+		t.Error("Evaluate() of an unknown experiment is ok")
+	}
+}
+
+func TestDetectorHoldSerialisesSamples(t *testing.T) {
+	d := NewDetector(Policy{})
+	d.Configure("exp", Range{Lower: 10, Upper: 20})
+
+	// Every sample is out of range, only the first one evaluated may raise
+	// an alert, however the others interleave with its delivery
+	var raised atomic.Int64
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := d.Hold("exp")
+			defer release()
+			alert, next, ok := d.Evaluate("exp", Sample{Timestamp: float64(i + 1), Value: 30, Running: true})
+			if !ok {
+				return
+			}
+			if alert != nil {
+				raised.Add(1)
+				time.Sleep(time.Millisecond) // delivering the alert
+			}
+			d.Commit("exp", next)
+		}()
+	}
+	wg.Wait()
+
+	if got := raised.Load(); got != 1 {
+		t.Errorf("raised %d alerts, want 1", got)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.holds) != 0 {
+		t.Errorf("%d holds kept after release", len(d.holds))
+	}
+}
+
+func TestDetectorForget(t *testing.T) {
+	d := NewDetector(Policy{})
+	d.Configure("exp", Range{Lower: 10, Upper: 20})
+	d.Forget("exp")
+	if d.Known("exp") {
+		t.Error("Known() after Forget() = true")
+	}
+}
+
+// run feeds values one second apart to a running experiment in [10, 20]
+// and returns the alert kinds raised, "-" for none
+func run(t *testing.T, d *Detector, values ...float64) []string {
+	t.Helper()
+	var kinds []string
+	for i, value := range values {
+		alert, next, ok := d.Evaluate("exp", Sample{Timestamp: float64(i + 1), Value: value, Running: true})
+		if !ok {
+			t.Fatalf("sample %d: Evaluate() not ok", i)
+		}
+		d.Commit("exp", next)
+		if alert == nil {
+			kinds = append(kinds, "-")
+		} else {
+			kinds = append(kinds, string(alert.Kind))
+		}
+	}
+	return kinds
+}
+
+func TestPolicies(t *testing.T) {
+	const out, back = "out_of_range", "back_in_range"
+	tests := []struct {
+		name   string
+		policy Policy
+		values []float64
+		want   []string
+	}{
+		{
+			name:   "min samples ignores a single spike",
+			policy: Policy{MinSamples: 3},
+			values: []float64{15, 25, 15, 25, 25, 25, 25},
+			want:   []string{"-", "-", "-", "-", "-", out, "-"},
+		},
+		{
+			name:   "min samples counts both sides as one excursion",
+			policy: Policy{MinSamples: 2},
+			values: []float64{25, 5, 15},
+			want:   []string{"-", out, back},
+		},
+		{
+			name:   "min duration in measurement time",
+			policy: Policy{MinDuration: 2 * time.Second},
+			values: []float64{25, 25, 15, 25, 25, 25},
+			want:   []string{"-", "-", "-", "-", "-", out},
+		},
+		{
+			name:   "min samples and min duration both apply",
+			policy: Policy{MinSamples: 2, MinDuration: 2 * time.Second},
+			values: []float64{25, 25, 25},
+			want:   []string{"-", "-", out},
+		},
+		{
+			name:   "hysteresis above the range",
+			policy: Policy{Hysteresis: 1},
+			values: []float64{25, 19.5, 20.5, 19, 20.5},
+			want:   []string{out, "-", "-", back, out},
+		},
+		{
+			name:   "hysteresis below the range",
+			policy: Policy{Hysteresis: 1},
+			values: []float64{5, 10.5, 11, 10},
+			want:   []string{out, "-", back, "-"},
+		},
+		{
+			name:   "hysteresis follows the side the excursion moved to",
+			policy: Policy{Hysteresis: 1},
+			values: []float64{25, 5, 10.5, 11},
+			want:   []string{out, "-", "-", back},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(tt.policy)
+			d.Configure("exp", Range{Lower: 10, Upper: 20})
+			got := run(t, d, tt.values...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("alerts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcursionStart(t *testing.T) {
+	d := NewDetector(Policy{MinSamples: 2})
+	d.Configure("exp", Range{Lower: 10, Upper: 20})
+	var alerts []*Alert
+	for i, value := range []float64{15, 25, 25, 15} {
+		alert, next, _ := d.Evaluate("exp", Sample{Timestamp: float64(i + 1), Value: value, Running: true})
+		d.Commit("exp", next)
+		if alert != nil {
+			alerts = append(alerts, alert)
+		}
+	}
+	if len(alerts) != 2 || alerts[0].ExcursionStart != 2 || alerts[1].ExcursionStart != 2 {
+		t.Errorf("alerts = %+v, want both starting at 2", alerts)
+	}
+}
+
+func TestPolicyOverride(t *testing.T) {
+	d := NewDetector(Policy{MinSamples: 3})
+	// Overrides may be set before the experiment is configured
+	if err := d.SetPolicy("exp", Policy{}); err != nil {
+		t.Fatalf("SetPolicy() error = %v", err)
+	}
+	d.Configure("exp", Range{Lower: 10, Upper: 20})
+	if got := run(t, d, 25); got[0] != "out_of_range" {
+		t.Errorf("with override alerts = %v", got)
+	}
+	if p, overridden := d.Policy("exp"); !overridden || p != (Policy{}) {
+		t.Errorf("Policy() = %+v, %v", p, overridden)
+	}
+
+	d.ResetPolicy("exp")
+	if p, overridden := d.Policy("exp"); overridden || p.MinSamples != 3 {
+		t.Errorf("Policy() after reset = %+v, %v", p, overridden)
+	}
+
+	for _, p := range []Policy{{MinSamples: -1}, {MinDuration: -time.Second}, {Hysteresis: -1}, {Hysteresis: 10}} {
+		if err := d.SetPolicy("exp", p); err == nil {
+			t.Errorf("SetPolicy(%+v) accepted an invalid policy", p)
+		}
+	}
+}
+
+func TestConfigureDropsPolicyWiderThanRange(t *testing.T) {
+	d := NewDetector(Policy{MinSamples: 1})
+	// Without a range the hysteresis cannot be checked yet
+	if err := d.SetPolicy("exp", Policy{Hysteresis: 10}); err != nil {
+		t.Fatalf("SetPolicy() error = %v", err)
+	}
+	if err := d.Configure("exp", Range{Lower: 10, Upper: 20}); err == nil {
+		t.Error("Configure() accepted a hysteresis as wide as the range")
+	}
+	if p, overridden := d.Policy("exp"); overridden || p.MinSamples != 1 {
+		t.Errorf("Policy() = %+v, %v, want the default", p, overridden)
+	}
+
+	if err := d.SetPolicy("other", Policy{Hysteresis: 1}); err != nil {
+		t.Fatalf("SetPolicy() error = %v", err)
+	}
+	if err := d.Configure("other", Range{Lower: 10, Upper: 20}); err != nil {
+		t.Errorf("Configure() error = %v", err)
+	}
+	if _, overridden := d.Policy("other"); !overridden {
+		t.Error("Configure() dropped a policy that fits the range")
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerConfig holds HTTP server configuration
+type ServerConfig struct {
+	Port string
+	// NotificationServiceURL is where averages and alerts are sent, empty to
+	// only log them
+	NotificationServiceURL string
+	// PostgresServiceURL is where the ranges of experiments that were not
+	// configured through this service are looked up, empty to disable
+	PostgresServiceURL string
+}
+
+// GetServerConfig returns server configuration from environment variables
+func GetServerConfig() *ServerConfig {
+	return &ServerConfig{
+		Port:                   getEnv("HTTP_PORT", "8081"),
+		NotificationServiceURL: getEnv("NOTIFICATION_SERVICE_URL", ""),
+		PostgresServiceURL:     getEnv("POSTGRES_SERVICE_URL", ""),
+	}
+}
+
+// StatisticsConfig holds the windows of the rolling statistics
+type StatisticsConfig struct {
+	TumblingWindow time.Duration
+	SlidingWindow  time.Duration
+	// Percentiles are reported next to the median, each in [0, 100]
+	Percentiles []float64
+	// Retention is how long an experiment without new groups is kept
+	Retention time.Duration
+}
+
+// GetStatisticsConfig returns statistics configuration from environment
+// variables
+func GetStatisticsConfig() (*StatisticsConfig, error) {
+	cfg := &StatisticsConfig{}
+	var err error
+	if cfg.TumblingWindow, err = getEnvDuration("STATS_TUMBLING_WINDOW", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.SlidingWindow, err = getEnvDuration("STATS_SLIDING_WINDOW", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.Retention, err = getEnvDuration("STATS_RETENTION", time.Hour); err != nil {
+		return nil, err
+	}
+	for _, item := range strings.Split(getEnv("STATS_PERCENTILES", "90,95,99"), ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(item, 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("STATS_PERCENTILES: invalid percentile %q", item)
+		}
+		cfg.Percentiles = append(cfg.Percentiles, p)
+	}
+	sort.Float64s(cfg.Percentiles)
+	return cfg, nil
+}
+
+// AlertConfig holds the default alert policy, see alerts.Policy
+type AlertConfig struct {
+	MinSamples  int
+	MinDuration time.Duration
+	Hysteresis  float64
+}
+
+// GetAlertConfig returns the default alert policy from environment variables
+func GetAlertConfig() (*AlertConfig, error) {
+	cfg := &AlertConfig{}
+	minSamples, err := strconv.Atoi(getEnv("ALERT_MIN_SAMPLES", "1"))
+	if err != nil || minSamples < 0 {
+		return nil, fmt.Errorf("ALERT_MIN_SAMPLES: invalid count %q", os.Getenv("ALERT_MIN_SAMPLES"))
+	}
+	cfg.MinSamples = minSamples
+	if value := os.Getenv("ALERT_MIN_DURATION"); value != "" {
+		if cfg.MinDuration, err = time.ParseDuration(value); err != nil || cfg.MinDuration < 0 {
+			return nil, fmt.Errorf("ALERT_MIN_DURATION: invalid duration %q", value)
+		}
+	}
+	if cfg.Hysteresis, err = strconv.ParseFloat(getEnv("ALERT_HYSTERESIS", "0"), 64); err != nil || cfg.Hysteresis < 0 {
+		return nil, fmt.Errorf("ALERT_HYSTERESIS: invalid temperature %q", os.Getenv("ALERT_HYSTERESIS"))
+	}
+	return cfg, nil
+}
+
+// getEnvDuration returns a positive duration from the environment or the
+// default value
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s: invalid duration %q", key, value)
+	}
+	return d, nil
+}
+
+// getEnv returns environment variable or default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
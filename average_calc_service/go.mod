@@ -1,4 +1,3 @@
-module notification_service
+module average_calc_service
 
 go 1.22
-
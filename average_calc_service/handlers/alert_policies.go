@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"average_calc_service/models"
+	"average_calc_service/services"
+)
+
+// maxPolicySize bounds the body of a single alert policy request
+const maxPolicySize = 1 << 12
+
+// AlertPolicyHandler exposes the per-experiment alert policies over HTTP
+type AlertPolicyHandler struct {
+	ranges *services.RangeService
+}
+
+// NewAlertPolicyHandler creates a new alert policy handler
+func NewAlertPolicyHandler(ranges *services.RangeService) *AlertPolicyHandler {
+	return &AlertPolicyHandler{
+		ranges: ranges,
+	}
+}
+
+// Register adds the alert policy routes to mux
+func (h *AlertPolicyHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /experiments/{id}/alert-policy", h.getPolicy)
+	mux.HandleFunc("PUT /experiments/{id}/alert-policy", h.setPolicy)
+	mux.HandleFunc("DELETE /experiments/{id}/alert-policy", h.resetPolicy)
+}
+
+// getPolicy handles GET /experiments/{id}/alert-policy
+func (h *AlertPolicyHandler) getPolicy(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.ranges.Policy(r.PathValue("id")))
+}
+
+// setPolicy handles PUT /experiments/{id}/alert-policy with an AlertPolicy
+// as JSON body
+func (h *AlertPolicyHandler) setPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.AlertPolicy
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPolicySize)).Decode(&policy); err != nil {
+		http.Error(w, "invalid alert policy: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := h.ranges.SetPolicy(id, policy); err != nil {
+		if errors.Is(err, services.ErrInvalidPolicy) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "failed to set alert policy", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.ranges.Policy(id))
+}
+
+// resetPolicy handles DELETE /experiments/{id}/alert-policy
+func (h *AlertPolicyHandler) resetPolicy(w http.ResponseWriter, r *http.Request) {
+	h.ranges.ResetPolicy(r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"average_calc_service/models"
+	"average_calc_service/services"
+)
+
+// maxEventSize bounds the body of a single event request
+const maxEventSize = 1 << 16
+
+// EventHandler receives the lifecycle events the range checks depend on
+type EventHandler struct {
+	ranges *services.RangeService
+}
+
+// NewEventHandler creates a new event handler
+func NewEventHandler(ranges *services.RangeService) *EventHandler {
+	return &EventHandler{
+		ranges: ranges,
+	}
+}
+
+// Register adds the event routes to mux
+func (h *EventHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /events/experiment_configured", h.experimentConfigured)
+	mux.HandleFunc("POST /events/experiment_terminated", h.experimentTerminated)
+}
+
+// experimentConfigured handles POST /events/experiment_configured
+func (h *EventHandler) experimentConfigured(w http.ResponseWriter, r *http.Request) {
+	var event models.ExperimentConfigured
+	if !decodeEvent(w, r, &event) {
+		return
+	}
+	writeEventResult(w, h.ranges.Configure(event))
+}
+
+// experimentTerminated handles POST /events/experiment_terminated
+func (h *EventHandler) experimentTerminated(w http.ResponseWriter, r *http.Request) {
+	var event models.ExperimentTerminated
+	if !decodeEvent(w, r, &event) {
+		return
+	}
+	writeEventResult(w, h.ranges.Terminate(event))
+}
+
+func decodeEvent(w http.ResponseWriter, r *http.Request, event interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventSize)).Decode(event); err != nil {
+		http.Error(w, "invalid event: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeEventResult(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrInvalidEvent) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"average_calc_service/models"
+	"average_calc_service/services"
+)
+
+// maxGroupSize bounds the body of a single measurement group request
+const maxGroupSize = 1 << 20
+
+// MeasurementHandler receives measurement groups from the consumer
+type MeasurementHandler struct {
+	calculator *services.AverageCalculator
+	statistics *services.StatisticsService
+	ranges     *services.RangeService
+	notifier   *services.Notifier
+}
+
+// NewMeasurementHandler creates a new measurement handler
+func NewMeasurementHandler(calculator *services.AverageCalculator, statistics *services.StatisticsService, ranges *services.RangeService, notifier *services.Notifier) *MeasurementHandler {
+	return &MeasurementHandler{
+		calculator: calculator,
+		statistics: statistics,
+		ranges:     ranges,
+		notifier:   notifier,
+	}
+}
+
+// Register adds the measurement routes to mux
+func (h *MeasurementHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /measurements", h.receiveGroup)
+}
+
+// receiveGroup handles POST /measurements with a MeasurementGroup as JSON
+// body. The group is only accepted once its average and the alert it raised
+// reached notification_service, otherwise the consumer retries it.
+func (h *MeasurementHandler) receiveGroup(w http.ResponseWriter, r *http.Request) {
+	var group models.MeasurementGroup
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGroupSize)).Decode(&group); err != nil {
+		http.Error(w, "invalid measurement group: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	avg, err := h.calculator.Calculate(group)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidGroup) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error calculating average: %v", err)
+		http.Error(w, "failed to calculate average", http.StatusInternalServerError)
+		return
+	}
+
+	// Redelivered groups are ignored by the statistics
+	h.statistics.Record(group)
+
+	topic := r.Header.Get(services.TopicHeader)
+	if err := h.notifier.SendAverage(r.Context(), avg, topic); err != nil {
+		log.Printf("Error sending average of experiment %s: %v", avg.ExperimentID, err)
+		http.Error(w, "failed to send average", http.StatusBadGateway)
+		return
+	}
+
+	// The experiment's range state only moves on once the alert was sent,
+	// so a retried group raises it again
+	alert, done := h.ranges.Check(r.Context(), avg)
+	if alert != nil {
+		if err := h.notifier.SendAlert(r.Context(), *alert, topic); err != nil {
+			done(false)
+			log.Printf("Error sending %s alert of experiment %s: %v", alert.Type, avg.ExperimentID, err)
+			http.Error(w, "failed to send alert", http.StatusBadGateway)
+			return
+		}
+	}
+	done(true)
+
+	w.WriteHeader(http.StatusAccepted)
+}
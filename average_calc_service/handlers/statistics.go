@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"average_calc_service/services"
+)
+
+// StatisticsHandler exposes the rolling statistics over HTTP
+type StatisticsHandler struct {
+	statistics *services.StatisticsService
+}
+
+// NewStatisticsHandler creates a new statistics handler
+func NewStatisticsHandler(statistics *services.StatisticsService) *StatisticsHandler {
+	return &StatisticsHandler{
+		statistics: statistics,
+	}
+}
+
+// Register adds the statistics routes to mux
+func (h *StatisticsHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /experiments/{id}/stats", h.getExperiment)
+	mux.HandleFunc("GET /experiments/{id}/sensors/{sensor}/stats", h.getSensor)
+}
+
+// getExperiment handles GET /experiments/{id}/stats
+func (h *StatisticsHandler) getExperiment(w http.ResponseWriter, r *http.Request) {
+	result, ok := h.statistics.Experiment(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "experiment not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// getSensor handles GET /experiments/{id}/sensors/{sensor}/stats
+func (h *StatisticsHandler) getSensor(w http.ResponseWriter, r *http.Request) {
+	result, ok := h.statistics.Sensor(r.PathValue("id"), r.PathValue("sensor"))
+	if !ok {
+		http.Error(w, "sensor not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package models
+
+// MeasurementGroup mirrors the grouped payload produced by the consumer
+type MeasurementGroup struct {
+	ExperimentID     string    `json:"experiment_id"`
+	MeasurementID    string    `json:"measurement_id"`
+	Timestamp        float64   `json:"timestamp"`
+	Started          bool      `json:"started"`
+	MeasurementCount int       `json:"measurement_count"`
+	Measurements     []float64 `json:"measurements"`
+	Sensors          []string  `json:"sensors,omitempty"` // sensor of each measurement
+	Partial          bool      `json:"partial"`
+	TamperedCount    int       `json:"tampered_count"`
+	Revision         int       `json:"revision"`
+}
+
+// AverageMeasurement is the average of a measurement group as sent to
+// notification_service with POST /averages
+type AverageMeasurement struct {
+	ExperimentID     string  `json:"experiment_id"`
+	MeasurementID    string  `json:"measurement_id"`
+	Timestamp        float64 `json:"timestamp"`
+	Started          bool    `json:"started"`
+	AvgMeasurement   float64 `json:"avg_measurement"`
+	MeasurementCount int     `json:"measurement_count"`
+	Partial          bool    `json:"partial"`
+	TamperedCount    int     `json:"tampered_count"`
+	Revision         int     `json:"revision"`
+}
+
+// ExperimentConfigured mirrors the experiment_configured event forwarded by
+// the consumer
+type ExperimentConfigured struct {
+	Experiment       string           `json:"experiment"`
+	Researcher       string           `json:"researcher"`
+	Sensors          []string         `json:"sensors"`
+	TemperatureRange TemperatureRange `json:"temperature_range"`
+}
+
+// TemperatureRange is the range the experiment's temperature must stay in
+type TemperatureRange struct {
+	UpperThreshold float64 `json:"upper_threshold"`
+	LowerThreshold float64 `json:"lower_threshold"`
+}
+
+// ExperimentTerminated mirrors the experiment_terminated event forwarded by
+// the consumer
+type ExperimentTerminated struct {
+	Experiment string  `json:"experiment"`
+	Timestamp  float64 `json:"timestamp"`
+}
+
+// ExperimentRecord is the part of an experiment stored by postgres_service
+// that is needed to monitor its range
+type ExperimentRecord struct {
+	ID             string  `json:"id"`
+	LowerThreshold float64 `json:"lower_threshold"`
+	UpperThreshold float64 `json:"upper_threshold"`
+	Status         string  `json:"status"`
+}
+
+// Alert reports an average that left or returned into the experiment's
+// temperature range, as sent to notification_service with POST /alerts
+type Alert struct {
+	ExperimentID   string  `json:"experiment_id"`
+	MeasurementID  string  `json:"measurement_id"`
+	Timestamp      float64 `json:"timestamp"`
+	Type           string  `json:"type"` // out_of_range or back_in_range
+	AvgMeasurement float64 `json:"avg_measurement"`
+	LowerThreshold float64 `json:"lower_threshold"`
+	UpperThreshold float64 `json:"upper_threshold"`
+	// ExcursionStart is the timestamp of the first average outside the range
+	ExcursionStart float64 `json:"excursion_start"`
+}
+
+// AlertPolicy debounces the alerts of an experiment
+type AlertPolicy struct {
+	MinSamples  int     `json:"min_samples"`
+	MinDuration string  `json:"min_duration"` // Go duration, e.g. "30s"
+	Hysteresis  float64 `json:"hysteresis"`
+	// Override is set in responses when the policy is the experiment's own
+	Override bool `json:"override"`
+}
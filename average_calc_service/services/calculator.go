@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"average_calc_service/models"
+)
+
+// ErrInvalidGroup marks a measurement group that cannot be averaged
+var ErrInvalidGroup = errors.New("invalid measurement group")
+
+// AverageCalculator turns measurement groups into averages
+type AverageCalculator struct{}
+
+// NewAverageCalculator creates a new average calculator
+func NewAverageCalculator() *AverageCalculator {
+	return &AverageCalculator{}
+}
+
+// Calculate validates group and averages its measurements
+func (c *AverageCalculator) Calculate(group models.MeasurementGroup) (models.AverageMeasurement, error) {
+	if err := validateGroup(group); err != nil {
+		return models.AverageMeasurement{}, fmt.Errorf("%w: %v", ErrInvalidGroup, err)
+	}
+
+	return models.AverageMeasurement{
+		ExperimentID:     group.ExperimentID,
+		MeasurementID:    group.MeasurementID,
+		Timestamp:        group.Timestamp,
+		Started:          group.Started,
+		AvgMeasurement:   Mean(group.Measurements),
+		MeasurementCount: len(group.Measurements),
+		Partial:          group.Partial,
+		TamperedCount:    group.TamperedCount,
+		Revision:         group.Revision,
+	}, nil
+}
+
+// validateGroup checks the fields the average depends on
+func validateGroup(group models.MeasurementGroup) error {
+	switch {
+	case group.ExperimentID == "":
+		return errors.New("experiment_id is required")
+	case len(group.Measurements) == 0:
+		return errors.New("measurements must not be empty")
+	case group.MeasurementCount != len(group.Measurements):
+		return fmt.Errorf("measurement_count is %d but %d measurements were sent", group.MeasurementCount, len(group.Measurements))
+	case len(group.Sensors) > 0 && len(group.Sensors) != len(group.Measurements):
+		return fmt.Errorf("%d sensors were sent for %d measurements", len(group.Sensors), len(group.Measurements))
+	case group.Timestamp <= 0 || math.IsInf(group.Timestamp, 0) || math.IsNaN(group.Timestamp):
+		return errors.New("timestamp must be a positive number")
+	case group.TamperedCount < 0 || group.TamperedCount > len(group.Measurements):
+		return errors.New("tampered_count is out of range")
+	case group.Revision < 0:
+		return errors.New("revision must not be negative")
+	}
+	for i, value := range group.Measurements {
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return fmt.Errorf("measurement %d is not a finite number", i)
+		}
+	}
+	for i, sensor := range group.Sensors {
+		if sensor == "" {
+			return fmt.Errorf("sensor %d is empty", i)
+		}
+	}
+	return nil
+}
+
+// Mean returns the arithmetic mean of values, 0 for none. It is updated
+// incrementally, so it neither overflows on large values nor loses the
+// small ones next to them as a plain sum would.
+func Mean(values []float64) float64 {
+	var mean float64
+	for i, value := range values {
+		mean += (value - mean) / float64(i+1)
+	}
+	return mean
+}
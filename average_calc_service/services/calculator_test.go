@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"average_calc_service/models"
+)
+
+func TestMean(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{"empty", nil, 0},
+		{"single", []float64{21.5}, 21.5},
+		{"several", []float64{20, 21, 22, 23}, 21.5},
+		{"negative", []float64{-3, -1, 1}, -1},
+		{"large values", []float64{math.MaxFloat64, math.MaxFloat64}, math.MaxFloat64},
+		{"small next to large", []float64{1e16, 1, 1, -1e16}, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Mean(tt.values)
+			if math.Abs(got-tt.want) > 1e-9*math.Max(1, math.Abs(tt.want)) {
+				t.Errorf("Mean(%v) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func validGroup() models.MeasurementGroup {
+	return models.MeasurementGroup{
+		ExperimentID:     "5a8c2b3e-6c1f-4b1e-9b63-8f1d2e7a4c10",
+		MeasurementID:    "1f0e3dad-9990-4c6b-a4b0-6b6a3b4f2d11",
+		Timestamp:        1758273449.5,
+		Started:          true,
+		MeasurementCount: 3,
+		Measurements:     []float64{10.5, 11, 12.5},
+		TamperedCount:    1,
+		Revision:         2,
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	group := validGroup()
+	group.Partial = true
+
+	got, err := NewAverageCalculator().Calculate(group)
+	if err != nil {
+		t.Fatalf("Calculate() error = %v", err)
+	}
+	want := models.AverageMeasurement{
+		ExperimentID:     group.ExperimentID,
+		MeasurementID:    group.MeasurementID,
+		Timestamp:        group.Timestamp,
+		Started:          true,
+		AvgMeasurement:   34.0 / 3,
+		MeasurementCount: 3,
+		Partial:          true,
+		TamperedCount:    1,
+		Revision:         2,
+	}
+	if math.Abs(got.AvgMeasurement-want.AvgMeasurement) > 1e-12 {
+		t.Errorf("AvgMeasurement = %v, want %v", got.AvgMeasurement, want.AvgMeasurement)
+	}
+	got.AvgMeasurement = want.AvgMeasurement
+	if got != want {
+		t.Errorf("Calculate() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCalculateRejectsInvalidGroups(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(g *models.MeasurementGroup)
+	}{
+		{"missing experiment", func(g *models.MeasurementGroup) { g.ExperimentID = "" }},
+		{"no measurements", func(g *models.MeasurementGroup) { g.Measurements, g.MeasurementCount = nil, 0 }},
+		{"count mismatch", func(g *models.MeasurementGroup) { g.MeasurementCount = 4 }},
+		{"zero timestamp", func(g *models.MeasurementGroup) { g.Timestamp = 0 }},
+		{"infinite timestamp", func(g *models.MeasurementGroup) { g.Timestamp = math.Inf(1) }},
+		{"NaN measurement", func(g *models.MeasurementGroup) { g.Measurements[1] = math.NaN() }},
+		{"infinite measurement", func(g *models.MeasurementGroup) { g.Measurements[0] = math.Inf(-1) }},
+		{"too many tampered", func(g *models.MeasurementGroup) { g.TamperedCount = 4 }},
+		{"negative revision", func(g *models.MeasurementGroup) { g.Revision = -1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := validGroup()
+			tt.modify(&group)
+			if _, err := NewAverageCalculator().Calculate(group); !errors.Is(err, ErrInvalidGroup) {
+				t.Errorf("Calculate() error = %v, want ErrInvalidGroup", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"average_calc_service/models"
+)
+
+// TopicHeader carries the Kafka topic the measurements were read from
+const TopicHeader = "X-Source-Topic"
+
+// sentAverages is how many averages are remembered, so a group the consumer
+// retries because its alert failed does not send its average again
+const sentAverages = 10000
+
+// averageKey identifies one revision of a measurement's average
+type averageKey struct {
+	experiment    string
+	measurementID string
+	revision      int
+}
+
+// Notifier sends averages and alerts to notification_service
+type Notifier struct {
+	baseURL string
+	http    *http.Client
+
+	mu sync.Mutex
+	// sent holds the most recently sent averages, order the same keys
+	// oldest first
+	sent  map[averageKey]bool
+	order []averageKey
+}
+
+// NewNotifier creates a notifier for the service reachable at baseURL. With
+// an empty baseURL averages and alerts are only logged.
+func NewNotifier(baseURL string) *Notifier {
+	return &Notifier{
+		baseURL: baseURL,
+		http:    &http.Client{Timeout: 10 * time.Second},
+		sent:    make(map[averageKey]bool),
+	}
+}
+
+// SendAverage posts avg to notification_service, unless the same revision
+// of its measurement was sent recently. Failures are returned so the caller
+// can have the group redelivered.
+func (n *Notifier) SendAverage(ctx context.Context, avg models.AverageMeasurement, topic string) error {
+	key := averageKey{experiment: avg.ExperimentID, measurementID: avg.MeasurementID, revision: avg.Revision}
+	if avg.MeasurementID != "" && n.wasSent(key) {
+		return nil
+	}
+
+	if n.baseURL == "" {
+		log.Printf("Average of experiment %s at %f: %f (%d measurements, revision %d)",
+			avg.ExperimentID, avg.Timestamp, avg.AvgMeasurement, avg.MeasurementCount, avg.Revision)
+	} else if err := n.post(ctx, "/averages", avg, topic); err != nil {
+		return err
+	}
+	if avg.MeasurementID != "" {
+		n.markSent(key)
+	}
+	return nil
+}
+
+func (n *Notifier) wasSent(key averageKey) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.sent[key]
+}
+
+// markSent remembers key, forgetting the oldest key beyond sentAverages
+func (n *Notifier) markSent(key averageKey) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.sent[key] {
+		return
+	}
+	n.sent[key] = true
+	n.order = append(n.order, key)
+	if len(n.order) > sentAverages {
+		delete(n.sent, n.order[0])
+		n.order = n.order[1:]
+	}
+}
+
+// SendAlert posts alert to notification_service
+func (n *Notifier) SendAlert(ctx context.Context, alert models.Alert, topic string) error {
+	if n.baseURL == "" {
+		log.Printf("Alert %s for experiment %s at %f: average %f, range [%f, %f]",
+			alert.Type, alert.ExperimentID, alert.Timestamp, alert.AvgMeasurement, alert.LowerThreshold, alert.UpperThreshold)
+		return nil
+	}
+	return n.post(ctx, "/alerts", alert, topic)
+}
+
+func (n *Notifier) post(ctx context.Context, path string, payload interface{}, topic string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if topic != "" {
+		req.Header.Set(TopicHeader, topic)
+	}
+
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach notification_service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("notification_service responded %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
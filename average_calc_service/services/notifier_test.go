@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"average_calc_service/models"
+)
+
+func TestNotifierSendsAverageOnce(t *testing.T) {
+	posts := 0
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	n := NewNotifier(server.URL)
+	ctx := context.Background()
+	avg := models.AverageMeasurement{ExperimentID: "exp", MeasurementID: "m1", Timestamp: 1, AvgMeasurement: 20}
+
+	steps := []struct {
+		name      string
+		avg       models.AverageMeasurement
+		wantPosts int
+	}{
+		// notification_service is down, the average is not remembered
+		{"failed", avg, 1},
+		{"retried", avg, 2},
+		// The group is retried because its alert failed
+		{"sent before", avg, 2},
+		{"corrected", models.AverageMeasurement{ExperimentID: "exp", MeasurementID: "m1", Timestamp: 1, Revision: 1}, 3},
+		{"next measurement", models.AverageMeasurement{ExperimentID: "exp", MeasurementID: "m2", Timestamp: 2}, 4},
+	}
+	for i, step := range steps {
+		err := n.SendAverage(ctx, step.avg, "group2")
+		if (err != nil) != (i == 0) {
+			t.Errorf("%s: SendAverage() = %v", step.name, err)
+		}
+		failing = false
+		if posts != step.wantPosts {
+			t.Errorf("%s: %d averages posted, want %d", step.name, posts, step.wantPosts)
+		}
+	}
+}
+
+func TestNotifierForgetsOldestAverages(t *testing.T) {
+	n := NewNotifier("")
+	ctx := context.Background()
+	for i := range sentAverages + 1 {
+		n.SendAverage(ctx, models.AverageMeasurement{ExperimentID: "exp", MeasurementID: "m", Revision: i}, "")
+	}
+	if len(n.sent) != sentAverages || n.wasSent(averageKey{"exp", "m", 0}) || !n.wasSent(averageKey{"exp", "m", sentAverages}) {
+		t.Errorf("remembered %d averages, want the newest %d", len(n.sent), sentAverages)
+	}
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"average_calc_service/alerts"
+	"average_calc_service/models"
+)
+
+// ErrInvalidEvent marks a lifecycle event that cannot be used
+var ErrInvalidEvent = errors.New("invalid event")
+
+// ErrInvalidPolicy marks an alert policy that cannot be used
+var ErrInvalidPolicy = errors.New("invalid alert policy")
+
+// lookupRetry is how long an experiment postgres_service did not know is
+// not looked up again
+const lookupRetry = time.Minute
+
+// lookupTimeout bounds a lookup, which delays the average that triggered it
+const lookupTimeout = 2 * time.Second
+
+// RangeService tracks the temperature range of every experiment and checks
+// averages against it
+type RangeService struct {
+	detector *alerts.Detector
+	// postgresURL is where unknown experiments are looked up, e.g. after a
+	// restart, empty to rely on forwarded events only
+	postgresURL string
+	http        *http.Client
+	now         func() time.Time
+
+	mu     sync.Mutex
+	misses map[string]time.Time
+}
+
+// NewRangeService creates a range service using detector
+func NewRangeService(detector *alerts.Detector, postgresURL string) *RangeService {
+	return &RangeService{
+		detector:    detector,
+		postgresURL: postgresURL,
+		http:        &http.Client{Timeout: lookupTimeout},
+		now:         time.Now,
+		misses:      make(map[string]time.Time),
+	}
+}
+
+// Configure starts monitoring an experiment
+func (s *RangeService) Configure(event models.ExperimentConfigured) error {
+	rng := alerts.Range{Lower: event.TemperatureRange.LowerThreshold, Upper: event.TemperatureRange.UpperThreshold}
+	if err := validateRange(event.Experiment, rng); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if err := s.detector.Configure(event.Experiment, rng); err != nil {
+		log.Printf("Alert policy: %v", err)
+	}
+	s.mu.Lock()
+	delete(s.misses, event.Experiment)
+	s.mu.Unlock()
+	return nil
+}
+
+// Terminate stops monitoring an experiment
+func (s *RangeService) Terminate(event models.ExperimentTerminated) error {
+	if event.Experiment == "" {
+		return fmt.Errorf("%w: experiment is required", ErrInvalidEvent)
+	}
+	s.detector.Forget(event.Experiment)
+	return nil
+}
+
+// Check evaluates an average against its experiment's range. It returns the
+// alert to send, if any, and a function that must be called once the alert
+// was delivered or failed: it moves the experiment's state on if delivered
+// is set. Other averages of the experiment wait until then.
+func (s *RangeService) Check(ctx context.Context, avg models.AverageMeasurement) (*models.Alert, func(delivered bool)) {
+	release := s.detector.Hold(avg.ExperimentID)
+	if !s.detector.Known(avg.ExperimentID) {
+		s.lookup(ctx, avg.ExperimentID)
+	}
+
+	alert, next, ok := s.detector.Evaluate(avg.ExperimentID, alerts.Sample{
+		MeasurementID: avg.MeasurementID,
+		Timestamp:     avg.Timestamp,
+		Value:         avg.AvgMeasurement,
+		Running:       avg.Started,
+	})
+	if !ok {
+		return nil, func(bool) { release() }
+	}
+	done := func(delivered bool) {
+		if delivered {
+			s.detector.Commit(avg.ExperimentID, next)
+		}
+		release()
+	}
+	if alert == nil {
+		return nil, done
+	}
+
+	return &models.Alert{
+		ExperimentID:   avg.ExperimentID,
+		MeasurementID:  alert.Sample.MeasurementID,
+		Timestamp:      alert.Sample.Timestamp,
+		Type:           string(alert.Kind),
+		AvgMeasurement: alert.Sample.Value,
+		LowerThreshold: alert.Range.Lower,
+		UpperThreshold: alert.Range.Upper,
+		ExcursionStart: alert.ExcursionStart,
+	}, done
+}
+
+// SetPolicy overrides the alert policy of an experiment
+func (s *RangeService) SetPolicy(id string, policy models.AlertPolicy) error {
+	minDuration, err := time.ParseDuration(policy.MinDuration)
+	if policy.MinDuration == "" {
+		minDuration, err = 0, nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: min_duration: %v", ErrInvalidPolicy, err)
+	}
+
+	err = s.detector.SetPolicy(id, alerts.Policy{
+		MinSamples:  policy.MinSamples,
+		MinDuration: minDuration,
+		Hysteresis:  policy.Hysteresis,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	return nil
+}
+
+// ResetPolicy makes an experiment use the default alert policy again
+func (s *RangeService) ResetPolicy(id string) {
+	s.detector.ResetPolicy(id)
+}
+
+// Policy returns the alert policy of an experiment
+func (s *RangeService) Policy(id string) models.AlertPolicy {
+	policy, override := s.detector.Policy(id)
+	return models.AlertPolicy{
+		MinSamples:  policy.MinSamples,
+		MinDuration: policy.MinDuration.String(),
+		Hysteresis:  policy.Hysteresis,
+		Override:    override,
+	}
+}
+
+// lookup configures an experiment from postgres_service. Experiments it
+// does not know are not asked for again within lookupRetry.
+func (s *RangeService) lookup(ctx context.Context, id string) {
+	if s.postgresURL == "" {
+		return
+	}
+	s.mu.Lock()
+	now := s.now()
+	for missedID, missed := range s.misses {
+		if now.Sub(missed) >= lookupRetry {
+			delete(s.misses, missedID)
+		}
+	}
+	_, recent := s.misses[id]
+	s.mu.Unlock()
+	if recent {
+		return
+	}
+
+	record, err := s.fetchExperiment(ctx, id)
+	if err == nil && record.Status != "terminated" {
+		rng := alerts.Range{Lower: record.LowerThreshold, Upper: record.UpperThreshold}
+		if err = validateRange(id, rng); err == nil {
+			if err := s.detector.Configure(id, rng); err != nil {
+				log.Printf("Alert policy: %v", err)
+			}
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("Range of experiment %s unknown, not checking its averages: %v", id, err)
+	}
+	s.mu.Lock()
+	s.misses[id] = s.now()
+	s.mu.Unlock()
+}
+
+func (s *RangeService) fetchExperiment(ctx context.Context, id string) (*models.ExperimentRecord, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.postgresURL+"/experiments/"+id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach postgres_service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("postgres_service responded %d", resp.StatusCode)
+	}
+	var record models.ExperimentRecord
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		return nil, fmt.Errorf("invalid experiment: %w", err)
+	}
+	return &record, nil
+}
+
+// validateRange checks an experiment's configured range
+func validateRange(id string, rng alerts.Range) error {
+	switch {
+	case id == "":
+		return errors.New("experiment is required")
+	case math.IsNaN(rng.Lower) || math.IsNaN(rng.Upper):
+		return errors.New("thresholds must be numbers")
+	case rng.Lower > rng.Upper:
+		return fmt.Errorf("lower threshold %v is above upper threshold %v", rng.Lower, rng.Upper)
+	}
+	return nil
+}
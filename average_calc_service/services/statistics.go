@@ -0,0 +1,218 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"average_calc_service/config"
+	"average_calc_service/models"
+	"average_calc_service/stats"
+)
+
+// SeriesStatistics holds the windows of one experiment or sensor
+type SeriesStatistics struct {
+	Tumbling stats.TumblingSummary `json:"tumbling"`
+	Sliding  stats.SlidingSummary  `json:"sliding"`
+}
+
+// ExperimentStatistics holds the windows over all readings of an experiment
+// and over the readings of each of its sensors
+type ExperimentStatistics struct {
+	ExperimentID string `json:"experiment_id"`
+	SeriesStatistics
+	Sensors map[string]SeriesStatistics `json:"sensors,omitempty"`
+}
+
+// series is a tumbling and a sliding window over the same readings
+type series struct {
+	tumbling *stats.Tumbling
+	sliding  *stats.Sliding
+}
+
+func (s *series) add(ts, value float64) {
+	s.tumbling.Add(ts, value)
+	s.sliding.Add(ts, value)
+}
+
+func (s *series) remove(ts, value float64) {
+	s.tumbling.Remove(ts, value)
+	s.sliding.Remove(ts, value)
+}
+
+func (s *series) summary(percentiles []float64) SeriesStatistics {
+	return SeriesStatistics{Tumbling: s.tumbling.Summary(percentiles), Sliding: s.sliding.Summary(percentiles)}
+}
+
+// recordedGroup is a group whose readings are in the windows
+type recordedGroup struct {
+	timestamp float64
+	revision  int
+	sensors   []string
+	values    []float64
+}
+
+// experimentStats holds the windows of one experiment
+type experimentStats struct {
+	all     *series
+	sensors map[string]*series
+	// groups are remembered while their readings may still be in a window,
+	// so redelivered groups are ignored and corrected ones replace them
+	groups   map[string]recordedGroup
+	latest   float64
+	lastSeen time.Time
+}
+
+// StatisticsService keeps rolling statistics of the readings per experiment
+// and per sensor
+type StatisticsService struct {
+	cfg *config.StatisticsConfig
+	now func() time.Time
+
+	mu          sync.Mutex
+	experiments map[string]*experimentStats
+}
+
+// NewStatisticsService creates a new statistics service
+func NewStatisticsService(cfg *config.StatisticsConfig) *StatisticsService {
+	return &StatisticsService{
+		cfg:         cfg,
+		now:         time.Now,
+		experiments: make(map[string]*experimentStats),
+	}
+}
+
+// Record adds the readings of a validated group. A group seen before with
+// the same or a newer revision is ignored, a newer revision replaces the
+// readings of the older one.
+func (s *StatisticsService) Record(group models.MeasurementGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.expire(now)
+
+	exp, ok := s.experiments[group.ExperimentID]
+	if !ok {
+		exp = &experimentStats{
+			all:     s.newSeries(),
+			sensors: make(map[string]*series),
+			groups:  make(map[string]recordedGroup),
+		}
+		s.experiments[group.ExperimentID] = exp
+	}
+	exp.lastSeen = now
+
+	if group.MeasurementID != "" {
+		if old, ok := exp.groups[group.MeasurementID]; ok {
+			if group.Revision <= old.revision {
+				return
+			}
+			exp.remove(old)
+		}
+	}
+
+	recorded := recordedGroup{
+		timestamp: group.Timestamp,
+		revision:  group.Revision,
+		sensors:   group.Sensors,
+		values:    group.Measurements,
+	}
+	for i, value := range recorded.values {
+		exp.all.add(recorded.timestamp, value)
+		if i < len(recorded.sensors) {
+			sensor, ok := exp.sensors[recorded.sensors[i]]
+			if !ok {
+				sensor = s.newSeries()
+				exp.sensors[recorded.sensors[i]] = sensor
+			}
+			sensor.add(recorded.timestamp, value)
+		}
+	}
+	if group.MeasurementID != "" {
+		exp.groups[group.MeasurementID] = recorded
+	}
+
+	if group.Timestamp > exp.latest {
+		exp.latest = group.Timestamp
+		exp.forget(exp.latest - s.horizon())
+	}
+}
+
+// Experiment returns the statistics of an experiment
+func (s *StatisticsService) Experiment(id string) (ExperimentStatistics, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exp, ok := s.experiments[id]
+	if !ok {
+		return ExperimentStatistics{}, false
+	}
+
+	result := ExperimentStatistics{
+		ExperimentID:     id,
+		SeriesStatistics: exp.all.summary(s.cfg.Percentiles),
+		Sensors:          make(map[string]SeriesStatistics, len(exp.sensors)),
+	}
+	for sensor, series := range exp.sensors {
+		result.Sensors[sensor] = series.summary(s.cfg.Percentiles)
+	}
+	return result, true
+}
+
+// Sensor returns the statistics of one sensor of an experiment
+func (s *StatisticsService) Sensor(id, sensor string) (SeriesStatistics, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exp, ok := s.experiments[id]
+	if !ok {
+		return SeriesStatistics{}, false
+	}
+	series, ok := exp.sensors[sensor]
+	if !ok {
+		return SeriesStatistics{}, false
+	}
+	return series.summary(s.cfg.Percentiles), true
+}
+
+func (s *StatisticsService) newSeries() *series {
+	return &series{
+		tumbling: stats.NewTumbling(s.cfg.TumblingWindow.Seconds()),
+		sliding:  stats.NewSliding(s.cfg.SlidingWindow.Seconds()),
+	}
+}
+
+// horizon is how far back in measurement time a group's readings can still
+// be in a window: the previous and current tumbling window, or the sliding one
+func (s *StatisticsService) horizon() float64 {
+	return max(2*s.cfg.TumblingWindow.Seconds(), s.cfg.SlidingWindow.Seconds())
+}
+
+// expire drops experiments that received no group for the retention time.
+// Must be called with s.mu held.
+func (s *StatisticsService) expire(now time.Time) {
+	for id, exp := range s.experiments {
+		if now.Sub(exp.lastSeen) > s.cfg.Retention {
+			delete(s.experiments, id)
+		}
+	}
+}
+
+// remove takes the readings of a group out of the windows
+func (e *experimentStats) remove(group recordedGroup) {
+	for i, value := range group.values {
+		e.all.remove(group.timestamp, value)
+		if i < len(group.sensors) {
+			if sensor, ok := e.sensors[group.sensors[i]]; ok {
+				sensor.remove(group.timestamp, value)
+			}
+		}
+	}
+}
+
+// forget drops the groups at or before cutoff, their readings are no longer
+// in any window
+func (e *experimentStats) forget(cutoff float64) {
+	for id, group := range e.groups {
+		if group.timestamp <= cutoff {
+			delete(e.groups, id)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"average_calc_service/config"
+	"average_calc_service/models"
+)
+
+func newTestStatistics() *StatisticsService {
+	return NewStatisticsService(&config.StatisticsConfig{
+		TumblingWindow: time.Minute,
+		SlidingWindow:  5 * time.Minute,
+		Percentiles:    []float64{90},
+		Retention:      time.Hour,
+	})
+}
+
+func statsGroup(id string, ts float64, revision int, sensors []string, values ...float64) models.MeasurementGroup {
+	return models.MeasurementGroup{
+		ExperimentID:     "exp",
+		MeasurementID:    id,
+		Timestamp:        ts,
+		MeasurementCount: len(values),
+		Measurements:     values,
+		Sensors:          sensors,
+		Revision:         revision,
+	}
+}
+
+func TestStatisticsPerExperimentAndSensor(t *testing.T) {
+	s := newTestStatistics()
+	s.Record(statsGroup("m1", 60, 0, []string{"a", "b"}, 10, 20))
+	s.Record(statsGroup("m2", 61, 0, []string{"a", "b"}, 12, 22))
+
+	exp, ok := s.Experiment("exp")
+	if !ok {
+		t.Fatal("Experiment() not found")
+	}
+	if exp.Sliding.Count != 4 || exp.Sliding.Mean != 16 || exp.Tumbling.Current.Count != 4 {
+		t.Errorf("experiment statistics = %+v", exp.SeriesStatistics)
+	}
+	a, ok := s.Sensor("exp", "a")
+	if !ok || a.Sliding.Count != 2 || a.Sliding.Mean != 11 || a.Sliding.Min != 10 || a.Sliding.Max != 12 {
+		t.Errorf("sensor a = %+v", a)
+	}
+	if _, ok := s.Sensor("exp", "c"); ok {
+		t.Error("Sensor() found a sensor that never reported")
+	}
+}
+
+func TestStatisticsRevisions(t *testing.T) {
+	s := newTestStatistics()
+	s.Record(statsGroup("m1", 60, 0, []string{"a"}, 10))
+	// A redelivery is not counted twice
+	s.Record(statsGroup("m1", 60, 0, []string{"a"}, 10))
+	// A correction replaces the earlier revision
+	s.Record(statsGroup("m1", 60, 1, []string{"a", "b"}, 10, 30))
+	// An outdated revision is ignored
+	s.Record(statsGroup("m1", 60, 0, []string{"a"}, 10))
+
+	exp, _ := s.Experiment("exp")
+	if exp.Sliding.Count != 2 || exp.Sliding.Mean != 20 {
+		t.Errorf("statistics = %+v", exp.Sliding)
+	}
+	if b, ok := s.Sensor("exp", "b"); !ok || b.Sliding.Count != 1 {
+		t.Errorf("sensor b = %+v", b)
+	}
+}
+
+func TestStatisticsExpireIdleExperiments(t *testing.T) {
+	s := newTestStatistics()
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+	s.Record(statsGroup("m1", 60, 0, nil, 10))
+
+	now = now.Add(2 * time.Hour)
+	s.Record(models.MeasurementGroup{ExperimentID: "other", Timestamp: 60, MeasurementCount: 1, Measurements: []float64{1}})
+	if _, ok := s.Experiment("exp"); ok {
+		t.Error("idle experiment was not expired")
+	}
+}
@@ -0,0 +1,116 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Summary describes the values of a window
+type Summary struct {
+	Count       int                `json:"count"`
+	Mean        float64            `json:"mean"`
+	Min         float64            `json:"min"`
+	Max         float64            `json:"max"`
+	Variance    float64            `json:"variance"`
+	StdDev      float64            `json:"stddev"`
+	Median      float64            `json:"median"`
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+}
+
+// Accumulator keeps the mean and variance of its values with Welford's
+// online algorithm, which avoids the cancellation of a sum of squares. Values
+// can be removed again for sliding windows. The values are also kept sorted,
+// so min, max and quantiles are exact.
+type Accumulator struct {
+	n    int
+	mean float64
+	m2   float64
+
+	sorted []float64
+}
+
+// Add adds x
+func (a *Accumulator) Add(x float64) {
+	a.n++
+	delta := x - a.mean
+	a.mean += delta / float64(a.n)
+	a.m2 += delta * (x - a.mean)
+
+	i := sort.SearchFloat64s(a.sorted, x)
+	a.sorted = append(a.sorted, 0)
+	copy(a.sorted[i+1:], a.sorted[i:])
+	a.sorted[i] = x
+}
+
+// Remove removes a value added earlier, it reports false if x was never added
+func (a *Accumulator) Remove(x float64) bool {
+	i := sort.SearchFloat64s(a.sorted, x)
+	if i == len(a.sorted) || a.sorted[i] != x {
+		return false
+	}
+	a.sorted = append(a.sorted[:i], a.sorted[i+1:]...)
+
+	a.n--
+	if a.n == 0 {
+		a.mean, a.m2 = 0, 0
+		return true
+	}
+	delta := x - a.mean
+	a.mean -= delta / float64(a.n)
+	a.m2 -= delta * (x - a.mean)
+	if a.m2 < 0 {
+		// Rounding can leave a tiny negative remainder
+		a.m2 = 0
+	}
+	return true
+}
+
+// Count returns the number of values
+func (a *Accumulator) Count() int {
+	return a.n
+}
+
+// Summary summarises the values with the given percentiles in [0, 100]. The
+// variance is the sample variance, 0 for a single value.
+func (a *Accumulator) Summary(percentiles []float64) Summary {
+	if a.n == 0 {
+		return Summary{}
+	}
+	s := Summary{
+		Count:  a.n,
+		Mean:   a.mean,
+		Min:    a.sorted[0],
+		Max:    a.sorted[a.n-1],
+		Median: a.Quantile(0.5),
+	}
+	if a.n > 1 {
+		s.Variance = a.m2 / float64(a.n-1)
+		s.StdDev = math.Sqrt(s.Variance)
+	}
+	if len(percentiles) > 0 {
+		s.Percentiles = make(map[string]float64, len(percentiles))
+		for _, p := range percentiles {
+			s.Percentiles["p"+strconv.FormatFloat(p, 'f', -1, 64)] = a.Quantile(p / 100)
+		}
+	}
+	return s
+}
+
+// Quantile returns the q-quantile for q in [0, 1], interpolating linearly
+// between the closest ranks
+func (a *Accumulator) Quantile(q float64) float64 {
+	if a.n == 0 {
+		return 0
+	}
+	pos := q * float64(a.n-1)
+	lower := int(math.Floor(pos))
+	if lower >= a.n-1 {
+		return a.sorted[a.n-1]
+	}
+	if lower < 0 {
+		return a.sorted[0]
+	}
+	frac := pos - float64(lower)
+	return a.sorted[lower] + frac*(a.sorted[lower+1]-a.sorted[lower])
+}
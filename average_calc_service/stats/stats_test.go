@@ -0,0 +1,131 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func approx(t *testing.T, name string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-9*math.Max(1, math.Abs(want)) {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
+
+func TestAccumulatorSummary(t *testing.T) {
+	var acc Accumulator
+	for _, x := range []float64{4, 1, 3, 2, 5} {
+		acc.Add(x)
+	}
+
+	s := acc.Summary([]float64{25, 90})
+	if s.Count != 5 || s.Min != 1 || s.Max != 5 {
+		t.Errorf("Summary() = %+v", s)
+	}
+	approx(t, "mean", s.Mean, 3)
+	approx(t, "variance", s.Variance, 2.5)
+	approx(t, "stddev", s.StdDev, math.Sqrt(2.5))
+	approx(t, "median", s.Median, 3)
+	approx(t, "p25", s.Percentiles["p25"], 2)
+	approx(t, "p90", s.Percentiles["p90"], 4.6)
+}
+
+func TestAccumulatorEmptyAndSingle(t *testing.T) {
+	var acc Accumulator
+	if s := acc.Summary(nil); s.Count != 0 || s.Mean != 0 {
+		t.Errorf("empty Summary() = %+v", s)
+	}
+	acc.Add(21.5)
+	if s := acc.Summary(nil); s.Variance != 0 || s.Median != 21.5 || s.Min != 21.5 || s.Max != 21.5 {
+		t.Errorf("single Summary() = %+v", s)
+	}
+}
+
+func TestAccumulatorIsStableWithLargeOffset(t *testing.T) {
+	// A sum of squares loses these small deviations entirely
+	var acc Accumulator
+	for _, x := range []float64{1e9 + 4, 1e9 + 7, 1e9 + 13, 1e9 + 16} {
+		acc.Add(x)
+	}
+	s := acc.Summary(nil)
+	approx(t, "mean", s.Mean, 1e9+10)
+	approx(t, "variance", s.Variance, 30)
+}
+
+func TestAccumulatorRemove(t *testing.T) {
+	var acc Accumulator
+	for _, x := range []float64{10, 20, 30, 40} {
+		acc.Add(x)
+	}
+	if acc.Remove(25) {
+		t.Error("Remove(25) = true for a value never added")
+	}
+	if !acc.Remove(10) || !acc.Remove(40) {
+		t.Fatal("Remove() = false for added values")
+	}
+
+	s := acc.Summary(nil)
+	if s.Count != 2 || s.Min != 20 || s.Max != 30 {
+		t.Errorf("Summary() = %+v", s)
+	}
+	approx(t, "mean", s.Mean, 25)
+	approx(t, "variance", s.Variance, 50)
+
+	acc.Remove(20)
+	acc.Remove(30)
+	if s := acc.Summary(nil); s.Count != 0 || s.Mean != 0 || s.Variance != 0 {
+		t.Errorf("Summary() after removing everything = %+v", s)
+	}
+}
+
+func TestTumbling(t *testing.T) {
+	w := NewTumbling(60)
+	w.Add(100, 1) // window [60, 120)
+	w.Add(110, 3)
+	w.Add(130, 10) // window [120, 180)
+	w.Add(119, 5)  // late, still counts towards [60, 120)
+	w.Add(30, 100) // older than the previous window, dropped
+
+	s := w.Summary(nil)
+	if s.Start != 120 || s.End != 180 || s.Current.Count != 1 || s.Current.Mean != 10 {
+		t.Errorf("current = %+v", s)
+	}
+	if s.Previous == nil || s.Previous.Count != 3 || s.Previous.Mean != 3 {
+		t.Fatalf("previous = %+v", s.Previous)
+	}
+
+	w.Remove(110, 3)
+	if s := w.Summary(nil); s.Previous.Count != 2 || s.Previous.Mean != 3 {
+		t.Errorf("previous after Remove() = %+v", s.Previous)
+	}
+
+	w.Add(400, 7) // skips empty windows
+	if s := w.Summary(nil); s.Start != 360 || s.Previous != nil || s.Current.Count != 1 {
+		t.Errorf("after gap = %+v", s)
+	}
+}
+
+func TestSliding(t *testing.T) {
+	w := NewSliding(10)
+	w.Add(100, 1)
+	w.Add(105, 2)
+	w.Add(103, 3) // out of order
+	w.Add(110, 4) // evicts 100
+
+	s := w.Summary(nil)
+	if s.Start != 100 || s.End != 110 || s.Count != 3 || s.Min != 2 || s.Max != 4 {
+		t.Errorf("Summary() = %+v", s)
+	}
+	approx(t, "mean", s.Mean, 3)
+
+	w.Add(99, 50) // already out of the window
+	w.Remove(103, 3)
+	if s := w.Summary(nil); s.Count != 2 || s.Mean != 3 {
+		t.Errorf("Summary() after Remove() = %+v", s)
+	}
+
+	w.Add(200, 9)
+	if s := w.Summary(nil); s.Count != 1 || s.Mean != 9 || s.Variance != 0 {
+		t.Errorf("Summary() after jump = %+v", s)
+	}
+}
@@ -0,0 +1,153 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// sample is a value at a measurement timestamp in seconds
+type sample struct {
+	ts    float64
+	value float64
+}
+
+// Tumbling keeps statistics over consecutive, non-overlapping windows of a
+// fixed size, aligned to multiples of the size
+type Tumbling struct {
+	size float64
+
+	start    float64
+	current  *Accumulator
+	previous *Accumulator
+}
+
+// TumblingSummary is the open window and the last closed one
+type TumblingSummary struct {
+	Start    float64  `json:"window_start"`
+	End      float64  `json:"window_end"`
+	Current  Summary  `json:"current"`
+	Previous *Summary `json:"previous,omitempty"`
+}
+
+// NewTumbling creates windows of size seconds
+func NewTumbling(size float64) *Tumbling {
+	return &Tumbling{size: size, start: math.Inf(-1), current: &Accumulator{}}
+}
+
+// Add adds value at ts. A value for the previous window still counts
+// towards it, older values are dropped.
+func (t *Tumbling) Add(ts, value float64) {
+	if acc := t.window(ts, true); acc != nil {
+		acc.Add(value)
+	}
+}
+
+// Remove removes a value added earlier at ts, if its window is still kept
+func (t *Tumbling) Remove(ts, value float64) {
+	if acc := t.window(ts, false); acc != nil {
+		acc.Remove(value)
+	}
+}
+
+// window returns the accumulator for ts, opening a new window if advance is
+// set and ts is past the current one
+func (t *Tumbling) window(ts float64, advance bool) *Accumulator {
+	start := math.Floor(ts/t.size) * t.size
+	switch {
+	case start == t.start:
+		return t.current
+	case start == t.start-t.size:
+		return t.previous
+	case start > t.start && advance:
+		if start == t.start+t.size {
+			t.previous = t.current
+		} else {
+			// Skipped windows were empty
+			t.previous = nil
+		}
+		t.start = start
+		t.current = &Accumulator{}
+		return t.current
+	default:
+		return nil
+	}
+}
+
+// Summary summarises the current and previous window
+func (t *Tumbling) Summary(percentiles []float64) TumblingSummary {
+	if math.IsInf(t.start, -1) {
+		return TumblingSummary{}
+	}
+	s := TumblingSummary{Start: t.start, End: t.start + t.size, Current: t.current.Summary(percentiles)}
+	if t.previous != nil {
+		previous := t.previous.Summary(percentiles)
+		s.Previous = &previous
+	}
+	return s
+}
+
+// Sliding keeps statistics over the values of the last size seconds before
+// the latest timestamp seen
+type Sliding struct {
+	size float64
+
+	samples []sample // ordered by ts
+	acc     Accumulator
+}
+
+// SlidingSummary is the window ending at the latest timestamp
+type SlidingSummary struct {
+	Start float64 `json:"window_start"`
+	End   float64 `json:"window_end"`
+	Summary
+}
+
+// NewSliding creates a window of size seconds
+func NewSliding(size float64) *Sliding {
+	return &Sliding{size: size}
+}
+
+// Add adds value at ts, values that already fell out of the window are
+// dropped
+func (s *Sliding) Add(ts, value float64) {
+	if len(s.samples) > 0 && ts <= s.end()-s.size {
+		return
+	}
+	i := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].ts > ts })
+	s.samples = append(s.samples, sample{})
+	copy(s.samples[i+1:], s.samples[i:])
+	s.samples[i] = sample{ts: ts, value: value}
+	s.acc.Add(value)
+
+	// Evict what the new end pushed out
+	cutoff := s.end() - s.size
+	evict := 0
+	for evict < len(s.samples) && s.samples[evict].ts <= cutoff {
+		s.acc.Remove(s.samples[evict].value)
+		evict++
+	}
+	s.samples = s.samples[evict:]
+}
+
+// Remove removes a value added earlier at ts, if it is still in the window
+func (s *Sliding) Remove(ts, value float64) {
+	for i := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].ts >= ts }); i < len(s.samples) && s.samples[i].ts == ts; i++ {
+		if s.samples[i].value == value {
+			s.acc.Remove(value)
+			s.samples = append(s.samples[:i], s.samples[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Sliding) end() float64 {
+	return s.samples[len(s.samples)-1].ts
+}
+
+// Summary summarises the window
+func (s *Sliding) Summary(percentiles []float64) SlidingSummary {
+	if len(s.samples) == 0 {
+		return SlidingSummary{}
+	}
+	return SlidingSummary{Start: s.end() - s.size, End: s.end(), Summary: s.acc.Summary(percentiles)}
+}
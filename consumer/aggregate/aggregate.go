@@ -0,0 +1,587 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"assignment2/events"
+)
+
+// Reading is a single sensor's temperature within a group
+type Reading struct {
+	Sensor      string  `json:"sensor"`
+	Temperature float64 `json:"temperature"`
+	Tampered    bool    `json:"tampered,omitempty"`
+}
+
+// Group holds the readings of all sensors of an experiment that share a
+// measurement id
+type Group struct {
+	// Topic is the topic the group's first reading was consumed from
+	Topic         string
+	ExperimentID  string
+	MeasurementID string
+	Timestamp     float64
+	// Hash is the measurement_hash of the group's first reading, every
+	// reading of a measurement carries the same one
+	Hash     string
+	Readings []Reading
+	// Expected is the number of sensors configured for the experiment,
+	// 0 if the experiment's configuration was never seen
+	Expected int
+	// Partial is set when the group was emitted before every sensor reported
+	Partial bool
+	// Revision counts how often the group was corrected with late readings,
+	// 0 for its first emission
+	Revision int
+}
+
+// EmitFunc receives every group once it is complete or timed out
+type EmitFunc func(ctx context.Context, group Group) error
+
+// SensorLookup returns the configured sensors of an experiment whose
+// experiment_configured event the aggregator did not see
+type SensorLookup func(ctx context.Context, experiment string) ([]string, error)
+
+// lookupRetry is how long an experiment whose sensors could not be looked
+// up is not looked up again
+const lookupRetry = time.Minute
+
+// lookupTimeout bounds a lookup, which delays the reading that triggered it
+const lookupTimeout = 2 * time.Second
+
+type groupKey struct {
+	experiment    string
+	measurementID string
+}
+
+type pendingGroup struct {
+	group    Group
+	sensors  map[string]int // sensor -> index in group.Readings
+	received time.Time      // arrival of the first reading
+	// releases lets go of the messages the readings came from, which stay
+	// uncommitted until the group is emitted
+	releases []func()
+}
+
+// experimentClock tracks the event time of a single experiment
+type experimentClock struct {
+	maxTimestamp float64
+	// emittedUpTo is the newest timestamp emitted, a new group at or below
+	// it would leave out of order and is late
+	emittedUpTo float64
+	// emitted keeps groups after their emission, by measurement id, to
+	// recognise and correct late readings
+	emitted map[string]*pendingGroup
+	// inflight holds the measurement ids of groups taken from the pending
+	// set that are being emitted. A reading for one waits for the emission
+	// to end instead of starting a second group.
+	inflight map[string]bool
+	// emitting serialises the emission of the experiment's groups, which
+	// happens on the worker handling its events and on the Run goroutine
+	emitting sync.Mutex
+}
+
+// Aggregator collects sensor_temperature_measured events into groups keyed
+// by (experiment, measurement_id), using the sensor list announced by
+// experiment_configured to decide when a group is complete.
+//
+// Groups are emitted in measurement time: every experiment has a watermark
+// trailing its highest measurement timestamp by the allowed lateness, and a
+// group is emitted once the watermark reaches it. Readings below the
+// watermark whose group is gone are late and handled by the late policy.
+// Groups emitted on timeout take every older pending group of their
+// experiment with them, so an experiment's groups always leave in
+// timestamp order.
+type Aggregator struct {
+	timeout   time.Duration
+	emit      EmitFunc
+	eventTime EventTime
+	now       func() time.Time
+	counters  Counters
+	// lookup finds the sensors of experiments configured before a restart,
+	// nil to treat their groups as never complete
+	lookup SensorLookup
+
+	mu      sync.Mutex
+	sensors map[string]map[string]bool // experiment -> configured sensors
+	misses  map[string]time.Time       // experiment -> failed sensor lookup
+	pending map[groupKey]*pendingGroup
+	clocks  map[string]*experimentClock
+}
+
+// New creates an aggregator. Groups the watermark does not release are
+// emitted as partial once their first reading is older than timeout.
+func New(timeout time.Duration, emit EmitFunc, eventTime EventTime) *Aggregator {
+	if eventTime.Policy == "" {
+		eventTime.Policy = LateDrop
+	}
+	return &Aggregator{
+		timeout:   timeout,
+		emit:      emit,
+		eventTime: eventTime,
+		now:       time.Now,
+		sensors:   make(map[string]map[string]bool),
+		misses:    make(map[string]time.Time),
+		pending:   make(map[groupKey]*pendingGroup),
+		clocks:    make(map[string]*experimentClock),
+	}
+}
+
+// LookupSensors makes the aggregator ask lookup for the sensors of
+// experiments it did not see configured, e.g. after a restart
+func (a *Aggregator) LookupSensors(lookup SensorLookup) {
+	a.lookup = lookup
+}
+
+// Counters returns the aggregator's late data counters
+func (a *Aggregator) Counters() *Counters {
+	return &a.counters
+}
+
+// Pending returns the number of groups waiting to be emitted
+func (a *Aggregator) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending)
+}
+
+// Watermark returns the event time below which an experiment's groups are
+// emitted, and false if no reading of the experiment was seen
+func (a *Aggregator) Watermark(experiment string) (float64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	clock, ok := a.clocks[experiment]
+	if !ok {
+		return 0, false
+	}
+	return a.watermark(clock), true
+}
+
+// Register installs the aggregator's handlers on the dispatcher
+func (a *Aggregator) Register(d *events.Dispatcher) {
+	d.RegisterFunc(events.ExperimentConfiguredName, func(ctx context.Context, event events.Event) error {
+		a.Configure(event.(*events.ExperimentConfigured))
+		return nil
+	})
+	d.RegisterFunc(events.SensorTemperatureMeasuredName, func(ctx context.Context, event events.Event) error {
+		return a.Add(ctx, event.(*events.SensorTemperatureMeasured))
+	})
+	d.RegisterFunc(events.ExperimentTerminatedName, func(ctx context.Context, event events.Event) error {
+		return a.Terminate(ctx, event.ExperimentID())
+	})
+}
+
+// Configure records the sensors of an experiment
+func (a *Aggregator) Configure(cfg *events.ExperimentConfigured) {
+	sensors := make(map[string]bool, len(cfg.Sensors))
+	for _, sensor := range cfg.Sensors {
+		sensors[sensor] = true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sensors[cfg.Experiment] = sensors
+	delete(a.misses, cfg.Experiment)
+}
+
+// Add puts a reading into its group and emits every group of the
+// experiment the watermark has passed
+func (a *Aggregator) Add(ctx context.Context, m *events.SensorTemperatureMeasured) error {
+	key := groupKey{experiment: m.Experiment, measurementID: m.MeasurementID}
+	a.lookupSensors(ctx, m.Experiment)
+
+	a.mu.Lock()
+	clock := a.clock(m.Experiment)
+	for clock.inflight[m.MeasurementID] {
+		a.mu.Unlock()
+		// The emission holds the lock until the group is marked emitted or
+		// back in the pending set
+		clock.emitting.Lock()
+		clock.emitting.Unlock()
+		a.mu.Lock()
+		clock = a.clock(m.Experiment)
+	}
+	p, ok := a.pending[key]
+	if !ok {
+		if done := clock.emitted[m.MeasurementID]; done != nil || m.Timestamp < a.watermark(clock) || m.Timestamp <= clock.emittedUpTo {
+			a.mu.Unlock()
+			return a.late(ctx, m, done)
+		}
+		p = &pendingGroup{
+			group: Group{
+				Topic:         events.Topic(ctx),
+				ExperimentID:  m.Experiment,
+				MeasurementID: m.MeasurementID,
+				Timestamp:     m.Timestamp,
+				Hash:          m.MeasurementHash,
+				Expected:      len(a.sensors[m.Experiment]),
+			},
+			sensors:  make(map[string]int),
+			received: a.now(),
+		}
+		a.pending[key] = p
+	}
+
+	// A redelivered reading replaces the earlier one instead of counting
+	// twice, both messages are held until the group is emitted
+	p.releases = append(p.releases, events.Hold(ctx))
+	reading := Reading{Sensor: m.Sensor, Temperature: m.Temperature, Tampered: m.Tampered}
+	if i, seen := p.sensors[m.Sensor]; seen {
+		p.group.Readings[i] = reading
+	} else {
+		p.sensors[m.Sensor] = len(p.group.Readings)
+		p.group.Readings = append(p.group.Readings, reading)
+	}
+
+	if m.Timestamp > clock.maxTimestamp {
+		clock.maxTimestamp = m.Timestamp
+		a.prune(clock)
+	}
+	watermark := a.watermark(clock)
+	a.mu.Unlock()
+
+	// A complete group waits for the watermark so groups leave in
+	// measurement order, an incomplete one until the watermark passed it
+	return a.flush(ctx, func(key groupKey, p *pendingGroup) bool {
+		if key.experiment != m.Experiment {
+			return false
+		}
+		return p.group.Timestamp < watermark || (p.group.Timestamp <= watermark && a.isComplete(p))
+	})
+}
+
+// late handles a reading whose group was already emitted, done, or whose
+// timestamp is below the watermark, done is nil
+func (a *Aggregator) late(ctx context.Context, m *events.SensorTemperatureMeasured, done *pendingGroup) error {
+	if done != nil {
+		a.mu.Lock()
+		_, seen := done.sensors[m.Sensor]
+		a.mu.Unlock()
+		if seen {
+			// A redelivery of a reading that was emitted in time
+			return nil
+		}
+	}
+	a.counters.Late.Add(1)
+
+	switch a.eventTime.Policy {
+	case LateSideOutput:
+		watermark, _ := a.Watermark(m.Experiment)
+		return a.eventTime.SideOutput(ctx, m, watermark)
+	case LateReemit:
+		return a.correct(ctx, m, done)
+	default:
+		a.counters.Dropped.Add(1)
+		return nil
+	}
+}
+
+// correct re-emits done with the late reading added. A late reading without
+// an emitted group starts a new one, unless it is older than the retention,
+// in which case its group may have been emitted and forgotten.
+func (a *Aggregator) correct(ctx context.Context, m *events.SensorTemperatureMeasured, done *pendingGroup) error {
+	reading := Reading{Sensor: m.Sensor, Temperature: m.Temperature, Tampered: m.Tampered}
+
+	a.mu.Lock()
+	clock := a.clock(m.Experiment)
+	revision := 0
+	if done == nil {
+		if m.Timestamp < clock.maxTimestamp-a.eventTime.Retention.Seconds() {
+			a.mu.Unlock()
+			a.counters.Dropped.Add(1)
+			return nil
+		}
+		done = &pendingGroup{
+			group: Group{
+				Topic:         events.Topic(ctx),
+				ExperimentID:  m.Experiment,
+				MeasurementID: m.MeasurementID,
+				Timestamp:     m.Timestamp,
+				Hash:          m.MeasurementHash,
+				Expected:      len(a.sensors[m.Experiment]),
+			},
+			sensors: make(map[string]int),
+		}
+	} else {
+		revision = done.group.Revision + 1
+	}
+
+	corrected := &pendingGroup{
+		group:   done.group,
+		sensors: make(map[string]int, len(done.sensors)+1),
+	}
+	corrected.group.Readings = append(append([]Reading(nil), done.group.Readings...), reading)
+	for sensor, i := range done.sensors {
+		corrected.sensors[sensor] = i
+	}
+	corrected.sensors[m.Sensor] = len(corrected.group.Readings) - 1
+	corrected.group.Revision = revision
+	corrected.group.Partial = !a.isComplete(corrected)
+	a.mu.Unlock()
+
+	if err := a.emit(ctx, corrected.group); err != nil {
+		return err
+	}
+	if revision > 0 {
+		a.counters.Corrected.Add(1)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if clock, ok := a.clocks[m.Experiment]; ok {
+		clock.emitted[m.MeasurementID] = corrected
+	}
+	return nil
+}
+
+// lookupSensors looks up the sensors of an experiment that was not
+// configured. Experiments whose lookup failed are not asked for again
+// within lookupRetry.
+func (a *Aggregator) lookupSensors(ctx context.Context, experiment string) {
+	if a.lookup == nil {
+		return
+	}
+	a.mu.Lock()
+	now := a.now()
+	for missed, at := range a.misses {
+		if now.Sub(at) >= lookupRetry {
+			delete(a.misses, missed)
+		}
+	}
+	_, configured := a.sensors[experiment]
+	_, recent := a.misses[experiment]
+	a.mu.Unlock()
+	if configured || recent {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	sensors, err := a.lookup(ctx, experiment)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil || len(sensors) == 0 {
+		if err != nil {
+			log.Printf("Sensors of experiment %s unknown, its groups are partial: %v", experiment, err)
+		}
+		a.misses[experiment] = a.now()
+		return
+	}
+	if _, ok := a.sensors[experiment]; !ok {
+		configured := make(map[string]bool, len(sensors))
+		for _, sensor := range sensors {
+			configured[sensor] = true
+		}
+		a.sensors[experiment] = configured
+	}
+}
+
+// clock returns the event time of an experiment, creating it if needed.
+// Must be called with a.mu held.
+func (a *Aggregator) clock(experiment string) *experimentClock {
+	clock, ok := a.clocks[experiment]
+	if !ok {
+		clock = &experimentClock{
+			maxTimestamp: math.Inf(-1),
+			emittedUpTo:  math.Inf(-1),
+			emitted:      make(map[string]*pendingGroup),
+			inflight:     make(map[string]bool),
+		}
+		a.clocks[experiment] = clock
+	}
+	return clock
+}
+
+// watermark returns the event time up to which a clock's groups are
+// released. Must be called with a.mu held.
+func (a *Aggregator) watermark(clock *experimentClock) float64 {
+	return clock.maxTimestamp - a.eventTime.AllowedLateness.Seconds()
+}
+
+// prune forgets emitted groups older than the retention. Must be called
+// with a.mu held.
+func (a *Aggregator) prune(clock *experimentClock) {
+	horizon := clock.maxTimestamp - a.eventTime.Retention.Seconds()
+	for id, p := range clock.emitted {
+		if p.group.Timestamp < horizon {
+			delete(clock.emitted, id)
+		}
+	}
+}
+
+// isComplete reports whether every configured sensor reported. Must be
+// called with a.mu held.
+func (a *Aggregator) isComplete(p *pendingGroup) bool {
+	configured := a.sensors[p.group.ExperimentID]
+	if len(configured) == 0 {
+		return false
+	}
+	for sensor := range configured {
+		if _, ok := p.sensors[sensor]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// restore puts a group that failed to emit back into the pending set
+func (a *Aggregator) restore(key groupKey, p *pendingGroup) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if clock, ok := a.clocks[key.experiment]; ok {
+		delete(clock.inflight, key.measurementID)
+	}
+	if _, ok := a.pending[key]; !ok {
+		a.pending[key] = p
+	}
+}
+
+// Expire emits every group whose first reading is older than the timeout,
+// whether or not the watermark reached it
+func (a *Aggregator) Expire(ctx context.Context) error {
+	deadline := a.now().Add(-a.timeout)
+	return a.flush(ctx, func(key groupKey, p *pendingGroup) bool {
+		return p.received.Before(deadline)
+	})
+}
+
+// Terminate emits the remaining groups of an experiment and forgets its
+// configuration and event time
+func (a *Aggregator) Terminate(ctx context.Context, experiment string) error {
+	if err := a.flush(ctx, func(key groupKey, p *pendingGroup) bool {
+		return key.experiment == experiment
+	}); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sensors, experiment)
+	delete(a.misses, experiment)
+	delete(a.clocks, experiment)
+	return nil
+}
+
+// Flush emits every pending group
+func (a *Aggregator) Flush(ctx context.Context) error {
+	return a.flush(ctx, func(groupKey, *pendingGroup) bool { return true })
+}
+
+// Run calls Expire periodically until ctx is cancelled
+func (a *Aggregator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.Expire(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("Failed to emit expired measurement groups: %v", err)
+			}
+		}
+	}
+}
+
+// flush removes the matching groups and emits them, as partial unless
+// complete, one experiment at a time
+func (a *Aggregator) flush(ctx context.Context, match func(groupKey, *pendingGroup) bool) error {
+	a.mu.Lock()
+	experiments := make(map[string]bool)
+	for key, p := range a.pending {
+		if match(key, p) {
+			experiments[key.experiment] = true
+		}
+	}
+	a.mu.Unlock()
+
+	var errs []error
+	for experiment := range experiments {
+		if err := a.flushExperiment(ctx, experiment, match); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flushExperiment emits the matching groups of an experiment together with
+// its older pending groups, in measurement order. Emission stops at the
+// first failure, the failed group and the ones after it are kept for the
+// next flush.
+func (a *Aggregator) flushExperiment(ctx context.Context, experiment string, match func(groupKey, *pendingGroup) bool) error {
+	type dueGroup struct {
+		key groupKey
+		p   *pendingGroup
+	}
+
+	// A clock Terminate removed is not brought back, its groups were
+	// emitted by Terminate
+	a.mu.Lock()
+	clock, ok := a.clocks[experiment]
+	a.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	clock.emitting.Lock()
+	defer clock.emitting.Unlock()
+
+	a.mu.Lock()
+	horizon := math.Inf(-1)
+	for key, p := range a.pending {
+		if key.experiment == experiment && match(key, p) {
+			horizon = math.Max(horizon, p.group.Timestamp)
+		}
+	}
+	var due []dueGroup
+	for key, p := range a.pending {
+		if key.experiment == experiment && p.group.Timestamp <= horizon {
+			p.group.Partial = !a.isComplete(p)
+			due = append(due, dueGroup{key, p})
+			delete(a.pending, key)
+			clock.inflight[key.measurementID] = true
+		}
+	}
+	a.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].p.group.Timestamp < due[j].p.group.Timestamp
+	})
+
+	for i, d := range due {
+		if err := a.emit(ctx, d.p.group); err != nil {
+			for _, rest := range due[i:] {
+				a.restore(rest.key, rest.p)
+			}
+			return fmt.Errorf("group %s/%s: %w", experiment, d.key.measurementID, err)
+		}
+		a.markEmitted(d.key, d.p)
+	}
+	return nil
+}
+
+// markEmitted remembers an emitted group for late readings and releases
+// the messages its readings came from
+func (a *Aggregator) markEmitted(key groupKey, p *pendingGroup) {
+	a.mu.Lock()
+	releases := p.releases
+	p.releases = nil
+	if clock, ok := a.clocks[key.experiment]; ok {
+		clock.emitted[key.measurementID] = p
+		clock.emittedUpTo = math.Max(clock.emittedUpTo, p.group.Timestamp)
+		delete(clock.inflight, key.measurementID)
+	}
+	a.mu.Unlock()
+
+	for _, release := range releases {
+		release()
+	}
+}
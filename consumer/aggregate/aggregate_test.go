@@ -0,0 +1,377 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"assignment2/events"
+)
+
+// recorder collects emitted groups as "measurement_id" or, for partial
+// groups, "measurement_id?", and fails emission while fail is set
+type recorder struct {
+	emitted []string
+	groups  []Group
+	fail    error
+}
+
+func (r *recorder) emit(ctx context.Context, group Group) error {
+	if r.fail != nil {
+		return r.fail
+	}
+	name := group.MeasurementID
+	if group.Partial {
+		name += "?"
+	}
+	r.emitted = append(r.emitted, name)
+	r.groups = append(r.groups, group)
+	return nil
+}
+
+func reading(sensor, id string, ts float64) *events.SensorTemperatureMeasured {
+	return &events.SensorTemperatureMeasured{
+		Experiment:    "exp",
+		Sensor:        sensor,
+		MeasurementID: id,
+		Timestamp:     ts,
+		Temperature:   ts,
+	}
+}
+
+func newTestAggregator(r *recorder, eventTime EventTime) *Aggregator {
+	a := New(time.Minute, r.emit, eventTime)
+	a.Configure(&events.ExperimentConfigured{Experiment: "exp", Sensors: []string{"a", "b"}})
+	return a
+}
+
+func TestAggregatorWatermark(t *testing.T) {
+	tests := []struct {
+		name     string
+		lateness time.Duration
+		readings []*events.SensorTemperatureMeasured
+		want     []string
+	}{
+		{
+			name: "complete groups leave at the watermark",
+			readings: []*events.SensorTemperatureMeasured{
+				reading("a", "m1", 1), reading("b", "m1", 1),
+				reading("a", "m2", 2), reading("b", "m2", 2),
+			},
+			want: []string{"m1", "m2"},
+		},
+		{
+			name: "incomplete group leaves once passed",
+			readings: []*events.SensorTemperatureMeasured{
+				reading("a", "m1", 1),
+				reading("a", "m2", 2),
+			},
+			want: []string{"m1?"},
+		},
+		{
+			name:     "complete group waits for the allowed lateness",
+			lateness: 2 * time.Second,
+			readings: []*events.SensorTemperatureMeasured{
+				reading("a", "m1", 1), reading("b", "m1", 1),
+				reading("a", "m2", 2), reading("b", "m2", 2),
+				reading("a", "m3", 3),
+			},
+			want: []string{"m1"},
+		},
+		{
+			name:     "groups leave in measurement order",
+			lateness: 2 * time.Second,
+			readings: []*events.SensorTemperatureMeasured{
+				reading("a", "m2", 2), reading("b", "m2", 2),
+				reading("a", "m1", 1), reading("b", "m1", 1),
+				reading("a", "m5", 5),
+			},
+			want: []string{"m1", "m2"},
+		},
+		{
+			name: "redelivered reading counts once",
+			readings: []*events.SensorTemperatureMeasured{
+				reading("a", "m1", 1), reading("a", "m1", 1),
+				reading("a", "m2", 2),
+			},
+			want: []string{"m1?"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			a := newTestAggregator(r, EventTime{AllowedLateness: tt.lateness, Retention: time.Minute})
+			for _, m := range tt.readings {
+				if err := a.Add(context.Background(), m); err != nil {
+					t.Fatalf("Add(%s/%s) = %v", m.MeasurementID, m.Sensor, err)
+				}
+			}
+			if !reflect.DeepEqual(r.emitted, tt.want) {
+				t.Errorf("emitted %v, want %v", r.emitted, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregatorExpireEmitsOlderGroupsInOrder(t *testing.T) {
+	r := &recorder{}
+	a := newTestAggregator(r, EventTime{AllowedLateness: time.Hour, Retention: time.Hour})
+	now := time.Unix(1000, 0)
+	a.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	add := func(m *events.SensorTemperatureMeasured) {
+		if err := a.Add(ctx, m); err != nil {
+			t.Fatalf("Add(%s) = %v", m.MeasurementID, err)
+		}
+	}
+
+	// m3 arrives first, m1 and m2 are newer arrivals but older measurements,
+	// m4 is newer than m3 and stays
+	add(reading("a", "m3", 3))
+	now = now.Add(time.Minute)
+	add(reading("a", "m2", 2))
+	add(reading("a", "m1", 1))
+	add(reading("b", "m1", 1))
+	add(reading("a", "m4", 4))
+
+	now = now.Add(time.Second)
+	if err := a.Expire(ctx); err != nil {
+		t.Fatalf("Expire() = %v", err)
+	}
+	if want := []string{"m1", "m2?", "m3?"}; !reflect.DeepEqual(r.emitted, want) {
+		t.Errorf("emitted %v, want %v", r.emitted, want)
+	}
+	if a.Pending() != 1 {
+		t.Errorf("Pending() = %d, want 1", a.Pending())
+	}
+
+	// A new group below what was emitted would leave out of order
+	add(reading("a", "m0", 0))
+	if got := a.Counters().Late.Load(); got != 1 {
+		t.Errorf("Late = %d, want 1", got)
+	}
+}
+
+func TestAggregatorReleasesHeldMessagesAfterEmit(t *testing.T) {
+	r := &recorder{fail: errors.New("unavailable")}
+	a := newTestAggregator(r, EventTime{Retention: time.Minute})
+
+	held, released := 0, 0
+	ctx := events.WithHold(context.Background(), func() func() {
+		held++
+		return func() { released++ }
+	})
+
+	for _, m := range []*events.SensorTemperatureMeasured{
+		reading("a", "m1", 1), reading("b", "m1", 1), reading("a", "m2", 2),
+	} {
+		a.Add(ctx, m)
+	}
+	if held != 3 || released != 0 {
+		t.Fatalf("held %d, released %d after a failed emit, want 3 and 0", held, released)
+	}
+	if a.Pending() != 2 {
+		t.Fatalf("Pending() = %d after a failed emit, want 2", a.Pending())
+	}
+
+	r.fail = nil
+	if err := a.Flush(ctx); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	if released != 3 {
+		t.Errorf("released %d, want 3", released)
+	}
+	if want := []string{"m1", "m2?"}; !reflect.DeepEqual(r.emitted, want) {
+		t.Errorf("emitted %v, want %v", r.emitted, want)
+	}
+}
+
+func TestAggregatorLatePolicy(t *testing.T) {
+	tests := []struct {
+		policy        LatePolicy
+		want          []string
+		late, dropped int64
+		revision      int
+	}{
+		{LateDrop, []string{"m1?"}, 1, 1, 0},
+		{LateReemit, []string{"m1?", "m1"}, 1, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			r := &recorder{}
+			a := newTestAggregator(r, EventTime{Retention: time.Minute, Policy: tt.policy})
+			ctx := context.Background()
+			for _, m := range []*events.SensorTemperatureMeasured{
+				reading("a", "m1", 1), reading("a", "m2", 2), reading("b", "m1", 1),
+			} {
+				if err := a.Add(ctx, m); err != nil {
+					t.Fatalf("Add(%s/%s) = %v", m.MeasurementID, m.Sensor, err)
+				}
+			}
+
+			if !reflect.DeepEqual(r.emitted, tt.want) {
+				t.Errorf("emitted %v, want %v", r.emitted, tt.want)
+			}
+			counters := a.Counters()
+			if counters.Late.Load() != tt.late || counters.Dropped.Load() != tt.dropped {
+				t.Errorf("late %d, dropped %d, want %d and %d", counters.Late.Load(), counters.Dropped.Load(), tt.late, tt.dropped)
+			}
+			if last := r.groups[len(r.groups)-1]; last.Revision != tt.revision {
+				t.Errorf("revision %d, want %d", last.Revision, tt.revision)
+			}
+		})
+	}
+}
+
+func TestAggregatorTerminateFlushesAndForgets(t *testing.T) {
+	r := &recorder{}
+	a := newTestAggregator(r, EventTime{AllowedLateness: time.Hour})
+	ctx := context.Background()
+	for i := range 3 {
+		a.Add(ctx, reading("a", fmt.Sprintf("m%d", 3-i), float64(3-i)))
+	}
+
+	if err := a.Terminate(ctx, "exp"); err != nil {
+		t.Fatalf("Terminate() = %v", err)
+	}
+	if want := []string{"m1?", "m2?", "m3?"}; !reflect.DeepEqual(r.emitted, want) {
+		t.Errorf("emitted %v, want %v", r.emitted, want)
+	}
+	if _, ok := a.Watermark("exp"); ok {
+		t.Error("Watermark() known after Terminate()")
+	}
+}
+
+func TestAggregatorLooksUpSensorsAfterRestart(t *testing.T) {
+	tests := []struct {
+		name    string
+		sensors []string
+		err     error
+		want    []string
+		lookups int
+	}{
+		{"sensors found", []string{"a", "b"}, nil, []string{"m1", "m2"}, 1},
+		{"experiment unknown", nil, nil, []string{"m1?", "m2?"}, 1},
+		{"lookup failed", nil, errors.New("down"), []string{"m1?", "m2?"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			// No experiment_configured, as after a restart
+			a := New(time.Minute, r.emit, EventTime{})
+			lookups := 0
+			a.LookupSensors(func(ctx context.Context, experiment string) ([]string, error) {
+				lookups++
+				return tt.sensors, tt.err
+			})
+			ctx := context.Background()
+			for _, m := range []*events.SensorTemperatureMeasured{
+				reading("a", "m1", 1), reading("b", "m1", 1),
+				reading("a", "m2", 2), reading("b", "m2", 2),
+			} {
+				if err := a.Add(ctx, m); err != nil {
+					t.Fatalf("Add() = %v", err)
+				}
+			}
+			a.Flush(ctx)
+
+			if !reflect.DeepEqual(r.emitted, tt.want) {
+				t.Errorf("emitted %v, want %v", r.emitted, tt.want)
+			}
+			// Failed lookups are not repeated for every reading
+			if lookups != tt.lookups {
+				t.Errorf("%d lookups, want %d", lookups, tt.lookups)
+			}
+		})
+	}
+}
+
+func TestAggregatorReadingDuringFlush(t *testing.T) {
+	r := &recorder{}
+	emitting := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	a := New(time.Minute, func(ctx context.Context, group Group) error {
+		once.Do(func() {
+			close(emitting)
+			<-release
+		})
+		return r.emit(ctx, group)
+	}, EventTime{Retention: time.Minute, Policy: LateReemit})
+	a.Configure(&events.ExperimentConfigured{Experiment: "exp", Sensors: []string{"a", "b"}})
+	ctx := context.Background()
+	a.Add(ctx, reading("a", "m1", 1))
+
+	flushed := make(chan error)
+	go func() { flushed <- a.Flush(ctx) }()
+	<-emitting
+	added := make(chan error)
+	go func() { added <- a.Add(ctx, reading("b", "m1", 1)) }()
+	select {
+	case err := <-added:
+		t.Fatalf("Add() = %v while its group was being emitted", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-flushed; err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	if err := <-added; err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	a.Flush(ctx)
+
+	// The reading corrects the emitted group instead of starting another
+	if want := []string{"m1?", "m1"}; !reflect.DeepEqual(r.emitted, want) {
+		t.Errorf("emitted %v, want %v", r.emitted, want)
+	}
+	if last := r.groups[len(r.groups)-1]; last.Revision != 1 {
+		t.Errorf("revision %d, want 1", last.Revision)
+	}
+}
+
+func TestAggregatorTerminateDuringExpire(t *testing.T) {
+	for range 100 {
+		var mu sync.Mutex
+		a := New(time.Minute, func(ctx context.Context, group Group) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return nil
+		}, EventTime{})
+		now := time.Unix(1000, 0)
+		a.now = func() time.Time { return now }
+		ctx := context.Background()
+		a.Configure(&events.ExperimentConfigured{Experiment: "exp", Sensors: []string{"a", "b"}})
+		a.Add(ctx, reading("a", "m1", 1))
+		now = now.Add(time.Hour)
+
+		expired := make(chan error)
+		go func() { expired <- a.Expire(ctx) }()
+		if err := a.Terminate(ctx, "exp"); err != nil {
+			t.Fatalf("Terminate() = %v", err)
+		}
+		<-expired
+		if _, ok := a.Watermark("exp"); ok {
+			t.Fatal("Expire() brought back the clock Terminate() removed")
+		}
+	}
+}
+
+func TestAggregatorKeepsTopic(t *testing.T) {
+	r := &recorder{}
+	a := newTestAggregator(r, EventTime{})
+	ctx := context.Background()
+	a.Add(events.WithTopic(ctx, "group3"), reading("a", "m1", 1))
+	// A redelivery through another topic does not move the group
+	a.Add(events.WithTopic(ctx, "group2"), reading("b", "m1", 1))
+	a.Flush(ctx)
+
+	if len(r.groups) != 1 || r.groups[0].Topic != "group3" {
+		t.Errorf("emitted %+v, want one group from group3", r.groups)
+	}
+}
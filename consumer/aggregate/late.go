@@ -0,0 +1,109 @@
+package aggregate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"assignment2/events"
+)
+
+// LatePolicy decides what happens to a reading that arrives after the
+// watermark passed its group
+type LatePolicy string
+
+const (
+	// LateDrop counts and drops late readings
+	LateDrop LatePolicy = "drop"
+	// LateSideOutput hands late readings to EventTime.SideOutput
+	LateSideOutput LatePolicy = "side-output"
+	// LateReemit emits the group again with the late reading added and its
+	// Revision increased, so downstream can correct the aggregate
+	LateReemit LatePolicy = "reemit"
+)
+
+// ParseLatePolicy validates a late policy name
+func ParseLatePolicy(name string) (LatePolicy, error) {
+	switch p := LatePolicy(strings.ToLower(name)); p {
+	case LateDrop, LateSideOutput, LateReemit:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown late policy %q, expected drop, side-output or reemit", name)
+	}
+}
+
+// SideOutputFunc receives late readings with the watermark they missed
+type SideOutputFunc func(ctx context.Context, m *events.SensorTemperatureMeasured, watermark float64) error
+
+// EventTime configures the aggregator's event time processing
+type EventTime struct {
+	// AllowedLateness is how far, in measurement time, readings may trail
+	// the latest reading of their experiment before they count as late
+	AllowedLateness time.Duration
+	// Retention is how long, in measurement time, emitted groups are kept
+	// to recognise and correct late readings
+	Retention time.Duration
+	Policy    LatePolicy
+	// SideOutput is required by LateSideOutput
+	SideOutput SideOutputFunc
+}
+
+// Counters holds how many readings arrived late and what became of them
+type Counters struct {
+	Late      atomic.Int64
+	Dropped   atomic.Int64
+	Corrected atomic.Int64
+}
+
+// lateReading is a single line of a side output file
+type lateReading struct {
+	Measurement *events.SensorTemperatureMeasured `json:"measurement"`
+	Watermark   float64                           `json:"watermark"`
+	DetectedAt  time.Time                         `json:"detected_at"`
+}
+
+// SideOutput appends late readings to one NDJSON file per experiment
+type SideOutput struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewSideOutput creates the side output directory if needed
+func NewSideOutput(dir string) (*SideOutput, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create late reading directory: %w", err)
+	}
+	return &SideOutput{dir: dir}, nil
+}
+
+// Put appends m and the watermark it missed to <experiment>.ndjson
+func (s *SideOutput) Put(ctx context.Context, m *events.SensorTemperatureMeasured, watermark float64) error {
+	line, err := json.Marshal(lateReading{
+		Measurement: m,
+		Watermark:   watermark,
+		DetectedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal late reading: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(s.dir, filepath.Base(m.Experiment)+".ndjson"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open late reading file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write late reading file: %w", err)
+	}
+	return nil
+}
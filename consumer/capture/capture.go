@@ -0,0 +1,278 @@
+package capture
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Capture files are gzip compressed NDJSON, one Record per line
+const fileSuffix = ".ndjson.gz"
+
+// Header is a single Kafka message header
+type Header struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Record is a Kafka message exactly as it was received
+type Record struct {
+	Topic     string    `json:"topic"`
+	Partition int       `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Key       []byte    `json:"key,omitempty"`
+	Value     []byte    `json:"value"`
+	Headers   []Header  `json:"headers,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// NewRecord converts a received message
+func NewRecord(msg kafka.Message) Record {
+	headers := make([]Header, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers = append(headers, Header{Key: h.Key, Value: h.Value})
+	}
+	return Record{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   headers,
+		Time:      msg.Time,
+	}
+}
+
+// Message converts the record back into the message it was captured from
+func (r Record) Message() kafka.Message {
+	headers := make([]kafka.Header, 0, len(r.Headers))
+	for _, h := range r.Headers {
+		headers = append(headers, kafka.Header{Key: h.Key, Value: h.Value})
+	}
+	return kafka.Message{
+		Topic:     r.Topic,
+		Partition: r.Partition,
+		Offset:    r.Offset,
+		Key:       r.Key,
+		Value:     r.Value,
+		Headers:   headers,
+		Time:      r.Time,
+	}
+}
+
+// Recorder writes received messages to rotating capture files in a
+// directory. A new file is started once the current one holds maxBytes of
+// uncompressed records.
+type Recorder struct {
+	dir      string
+	maxBytes int64
+	prefix   string
+
+	mu      sync.Mutex
+	seq     int
+	file    *os.File
+	gz      *gzip.Writer
+	written int64
+}
+
+// NewRecorder creates the capture directory if needed
+func NewRecorder(dir string, maxBytes int64) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+	return &Recorder{
+		dir:      dir,
+		maxBytes: maxBytes,
+		prefix:   "capture-" + time.Now().UTC().Format("20060102T150405Z"),
+	}, nil
+}
+
+// Write appends msg to the current capture file. Every record is flushed so
+// a crash loses at most the record being written.
+func (r *Recorder) Write(msg kafka.Message) error {
+	line, err := json.Marshal(NewRecord(msg))
+	if err != nil {
+		return fmt.Errorf("failed to marshal capture record: %w", err)
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.gz == nil || (r.maxBytes > 0 && r.written+int64(len(line)) > r.maxBytes) {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.gz.Write(line); err != nil {
+		return fmt.Errorf("failed to write capture record: %w", err)
+	}
+	if err := r.gz.Flush(); err != nil {
+		return fmt.Errorf("failed to flush capture file: %w", err)
+	}
+	r.written += int64(len(line))
+	return nil
+}
+
+// rotate closes the current file and opens the next. Must be called with
+// r.mu held.
+func (r *Recorder) rotate() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+
+	r.seq++
+	path := filepath.Join(r.dir, fmt.Sprintf("%s-%04d%s", r.prefix, r.seq, fileSuffix))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create capture file: %w", err)
+	}
+
+	r.file = file
+	r.gz = gzip.NewWriter(file)
+	r.written = 0
+	return nil
+}
+
+func (r *Recorder) closeFile() error {
+	if r.gz == nil {
+		return nil
+	}
+	gzErr := r.gz.Close()
+	fileErr := r.file.Close()
+	r.gz, r.file = nil, nil
+	if err := errors.Join(gzErr, fileErr); err != nil {
+		return fmt.Errorf("failed to close capture file: %w", err)
+	}
+	return nil
+}
+
+// Close finishes the current capture file
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closeFile()
+}
+
+// Reader reads the records of capture files one at a time, so a replay
+// holds a single record in memory
+type Reader struct {
+	paths []string // files not opened yet
+
+	path  string
+	file  *os.File
+	gz    *gzip.Reader
+	lines *bufio.Reader
+}
+
+// OpenDir reads the capture files in dir, oldest file first. A truncated
+// last record, as left behind by a crash, is ignored.
+func OpenDir(dir string) (*Reader, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list capture directory: %w", err)
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), fileSuffix) {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return &Reader{paths: paths}, nil
+}
+
+// OpenFile reads a single capture file
+func OpenFile(path string) (*Reader, error) {
+	r := &Reader{}
+	if err := r.open(path); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Next returns the next record, or io.EOF after the last one. After a
+// corrupt record the following ones are still read.
+func (r *Reader) Next() (Record, error) {
+	for {
+		if r.lines == nil {
+			if len(r.paths) == 0 {
+				return Record{}, io.EOF
+			}
+			path := r.paths[0]
+			r.paths = r.paths[1:]
+			if err := r.open(path); err != nil {
+				return Record{}, err
+			}
+		}
+
+		line, err := r.lines.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var record Record
+			if err := json.Unmarshal(line, &record); err != nil {
+				return Record{}, fmt.Errorf("corrupt record in %s: %w", r.path, err)
+			}
+			return record, nil
+		}
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			if err := r.closeFile(); err != nil {
+				return Record{}, err
+			}
+			continue
+		}
+		if err != nil {
+			// The rest of the file is skipped, the next call reads the next
+			// file
+			r.closeFile()
+			return Record{}, fmt.Errorf("failed to read capture file %s: %w", r.path, err)
+		}
+	}
+}
+
+func (r *Reader) open(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open capture file: %w", err)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open capture file %s: %w", path, err)
+	}
+	r.path, r.file, r.gz, r.lines = path, f, gz, bufio.NewReader(gz)
+	return nil
+}
+
+func (r *Reader) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	// The gzip stream of a truncated file fails to close, its complete
+	// records were read
+	r.gz.Close()
+	err := r.file.Close()
+	r.file, r.gz, r.lines = nil, nil, nil
+	if err != nil {
+		return fmt.Errorf("failed to close capture file %s: %w", r.path, err)
+	}
+	return nil
+}
+
+// Close closes the file being read
+func (r *Reader) Close() error {
+	r.paths = nil
+	return r.closeFile()
+}
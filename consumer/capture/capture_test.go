@@ -0,0 +1,159 @@
+package capture
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// readAll reads every record of r and closes it
+func readAll(r *Reader, err error) ([]Record, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var records []Record
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func messages(n int) []kafka.Message {
+	msgs := make([]kafka.Message, n)
+	for i := range msgs {
+		msgs[i] = kafka.Message{
+			Topic:     "group2",
+			Partition: i % 3,
+			Offset:    int64(i),
+			Key:       []byte(fmt.Sprintf("exp%d", i%2)),
+			Value:     []byte{0, 1, byte(i)},
+			Headers:   []kafka.Header{{Key: "attempt", Value: []byte("1")}},
+			Time:      time.Unix(1700000000+int64(i), 0).UTC(),
+		}
+	}
+	return msgs
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int64
+		close    bool
+		files    int
+	}{
+		{"single file", 0, true, 1},
+		{"rotated files", 600, true, 4},
+		{"not closed after a crash", 0, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			r, err := NewRecorder(dir, tt.maxBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := messages(10)
+			for _, msg := range want {
+				if err := r.Write(msg); err != nil {
+					t.Fatalf("Write() = %v", err)
+				}
+			}
+			if tt.close {
+				if err := r.Close(); err != nil {
+					t.Fatalf("Close() = %v", err)
+				}
+			}
+
+			files, _ := filepath.Glob(filepath.Join(dir, "*"+fileSuffix))
+			if len(files) != tt.files {
+				t.Errorf("wrote %d files, want %d", len(files), tt.files)
+			}
+
+			records, err := readAll(OpenDir(dir))
+			if err != nil {
+				t.Fatalf("reading the directory = %v", err)
+			}
+			got := make([]kafka.Message, len(records))
+			for i, record := range records {
+				got[i] = record.Message()
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("read %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestOpenFileIgnoresTruncatedRecord(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRecorder(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages(3) {
+		r.Write(msg)
+	}
+	r.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+fileSuffix))
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cutting into the compressed stream loses the gzip trailer and the end
+	// of the last record
+	if err := os.WriteFile(files[0], data[:len(data)-20], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := readAll(OpenFile(files[0]))
+	if err != nil {
+		t.Fatalf("reading the file = %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("read %d records, want the 2 complete ones", len(records))
+	}
+}
+
+func TestOpenDirSkipsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a capture"), 0o644)
+	os.Mkdir(filepath.Join(dir, "sub"+fileSuffix), 0o755)
+
+	records, err := readAll(OpenDir(dir))
+	if err != nil || len(records) != 0 {
+		t.Errorf("read %d records, %v, want none", len(records), err)
+	}
+	if _, err := OpenDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("OpenDir() of a missing directory succeeded")
+	}
+}
+
+func TestReaderReportsCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRecorder(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write(messages(1)[0])
+	r.gz.Write([]byte("{not json\n"))
+	r.Close()
+
+	records, err := readAll(OpenDir(dir))
+	if len(records) != 1 || err == nil {
+		t.Errorf("read %d records, %v, want 1 and a corrupt record error", len(records), err)
+	}
+}
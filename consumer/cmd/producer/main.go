@@ -0,0 +1,159 @@
+// Command producer generates experiment traffic from a load file such as
+// loads/2.json and publishes it as Avro OCF messages to Kafka or to capture
+// files, replacing the external experiment producer image for local tests.
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"assignment2/capture"
+	"assignment2/config"
+	"assignment2/simulate"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func main() {
+	var kafkaCfg config.KafkaConfig
+	kafkaCfg.RegisterFlags(flag.CommandLine)
+	configFile := flag.String("config-file", "loads/2.json", "Load file describing the experiments")
+	output := flag.String("output", "kafka", "Where to send the messages: kafka or capture")
+	topic := flag.String("topic", "", "Topic to produce to, also recorded in capture files")
+	captureDir := flag.String("capture-dir", "", "Directory for capture files when -output capture")
+	seed := flag.Int64("seed", 1, "Seed for experiment ids, temperatures and hashes")
+	start := flag.Float64("start", 0, "Unix time the load file's start_time is relative to, 0 for now")
+	timing := flag.String("timing", "original", "Send messages at their sample times (original) or as fast as possible (fast)")
+	hashKey := flag.String("hash-key", "", "Base64 encoded AES key used to encrypt measurement hashes")
+	flag.Parse()
+
+	if *topic == "" {
+		log.Fatal("-topic is required")
+	}
+	if *timing != "original" && *timing != "fast" {
+		log.Fatalf("Unknown timing %q, expected original or fast", *timing)
+	}
+
+	configs, err := simulate.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := simulate.Options{Seed: *seed, Start: time.Now()}
+	if *start > 0 {
+		opts.Start = time.Unix(0, int64(*start*1e9))
+	}
+	if *hashKey != "" {
+		if opts.HashKey, err = base64.StdEncoding.DecodeString(*hashKey); err != nil {
+			log.Fatalf("Hash key is not valid base64: %v", err)
+		}
+	}
+
+	generated, err := simulate.Generate(configs, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := producer{
+		kafkaCfg:   &kafkaCfg,
+		output:     *output,
+		topic:      *topic,
+		captureDir: *captureDir,
+		timing:     *timing,
+	}
+	log.Printf("Producing %d events for %d experiments to %s", len(generated), len(configs), *topic)
+	// Fatal only once run has returned, so its deferred writer and recorder
+	// Close calls have flushed what was already sent
+	if err := p.run(generated); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type producer struct {
+	kafkaCfg   *config.KafkaConfig
+	output     string
+	topic      string
+	captureDir string
+	timing     string
+}
+
+// run sends the generated events to the configured output. It returns
+// instead of exiting so the output is always closed.
+func (p *producer) run(generated []simulate.Event) error {
+	encoder, err := simulate.NewEncoder()
+	if err != nil {
+		return err
+	}
+
+	var send func(ctx context.Context, msg kafka.Message) error
+	switch p.output {
+	case "kafka":
+		if err := p.kafkaCfg.Validate(); err != nil {
+			return err
+		}
+		writer, err := p.kafkaCfg.Writer(p.topic)
+		if err != nil {
+			return fmt.Errorf("failed to configure Kafka connection: %w", err)
+		}
+		defer writer.Close()
+		send = func(ctx context.Context, msg kafka.Message) error {
+			msg.Topic = ""
+			return writer.WriteMessages(ctx, msg)
+		}
+	case "capture":
+		if p.captureDir == "" {
+			return errors.New("-capture-dir is required for -output capture")
+		}
+		recorder, err := capture.NewRecorder(p.captureDir, 0)
+		if err != nil {
+			return err
+		}
+		defer recorder.Close()
+		var offset int64
+		send = func(ctx context.Context, msg kafka.Message) error {
+			msg.Offset = offset
+			offset++
+			return recorder.Write(msg)
+		}
+	default:
+		return fmt.Errorf("unknown output %q, expected kafka or capture", p.output)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	for i, event := range generated {
+		if p.timing == "original" {
+			select {
+			case <-ctx.Done():
+				log.Printf("Interrupted after %d events", i)
+				return nil
+			case <-time.After(time.Until(event.Time)):
+			}
+		}
+
+		value, err := encoder.Encode(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s after %d events: %w", event.Name, i, err)
+		}
+		msg := kafka.Message{
+			Topic: p.topic,
+			// Keyed by experiment so an experiment's events stay on one partition
+			Key:   []byte(event.Experiment),
+			Value: value,
+			Time:  event.Time,
+		}
+		if err := send(ctx, msg); err != nil {
+			return fmt.Errorf("failed to send %s after %d events: %w", event.Name, i, err)
+		}
+	}
+	log.Printf("Produced %d events", len(generated))
+	return nil
+}
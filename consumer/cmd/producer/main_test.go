@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"assignment2/capture"
+	"assignment2/config"
+	"assignment2/simulate"
+)
+
+func generate(t *testing.T, start time.Time) []simulate.Event {
+	t.Helper()
+	cfg := simulate.ExperimentConfig{NumSensors: 2, SampleRate: 20, StabilizationSamples: 1, CarryOutSamples: 1}
+	cfg.TempRange.LowerThreshold, cfg.TempRange.UpperThreshold = 10, 20
+	generated, err := simulate.Generate([]simulate.ExperimentConfig{cfg}, simulate.Options{Seed: 1, Start: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return generated
+}
+
+func TestProducerCapture(t *testing.T) {
+	tests := []struct {
+		timing  string
+		minTime time.Duration
+	}{
+		{"fast", 0},
+		// The last event is 4 samples of 20ms after the first
+		{"original", 80 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.timing, func(t *testing.T) {
+			dir := t.TempDir()
+			generated := generate(t, time.Now())
+			p := producer{output: "capture", topic: "group2", captureDir: dir, timing: tt.timing}
+
+			began := time.Now()
+			if err := p.run(generated); err != nil {
+				t.Fatalf("run() = %v", err)
+			}
+			if elapsed := time.Since(began); elapsed < tt.minTime {
+				t.Errorf("run() took %v, want at least %v", elapsed, tt.minTime)
+			}
+
+			r, err := capture.OpenDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			for i, event := range generated {
+				record, err := r.Next()
+				if err != nil {
+					t.Fatalf("record %d: %v", i, err)
+				}
+				if record.Topic != "group2" || record.Offset != int64(i) || string(record.Key) != event.Experiment || !record.Time.Equal(event.Time) {
+					t.Errorf("record %d on %s offset %d key %s time %v", i, record.Topic, record.Offset, record.Key, record.Time)
+				}
+			}
+			if _, err := r.Next(); err != io.EOF {
+				t.Errorf("%v after the generated events, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestProducerOutputErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       producer
+		wantErr string
+	}{
+		{"unknown output", producer{output: "file"}, "unknown output"},
+		{"capture without a directory", producer{output: "capture"}, "-capture-dir"},
+		{"kafka without brokers", producer{output: "kafka", kafkaCfg: &config.KafkaConfig{}}, "broker"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.run(generate(t, time.Now()))
+			if err == nil || !strings.Contains(strings.ToLower(err.Error()), tt.wantErr) {
+				t.Errorf("run() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Command redrive publishes dead-lettered messages again, either from the
+// consumer's quarantine directory or from its dead-letter topic.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"assignment2/config"
+	"assignment2/deadletter"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func main() {
+	var kafkaCfg config.KafkaConfig
+	kafkaCfg.RegisterFlags(flag.CommandLine)
+	fromDir := flag.String("from-dir", "", "Quarantine directory to re-drive")
+	fromTopic := flag.String("from-topic", "", "Dead-letter topic to re-drive")
+	group := flag.String("group", "redrive", "Consumer group used to read the dead-letter topic")
+	toTopic := flag.String("to-topic", "", "Topic to publish to, defaults to each message's original topic")
+	idle := flag.Duration("idle", 10*time.Second, "Stop reading the dead-letter topic after this long without messages")
+	dryRun := flag.Bool("dry-run", false, "List the entries without publishing them")
+	flag.Parse()
+
+	if (*fromDir == "") == (*fromTopic == "") {
+		log.Fatal("Exactly one of -from-dir or -from-topic is required")
+	}
+	if err := kafkaCfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	writer, err := kafkaCfg.Writer("")
+	if err != nil {
+		log.Fatalf("Failed to configure Kafka connection: %v", err)
+	}
+	defer writer.Close()
+
+	rd := &redriver{writer: writer, toTopic: *toTopic, dryRun: *dryRun}
+
+	var count int
+	if *fromDir != "" {
+		count, err = rd.fromDir(ctx, *fromDir)
+	} else {
+		count, err = rd.fromTopic(ctx, &kafkaCfg, *fromTopic, *group, *idle)
+	}
+	log.Printf("Re-drove %d messages", count)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// messageWriter is the part of *kafka.Writer the redriver uses
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// redriver publishes dead-letter entries back to their topic
+type redriver struct {
+	writer  messageWriter
+	toTopic string
+	dryRun  bool
+}
+
+func (rd *redriver) publish(ctx context.Context, entry deadletter.Entry) error {
+	msg := entry.Message()
+	msg.Topic = entry.Topic
+	if rd.toTopic != "" {
+		msg.Topic = rd.toTopic
+	}
+
+	log.Printf("%s partition %d offset %d -> %s (failed with: %s)",
+		entry.Topic, entry.Partition, entry.Offset, msg.Topic, entry.Error)
+	if rd.dryRun {
+		return nil
+	}
+	return rd.writer.WriteMessages(ctx, msg)
+}
+
+// fromDir re-drives every quarantined file and moves it to a redriven
+// subdirectory once it was published
+func (rd *redriver) fromDir(ctx context.Context, dir string) (int, error) {
+	store, err := deadletter.NewDirStore(dir)
+	if err != nil {
+		return 0, err
+	}
+	paths, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	done := filepath.Join(dir, "redriven")
+	if !rd.dryRun {
+		if err := os.MkdirAll(done, 0o755); err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	for _, path := range paths {
+		entry, err := deadletter.ReadEntry(path)
+		if err != nil {
+			return count, err
+		}
+		if err := rd.publish(ctx, entry); err != nil {
+			return count, err
+		}
+		if !rd.dryRun {
+			if err := os.Rename(path, filepath.Join(done, filepath.Base(path))); err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+	return count, nil
+}
+
+// fromTopic re-drives the dead-letter topic until it has been idle for the
+// given duration. Offsets are committed after each message is published.
+func (rd *redriver) fromTopic(ctx context.Context, cfg *config.KafkaConfig, topic, group string, idle time.Duration) (int, error) {
+	dialer, err := cfg.Dialer()
+	if err != nil {
+		return 0, err
+	}
+
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cfg.Brokers,
+		Topic:       topic,
+		GroupID:     group,
+		StartOffset: kafka.FirstOffset,
+		Dialer:      dialer,
+	})
+	defer r.Close()
+
+	count := 0
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, idle)
+		msg, err := r.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return count, nil
+			}
+			return count, err
+		}
+
+		entry, err := deadletter.EntryFromMessage(msg)
+		if err != nil {
+			return count, err
+		}
+		if err := rd.publish(ctx, entry); err != nil {
+			return count, err
+		}
+		if !rd.dryRun {
+			if err := r.CommitMessages(ctx, msg); err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+}
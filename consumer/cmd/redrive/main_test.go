@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"assignment2/deadletter"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// published records the messages written to it, failing once fail is set
+type published struct {
+	msgs []kafka.Message
+	fail error
+}
+
+func (p *published) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if p.fail != nil {
+		return p.fail
+	}
+	p.msgs = append(p.msgs, msgs...)
+	return nil
+}
+
+func quarantine(t *testing.T, offsets ...int64) string {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := deadletter.NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range offsets {
+		entry := deadletter.NewEntry(kafka.Message{
+			Topic:   "group2",
+			Offset:  offset,
+			Key:     []byte("exp"),
+			Value:   []byte{byte(offset)},
+			Headers: []kafka.Header{{Key: "trace", Value: []byte("abc")}},
+			Time:    time.Unix(1700000000, 0),
+		}, errors.New("decode failed"))
+		if err := store.Put(context.Background(), entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRedriveFromDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		toTopic   string
+		dryRun    bool
+		wantTopic string
+		published int
+		left      int
+	}{
+		{"original topic", "", false, "group2", 2, 0},
+		{"other topic", "group2-retry", false, "group2-retry", 2, 0},
+		{"dry run", "", true, "", 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := quarantine(t, 1, 2)
+			w := &published{}
+			rd := &redriver{writer: w, toTopic: tt.toTopic, dryRun: tt.dryRun}
+
+			count, err := rd.fromDir(context.Background(), dir)
+			if err != nil || count != 2 {
+				t.Fatalf("fromDir() = %d, %v, want 2", count, err)
+			}
+			if len(w.msgs) != tt.published {
+				t.Fatalf("published %d messages, want %d", len(w.msgs), tt.published)
+			}
+			for i, msg := range w.msgs {
+				want := kafka.Message{
+					Topic:   tt.wantTopic,
+					Key:     []byte("exp"),
+					Value:   []byte{byte(i + 1)},
+					Headers: []kafka.Header{{Key: "trace", Value: []byte("abc")}},
+				}
+				if !reflect.DeepEqual(msg, want) {
+					t.Errorf("published %+v, want %+v", msg, want)
+				}
+			}
+			left, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+			if len(left) != tt.left {
+				t.Errorf("%d entries left in quarantine, want %d", len(left), tt.left)
+			}
+		})
+	}
+}
+
+func TestRedriveFromDirKeepsFailedEntries(t *testing.T) {
+	dir := quarantine(t, 1, 2)
+	rd := &redriver{writer: &published{fail: errors.New("broker down")}}
+
+	if count, err := rd.fromDir(context.Background(), dir); err == nil || count != 0 {
+		t.Errorf("fromDir() = %d, %v, want a failure", count, err)
+	}
+	left, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	redriven, _ := os.ReadDir(filepath.Join(dir, "redriven"))
+	if len(left) != 2 || len(redriven) != 0 {
+		t.Errorf("%d entries left and %d moved, want all left", len(left), len(redriven))
+	}
+}
@@ -0,0 +1,511 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// Default brokers of the course Kafka cluster
+const defaultBrokers = "kafka1.dlandau.nl:19092,kafka2.dlandau.nl:29092,kafka3.dlandau.nl:39092"
+
+// minGroupTimeout is the shortest group timeout, groups are checked for
+// expiry every quarter of it
+const minGroupTimeout = 4 * time.Millisecond
+
+// Config holds the consumer configuration. Every field can be set by a
+// command line flag, which defaults to the matching environment variable.
+type Config struct {
+	KafkaConfig
+
+	// Source selects the input: kafka, dir (raw OCF files), log (text dump)
+	// or capture (recorder output). SourcePath is the directory or log file
+	// for the file sources.
+	Source       string
+	SourcePath   string
+	ReplayTiming string
+
+	// RecordDir receives a capture of every message as received
+	RecordDir      string
+	RecordMaxBytes int64
+
+	// Topics are consumed together, or every topic matching TopicPattern
+	// when it is set. File sources present their messages as Topics[0].
+	Topics       []string
+	TopicPattern *regexp.Regexp
+	GroupID      string
+
+	// Workers is the number of messages handled in parallel, each with a
+	// queue of WorkerQueueSize messages
+	Workers         int
+	WorkerQueueSize int
+
+	// StartOffset is where a group without committed offsets starts: latest or earliest
+	StartOffset string
+	// StartPosition resets the group's offsets before consuming, see
+	// source.ParsePosition. OneShot stops at the high-water marks of the start.
+	StartPosition string
+	OneShot       bool
+
+	// DeadLetterTopic and QuarantineDir receive messages that cannot be processed
+	DeadLetterTopic string
+	QuarantineDir   string
+
+	// HashPolicy, HashAlgorithm and HashKey configure measurement hash
+	// verification, TamperQuarantineDir receives readings that fail it
+	HashPolicy          string
+	HashAlgorithm       string
+	HashKey             []byte
+	TamperQuarantineDir string
+
+	// GroupTimeout is how long a measurement group waits for missing sensors
+	// before it is emitted as partial
+	GroupTimeout time.Duration
+
+	// AllowedLateness, LateRetention, LatePolicy and LateDir configure event
+	// time processing of measurements
+	AllowedLateness time.Duration
+	LateRetention   time.Duration
+	LatePolicy      string
+	LateDir         string
+
+	// DedupCacheSize is how many reading keys are remembered in memory,
+	// DedupDurable also checks and records them in postgres_service
+	DedupCacheSize int
+	DedupDurable   bool
+
+	// Sinks are kind:target specs receiving every decoded event, see
+	// sink.Open. Forward sends events to the downstream services.
+	Sinks   []string
+	Forward bool
+
+	PostgresServiceURL string
+	AvgCalcServiceURL  string
+
+	// MetricsAddr is where /metrics is served, empty to disable
+	MetricsAddr string
+
+	// ShutdownTimeout bounds draining after SIGTERM or SIGINT
+	ShutdownTimeout time.Duration
+}
+
+// KafkaConfig holds how to reach the brokers. It is shared by every command
+// that talks to the cluster.
+type KafkaConfig struct {
+	Brokers []string
+	TLS     TLSConfig
+	SASL    SASLConfig
+
+	brokerList string
+}
+
+// TLSConfig holds the TLS material used to connect to the brokers
+type TLSConfig struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// SASLConfig holds the SASL credentials used to authenticate to the brokers,
+// on top of or instead of a TLS client certificate
+type SASLConfig struct {
+	// Mechanism is plain, scram-sha-256 or scram-sha-512, empty disables SASL
+	Mechanism    string
+	Username     string
+	Password     string
+	PasswordFile string
+}
+
+// Load parses the consumer configuration from args (without the program
+// name) and the environment. The topic and consumer group may also be given
+// as the two positional arguments.
+func Load(args []string) (*Config, error) {
+	cfg := &Config{}
+	fs := flag.NewFlagSet("consumer", flag.ContinueOnError)
+
+	cfg.KafkaConfig.RegisterFlags(fs)
+	fs.StringVar(&cfg.Source, "source", getEnv("CONSUMER_SOURCE", "kafka"), "Input to consume: kafka, dir, log or capture (env CONSUMER_SOURCE)")
+	fs.StringVar(&cfg.SourcePath, "source-path", getEnv("CONSUMER_SOURCE_PATH", ""), "Directory of OCF files, log file or capture directory to replay (env CONSUMER_SOURCE_PATH)")
+	fs.StringVar(&cfg.ReplayTiming, "replay-timing", getEnv("REPLAY_TIMING", "fast"), "Replay timing for file sources: fast or original (env REPLAY_TIMING)")
+	fs.StringVar(&cfg.RecordDir, "record", getEnv("RECORD_DIR", ""), "Directory to capture every received message to (env RECORD_DIR)")
+	fs.Int64Var(&cfg.RecordMaxBytes, "record-max-bytes", getEnvInt64("RECORD_MAX_BYTES", 64<<20), "Uncompressed size after which a new capture file is started (env RECORD_MAX_BYTES)")
+	var topicList, topicPattern string
+	fs.StringVar(&topicList, "topic", getEnv("KAFKA_TOPIC", ""), "Comma separated list of Kafka topics to consume (env KAFKA_TOPIC)")
+	fs.StringVar(&topicPattern, "topic-pattern", getEnv("KAFKA_TOPIC_PATTERN", ""), "Consume every topic matching this regular expression instead (env KAFKA_TOPIC_PATTERN)")
+	fs.StringVar(&cfg.GroupID, "group", getEnv("KAFKA_GROUP_ID", ""), "Kafka consumer group (env KAFKA_GROUP_ID)")
+	fs.IntVar(&cfg.Workers, "workers", int(getEnvInt64("CONSUMER_WORKERS", int64(runtime.NumCPU()))), "Number of workers handling messages in parallel, one experiment always uses the same worker (env CONSUMER_WORKERS)")
+	fs.IntVar(&cfg.WorkerQueueSize, "worker-queue-size", int(getEnvInt64("WORKER_QUEUE_SIZE", 64)), "Messages queued per worker before fetching blocks (env WORKER_QUEUE_SIZE)")
+	fs.StringVar(&cfg.StartOffset, "start-offset", getEnv("KAFKA_START_OFFSET", "latest"), "Start offset for a new consumer group: latest or earliest (env KAFKA_START_OFFSET)")
+	fs.StringVar(&cfg.StartPosition, "start-position", getEnv("KAFKA_START_POSITION", "committed"), "Reset the group before consuming to: committed, earliest, latest, an RFC 3339 time, a duration ago or partition:offset pairs (env KAFKA_START_POSITION)")
+	fs.BoolVar(&cfg.OneShot, "one-shot", getEnvBool("CONSUMER_ONE_SHOT", false), "Stop once the high-water marks of the start are reached (env CONSUMER_ONE_SHOT)")
+
+	fs.StringVar(&cfg.DeadLetterTopic, "dead-letter-topic", getEnv("DEAD_LETTER_TOPIC", ""), "Topic that receives messages which cannot be processed (env DEAD_LETTER_TOPIC)")
+	fs.StringVar(&cfg.QuarantineDir, "quarantine-dir", getEnv("QUARANTINE_DIR", ""), "Directory that receives messages which cannot be processed (env QUARANTINE_DIR)")
+
+	var hashKey, hashKeyFile string
+	fs.StringVar(&cfg.HashPolicy, "hash-policy", getEnv("MEASUREMENT_HASH_POLICY", "off"), "What to do with measurements failing hash verification: off, mark or reject (env MEASUREMENT_HASH_POLICY)")
+	fs.StringVar(&cfg.HashAlgorithm, "hash-algorithm", getEnv("MEASUREMENT_HASH_ALGORITHM", "aes-gcm"), "Measurement hash algorithm (env MEASUREMENT_HASH_ALGORITHM)")
+	fs.StringVar(&hashKey, "hash-key", getEnv("MEASUREMENT_HASH_KEY", ""), "Base64 encoded measurement hash key (env MEASUREMENT_HASH_KEY)")
+	fs.StringVar(&hashKeyFile, "hash-key-file", getEnv("MEASUREMENT_HASH_KEY_FILE", ""), "File holding the base64 encoded measurement hash key (env MEASUREMENT_HASH_KEY_FILE)")
+	fs.StringVar(&cfg.TamperQuarantineDir, "tamper-quarantine-dir", getEnv("TAMPER_QUARANTINE_DIR", ""), "Directory that receives measurements failing hash verification (env TAMPER_QUARANTINE_DIR)")
+
+	fs.DurationVar(&cfg.GroupTimeout, "group-timeout", getEnvDuration("MEASUREMENT_GROUP_TIMEOUT", 5*time.Second), "Time to wait for all sensors of a measurement before emitting a partial group (env MEASUREMENT_GROUP_TIMEOUT)")
+	fs.DurationVar(&cfg.AllowedLateness, "allowed-lateness", getEnvDuration("ALLOWED_LATENESS", time.Second), "Measurement time a reading may trail its experiment's latest reading before it is late (env ALLOWED_LATENESS)")
+	fs.DurationVar(&cfg.LateRetention, "late-retention", getEnvDuration("LATE_RETENTION", time.Minute), "Measurement time emitted groups are kept to recognise and correct late readings (env LATE_RETENTION)")
+	fs.StringVar(&cfg.LatePolicy, "late-policy", getEnv("LATE_POLICY", "drop"), "What to do with late readings: drop, side-output or reemit (env LATE_POLICY)")
+	fs.StringVar(&cfg.LateDir, "late-dir", getEnv("LATE_DIR", ""), "Directory that receives late readings with -late-policy side-output (env LATE_DIR)")
+	fs.IntVar(&cfg.DedupCacheSize, "dedup-cache-size", int(getEnvInt64("DEDUP_CACHE_SIZE", 100000)), "Number of forwarded reading keys remembered in memory (env DEDUP_CACHE_SIZE)")
+	fs.BoolVar(&cfg.DedupDurable, "dedup-durable", getEnvBool("DEDUP_DURABLE", true), "Also check and record forwarded readings in postgres_service (env DEDUP_DURABLE)")
+
+	var sinkList string
+	fs.StringVar(&sinkList, "sink", getEnv("SINKS", ""), "Comma separated sinks receiving every decoded event: ndjson:-, ndjson:<file>, csv:<dir> or ocf:<dir> (env SINKS)")
+	fs.BoolVar(&cfg.Forward, "forward", getEnvBool("FORWARD", true), "Forward events to postgres_service and average_calc_service (env FORWARD)")
+	fs.StringVar(&cfg.PostgresServiceURL, "postgres-service-url", getEnv("POSTGRES_SERVICE_URL", "http://localhost:8080"), "Base URL of postgres_service (env POSTGRES_SERVICE_URL)")
+	fs.StringVar(&cfg.AvgCalcServiceURL, "avg-calc-service-url", getEnv("AVG_CALC_SERVICE_URL", "http://localhost:8081"), "Base URL of average_calc_service (env AVG_CALC_SERVICE_URL)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second), "Time to finish in-flight messages, flush groups and commit after a shutdown signal (env SHUTDOWN_TIMEOUT)")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", getEnv("METRICS_ADDR", ":2112"), "Address to serve Prometheus metrics on, empty to disable (env METRICS_ADDR)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Positional arguments keep the original "<topic> <consumer_group>" usage working
+	if rest := fs.Args(); len(rest) > 0 {
+		topicList = rest[0]
+		if len(rest) > 1 {
+			cfg.GroupID = rest[1]
+		}
+	}
+	cfg.Topics = splitList(topicList)
+	cfg.Sinks = splitList(sinkList)
+
+	if topicPattern != "" {
+		pattern, err := regexp.Compile(topicPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid topic pattern: %w", err)
+		}
+		cfg.TopicPattern = pattern
+	}
+
+	if hashKeyFile != "" {
+		data, err := os.ReadFile(hashKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read hash key: %w", err)
+		}
+		hashKey = string(data)
+	}
+	if hashKey != "" {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(hashKey))
+		if err != nil {
+			return nil, fmt.Errorf("hash key is not valid base64: %w", err)
+		}
+		cfg.HashKey = key
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	switch c.Source {
+	case "kafka":
+		if len(c.Topics) == 0 && c.TopicPattern == nil {
+			return fmt.Errorf("no topic or topic pattern given")
+		}
+		if len(c.Topics) > 0 && c.TopicPattern != nil {
+			return fmt.Errorf("give either topics or a topic pattern")
+		}
+		if c.GroupID == "" {
+			return fmt.Errorf("no consumer group given")
+		}
+	case "dir", "log", "capture":
+		if c.StartPosition != "committed" || c.OneShot {
+			return fmt.Errorf("-start-position and -one-shot only apply to the kafka source")
+		}
+		if c.SourcePath == "" {
+			return fmt.Errorf("source %s requires -source-path", c.Source)
+		}
+		if len(c.Topics) > 1 || c.TopicPattern != nil {
+			return fmt.Errorf("source %s takes a single topic name", c.Source)
+		}
+		if len(c.Topics) == 0 {
+			c.Topics = []string{"replay"}
+		}
+	default:
+		return fmt.Errorf("unknown source %q, expected kafka, dir, log or capture", c.Source)
+	}
+	if !c.Forward && len(c.Sinks) == 0 {
+		return fmt.Errorf("-forward=false requires at least one -sink")
+	}
+	if c.Workers <= 0 || c.WorkerQueueSize <= 0 {
+		return fmt.Errorf("workers and worker queue size must be positive")
+	}
+	if c.ReplayTiming != "fast" && c.ReplayTiming != "original" {
+		return fmt.Errorf("unknown replay timing %q, expected fast or original", c.ReplayTiming)
+	}
+	// Brokers are also needed by file sources when dead-lettering to a topic
+	if err := c.KafkaConfig.Validate(); err != nil {
+		return err
+	}
+	if _, err := c.KafkaStartOffset(); err != nil {
+		return err
+	}
+	if c.HashPolicy != "off" && len(c.HashKey) == 0 {
+		return fmt.Errorf("hash policy %s requires a hash key", c.HashPolicy)
+	}
+	if c.GroupTimeout < minGroupTimeout {
+		return fmt.Errorf("group timeout must be at least %v", minGroupTimeout)
+	}
+	if c.AllowedLateness < 0 || c.LateRetention < c.AllowedLateness {
+		return fmt.Errorf("allowed lateness must not be negative or exceed the late retention")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown timeout must be positive")
+	}
+	if c.DedupCacheSize <= 0 {
+		return fmt.Errorf("dedup cache size must be positive")
+	}
+	return nil
+}
+
+// RegisterFlags adds the broker, TLS and SASL flags to fs
+func (k *KafkaConfig) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&k.brokerList, "brokers", getEnv("KAFKA_BROKERS", defaultBrokers), "Comma separated list of brokers (env KAFKA_BROKERS)")
+
+	fs.BoolVar(&k.TLS.Enabled, "tls", getEnvBool("KAFKA_TLS", true), "Connect to the brokers over TLS (env KAFKA_TLS)")
+	fs.StringVar(&k.TLS.CAFile, "tls-ca", getEnv("KAFKA_TLS_CA", "auth/ca.crt"), "CA certificate file (env KAFKA_TLS_CA)")
+	fs.StringVar(&k.TLS.CertFile, "tls-cert", getEnv("KAFKA_TLS_CERT", "auth/kafka-cert.pem"), "Client certificate file, empty to disable client auth (env KAFKA_TLS_CERT)")
+	fs.StringVar(&k.TLS.KeyFile, "tls-key", getEnv("KAFKA_TLS_KEY", "auth/kafka-key.pem"), "Client key file (env KAFKA_TLS_KEY)")
+	fs.StringVar(&k.TLS.ServerName, "tls-server-name", getEnv("KAFKA_TLS_SERVER_NAME", ""), "Server name to verify broker certificates against (env KAFKA_TLS_SERVER_NAME)")
+	fs.BoolVar(&k.TLS.InsecureSkipVerify, "tls-insecure-skip-verify", getEnvBool("KAFKA_TLS_INSECURE_SKIP_VERIFY", false), "Do not verify broker certificates (env KAFKA_TLS_INSECURE_SKIP_VERIFY)")
+
+	fs.StringVar(&k.SASL.Mechanism, "sasl-mechanism", getEnv("KAFKA_SASL_MECHANISM", ""), "SASL mechanism: plain, scram-sha-256 or scram-sha-512, empty to disable SASL (env KAFKA_SASL_MECHANISM)")
+	fs.StringVar(&k.SASL.Username, "sasl-username", getEnv("KAFKA_SASL_USERNAME", ""), "SASL user name (env KAFKA_SASL_USERNAME)")
+	fs.StringVar(&k.SASL.Password, "sasl-password", getEnv("KAFKA_SASL_PASSWORD", ""), "SASL password (env KAFKA_SASL_PASSWORD)")
+	fs.StringVar(&k.SASL.PasswordFile, "sasl-password-file", getEnv("KAFKA_SASL_PASSWORD_FILE", ""), "File holding the SASL password (env KAFKA_SASL_PASSWORD_FILE)")
+}
+
+// Validate checks the parsed flags, fills in Brokers and reads the SASL
+// password file
+func (k *KafkaConfig) Validate() error {
+	k.Brokers = splitList(k.brokerList)
+	if len(k.Brokers) == 0 {
+		return fmt.Errorf("no brokers given")
+	}
+	if k.SASL.PasswordFile != "" {
+		data, err := os.ReadFile(k.SASL.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("failed to read SASL password: %w", err)
+		}
+		k.SASL.Password = strings.TrimRight(string(data), "\r\n")
+	}
+	if _, err := k.SASL.Build(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// KafkaStartOffset maps StartOffset to the kafka-go constant
+func (c *Config) KafkaStartOffset() (int64, error) {
+	switch strings.ToLower(c.StartOffset) {
+	case "latest", "last":
+		return kafka.LastOffset, nil
+	case "earliest", "first":
+		return kafka.FirstOffset, nil
+	default:
+		return 0, fmt.Errorf("unknown start offset %q, expected latest or earliest", c.StartOffset)
+	}
+}
+
+// Dialer builds the kafka dialer used by readers
+func (k *KafkaConfig) Dialer() (*kafka.Dialer, error) {
+	dialer := &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
+
+	if k.TLS.Enabled {
+		tlsConfig, err := k.TLS.Build()
+		if err != nil {
+			return nil, err
+		}
+		dialer.TLS = tlsConfig
+	}
+	mechanism, err := k.SASL.Build()
+	if err != nil {
+		return nil, err
+	}
+	dialer.SASLMechanism = mechanism
+	return dialer, nil
+}
+
+// Transport builds the kafka transport used by writers
+func (k *KafkaConfig) Transport() (*kafka.Transport, error) {
+	transport := &kafka.Transport{
+		DialTimeout: 10 * time.Second,
+	}
+
+	if k.TLS.Enabled {
+		tlsConfig, err := k.TLS.Build()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLS = tlsConfig
+	}
+	mechanism, err := k.SASL.Build()
+	if err != nil {
+		return nil, err
+	}
+	transport.SASL = mechanism
+	return transport, nil
+}
+
+// Client creates a client for the admin requests on the configured brokers
+func (k *KafkaConfig) Client() (*kafka.Client, error) {
+	transport, err := k.Transport()
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Client{
+		Addr:      kafka.TCP(k.Brokers...),
+		Timeout:   10 * time.Second,
+		Transport: transport,
+	}, nil
+}
+
+// Writer creates a writer producing to topic on the configured brokers
+func (k *KafkaConfig) Writer(topic string) (*kafka.Writer, error) {
+	transport, err := k.Transport()
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Writer{
+		Addr:         kafka.TCP(k.Brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Transport:    transport,
+	}, nil
+}
+
+// Build loads the configured certificates into a tls.Config. Broker
+// certificates are verified unless InsecureSkipVerify is set explicitly.
+func (t TLSConfig) Build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		caCert, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse CA certificate %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// Build creates the configured SASL mechanism, nil if SASL is disabled
+func (s SASLConfig) Build() (sasl.Mechanism, error) {
+	if s.Mechanism == "" {
+		return nil, nil
+	}
+	if s.Username == "" || s.Password == "" {
+		return nil, fmt.Errorf("SASL %s requires a user name and password", s.Mechanism)
+	}
+
+	switch strings.ToLower(s.Mechanism) {
+	case "plain":
+		return plain.Mechanism{Username: s.Username, Password: s.Password}, nil
+	case "scram-sha-256":
+		return scramMechanism(scram.SHA256, s.Username, s.Password)
+	case "scram-sha-512":
+		return scramMechanism(scram.SHA512, s.Username, s.Password)
+	default:
+		return nil, fmt.Errorf("unknown SASL mechanism %q, expected plain, scram-sha-256 or scram-sha-512", s.Mechanism)
+	}
+}
+
+func scramMechanism(algo scram.Algorithm, username, password string) (sasl.Mechanism, error) {
+	mechanism, err := scram.Mechanism(algo, username, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up SASL SCRAM: %w", err)
+	}
+	return mechanism, nil
+}
+
+// splitList splits a comma separated list and drops empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnv returns environment variable or default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvBool returns a boolean environment variable or default value
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvDuration returns a duration environment variable or default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInt64 returns an integer environment variable or default value
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,304 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+func TestLoadGroupTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"5s", false},
+		{"4ms", false},
+		// A quarter of it would be a zero expiry interval
+		{"3ns", true},
+		{"0s", true},
+		{"-1s", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			_, err := Load([]string{"-group-timeout", tt.value, "group2", "consumers"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "group timeout") {
+				t.Errorf("Load() error = %v, want it to name the group timeout", err)
+			}
+		})
+	}
+}
+
+func TestSASLConfigBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     SASLConfig
+		want    string // mechanism name, empty for none
+		wantErr string
+	}{
+		{"disabled", SASLConfig{}, "", ""},
+		{"plain", SASLConfig{Mechanism: "plain", Username: "u", Password: "p"}, "PLAIN", ""},
+		{"scram-sha-256", SASLConfig{Mechanism: "SCRAM-SHA-256", Username: "u", Password: "p"}, "SCRAM-SHA-256", ""},
+		{"scram-sha-512", SASLConfig{Mechanism: "scram-sha-512", Username: "u", Password: "p"}, "SCRAM-SHA-512", ""},
+		{"unknown mechanism", SASLConfig{Mechanism: "gssapi", Username: "u", Password: "p"}, "", "unknown SASL mechanism"},
+		{"no user name", SASLConfig{Mechanism: "plain", Password: "p"}, "", "requires a user name and password"},
+		{"no password", SASLConfig{Mechanism: "scram-sha-256", Username: "u"}, "", "requires a user name and password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mechanism, err := tt.cfg.Build()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Build() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+			if tt.want == "" {
+				if mechanism != nil {
+					t.Errorf("Build() = %v, want no mechanism", mechanism)
+				}
+				return
+			}
+			if mechanism == nil || mechanism.Name() != tt.want {
+				t.Errorf("Build() = %v, want %s", mechanism, tt.want)
+			}
+		})
+	}
+}
+
+func TestKafkaConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	os.WriteFile(passwordFile, []byte("secret\r\n"), 0o644)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"defaults", nil, ""},
+		{"no brokers", []string{"-brokers", " , "}, "no brokers"},
+		{"password file", []string{"-sasl-mechanism", "plain", "-sasl-username", "u", "-sasl-password-file", passwordFile}, ""},
+		{"missing password file", []string{"-sasl-mechanism", "plain", "-sasl-username", "u", "-sasl-password-file", filepath.Join(dir, "missing")}, "failed to read SASL password"},
+		{"bad mechanism", []string{"-sasl-mechanism", "md5", "-sasl-username", "u", "-sasl-password", "p"}, "unknown SASL mechanism"},
+		{"missing credentials", []string{"-sasl-mechanism", "scram-sha-512"}, "requires a user name and password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var k KafkaConfig
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			k.RegisterFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			err := k.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() = %v", err)
+			}
+			if len(k.Brokers) == 0 {
+				t.Error("Validate() left no brokers")
+			}
+			if k.SASL.PasswordFile != "" && k.SASL.Password != "secret" {
+				t.Errorf("password %q read from the file, want it without the line ending", k.SASL.Password)
+			}
+		})
+	}
+}
+
+// writeCertificate writes a self-signed certificate and its key as PEM files
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestTLSConfigBuild(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir)
+	notPEM := filepath.Join(dir, "not.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0o644)
+
+	tests := []struct {
+		name    string
+		cfg     TLSConfig
+		wantErr string
+	}{
+		{"system roots", TLSConfig{ServerName: "kafka"}, ""},
+		{"CA and client certificate", TLSConfig{CAFile: certFile, CertFile: certFile, KeyFile: keyFile}, ""},
+		{"missing CA", TLSConfig{CAFile: filepath.Join(dir, "missing")}, "failed to read CA certificate"},
+		{"invalid CA", TLSConfig{CAFile: notPEM}, "failed to parse CA certificate"},
+		{"client certificate without key", TLSConfig{CertFile: certFile, KeyFile: notPEM}, "failed to load client certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := tt.cfg.Build()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Build() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build() = %v", err)
+			}
+			if tlsConfig.ServerName != tt.cfg.ServerName || (tt.cfg.CAFile != "") != (tlsConfig.RootCAs != nil) || (tt.cfg.CertFile != "") != (len(tlsConfig.Certificates) == 1) {
+				t.Errorf("Build() = %+v for %+v", tlsConfig, tt.cfg)
+			}
+			if tlsConfig.InsecureSkipVerify {
+				t.Error("Build() skips verification without being asked to")
+			}
+		})
+	}
+}
+
+func TestKafkaConfigTransportUsesSASL(t *testing.T) {
+	k := KafkaConfig{SASL: SASLConfig{Mechanism: "plain", Username: "u", Password: "p"}}
+	transport, err := k.Transport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := transport.SASL.(plain.Mechanism); !ok || transport.TLS != nil {
+		t.Errorf("transport with SASL %v and TLS %v, want plain without TLS", transport.SASL, transport.TLS)
+	}
+	dialer, err := k.Dialer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dialer.SASLMechanism.(plain.Mechanism); !ok {
+		t.Errorf("dialer with SASL %v, want plain", dialer.SASLMechanism)
+	}
+}
+
+func TestLoadMetricsAddr(t *testing.T) {
+	t.Setenv("METRICS_ADDR", ":9100")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, ":9100"},
+		{[]string{"-metrics-addr", "127.0.0.1:2112"}, "127.0.0.1:2112"},
+		// Disabled
+		{[]string{"-metrics-addr", ""}, ""},
+	}
+	for _, tt := range tests {
+		cfg, err := Load(append(tt.args, "group2", "consumers"))
+		if err != nil {
+			t.Fatalf("Load(%v) = %v", tt.args, err)
+		}
+		if cfg.MetricsAddr != tt.want {
+			t.Errorf("Load(%v) metrics address %q, want %q", tt.args, cfg.MetricsAddr, tt.want)
+		}
+	}
+}
+
+func TestLoadShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"30s", false},
+		{"1ms", false},
+		{"0s", true},
+		{"-5s", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cfg, err := Load([]string{"-shutdown-timeout", tt.value, "group2", "consumers"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.ShutdownTimeout.String() != tt.value {
+				t.Errorf("shutdown timeout %v, want %s", cfg.ShutdownTimeout, tt.value)
+			}
+		})
+	}
+}
+
+func TestLoadTopics(t *testing.T) {
+	t.Setenv("KAFKA_TOPIC", "")
+	t.Setenv("KAFKA_TOPIC_PATTERN", "")
+	tests := []struct {
+		name        string
+		args        []string
+		wantTopics  []string
+		wantPattern string
+		wantErr     string
+	}{
+		{"positional", []string{"group2", "consumers"}, []string{"group2"}, "", ""},
+		{"list", []string{"-topic", "group2, group3,", "-group", "consumers"}, []string{"group2", "group3"}, "", ""},
+		{"pattern", []string{"-topic-pattern", `^group\d+$`, "-group", "consumers"}, nil, `^group\d+$`, ""},
+		{"neither", []string{"-group", "consumers"}, nil, "", "no topic or topic pattern"},
+		{"both", []string{"-topic-pattern", "group.*", "group2", "consumers"}, nil, "", "either topics or a topic pattern"},
+		{"invalid pattern", []string{"-topic-pattern", "group(", "-group", "consumers"}, nil, "", "invalid topic pattern"},
+		{"replay default", []string{"-source", "log", "-source-path", "log.txt"}, []string{"replay"}, "", ""},
+		{"replay topic", []string{"-source", "dir", "-source-path", "dir", "-topic", "group2"}, []string{"group2"}, "", ""},
+		{"replay of several topics", []string{"-source", "dir", "-source-path", "dir", "-topic", "group2,group3"}, nil, "", "single topic"},
+		{"replay of a pattern", []string{"-source", "capture", "-source-path", "dir", "-topic-pattern", "group.*"}, nil, "", "single topic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() = %v", err)
+			}
+			if !reflect.DeepEqual(cfg.Topics, tt.wantTopics) {
+				t.Errorf("topics %q, want %q", cfg.Topics, tt.wantTopics)
+			}
+			if pattern := cfg.TopicPattern; (pattern == nil) != (tt.wantPattern == "") || (pattern != nil && pattern.String() != tt.wantPattern) {
+				t.Errorf("pattern %v, want %q", pattern, tt.wantPattern)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers added to a message when it is published to the dead-letter topic
+const (
+	HeaderTopic     = "dlq.original.topic"
+	HeaderPartition = "dlq.original.partition"
+	HeaderOffset    = "dlq.original.offset"
+	HeaderTime      = "dlq.original.time"
+	HeaderError     = "dlq.error"
+	HeaderFailedAt  = "dlq.failed_at"
+)
+
+// Header is a single Kafka message header
+type Header struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Entry is a message that could not be processed, together with where it
+// came from and why it failed
+type Entry struct {
+	Topic     string    `json:"topic"`
+	Partition int       `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Key       []byte    `json:"key,omitempty"`
+	Value     []byte    `json:"value"`
+	Headers   []Header  `json:"headers,omitempty"`
+	Time      time.Time `json:"time"`
+	Error     string    `json:"error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// Store receives dead-lettered messages
+type Store interface {
+	Put(ctx context.Context, entry Entry) error
+	Close() error
+}
+
+// NewEntry builds the entry for a message that failed with err
+func NewEntry(msg kafka.Message, err error) Entry {
+	headers := make([]Header, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers = append(headers, Header{Key: h.Key, Value: h.Value})
+	}
+
+	return Entry{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   headers,
+		Time:      msg.Time,
+		Error:     err.Error(),
+		FailedAt:  time.Now().UTC(),
+	}
+}
+
+// Message returns the original message with its original headers, ready to
+// be produced again
+func (e Entry) Message() kafka.Message {
+	headers := make([]kafka.Header, 0, len(e.Headers))
+	for _, h := range e.Headers {
+		headers = append(headers, kafka.Header{Key: h.Key, Value: h.Value})
+	}
+	return kafka.Message{
+		Key:     e.Key,
+		Value:   e.Value,
+		Headers: headers,
+	}
+}
+
+// MultiStore writes every entry to all of its stores
+type MultiStore []Store
+
+// Put writes entry to every store and returns the joined errors
+func (m MultiStore) Put(ctx context.Context, entry Entry) error {
+	var errs []error
+	for _, store := range m {
+		if err := store.Put(ctx, entry); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every store
+func (m MultiStore) Close() error {
+	var errs []error
+	for _, store := range m {
+		errs = append(errs, store.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// TopicStore publishes entries to a dead-letter topic. The original key,
+// value and headers are kept, the origin and error are added as headers.
+type TopicStore struct {
+	writer *kafka.Writer
+}
+
+// NewTopicStore creates a store producing through writer
+func NewTopicStore(writer *kafka.Writer) *TopicStore {
+	return &TopicStore{writer: writer}
+}
+
+// Put publishes entry to the dead-letter topic
+func (s *TopicStore) Put(ctx context.Context, entry Entry) error {
+	if err := s.writer.WriteMessages(ctx, entry.deadLetter()); err != nil {
+		return fmt.Errorf("failed to publish to dead-letter topic %s: %w", s.writer.Topic, err)
+	}
+	return nil
+}
+
+// Close flushes and closes the writer
+func (s *TopicStore) Close() error {
+	return s.writer.Close()
+}
+
+// deadLetter returns the message published to the dead-letter topic, read
+// back by EntryFromMessage
+func (e Entry) deadLetter() kafka.Message {
+	msg := e.Message()
+	msg.Headers = append(msg.Headers,
+		kafka.Header{Key: HeaderTopic, Value: []byte(e.Topic)},
+		kafka.Header{Key: HeaderPartition, Value: []byte(strconv.Itoa(e.Partition))},
+		kafka.Header{Key: HeaderOffset, Value: []byte(strconv.FormatInt(e.Offset, 10))},
+		kafka.Header{Key: HeaderTime, Value: []byte(e.Time.Format(time.RFC3339Nano))},
+		kafka.Header{Key: HeaderError, Value: []byte(e.Error)},
+		kafka.Header{Key: HeaderFailedAt, Value: []byte(e.FailedAt.Format(time.RFC3339Nano))},
+	)
+	return msg
+}
+
+// EntryFromMessage restores an entry from a message read back from the
+// dead-letter topic
+func EntryFromMessage(msg kafka.Message) (Entry, error) {
+	entry := Entry{
+		Key:   msg.Key,
+		Value: msg.Value,
+	}
+
+	seen := map[string]bool{}
+	for _, h := range msg.Headers {
+		value := string(h.Value)
+		switch h.Key {
+		case HeaderTopic:
+			entry.Topic = value
+		case HeaderPartition:
+			partition, err := strconv.Atoi(value)
+			if err != nil {
+				return entry, fmt.Errorf("invalid %s header: %w", h.Key, err)
+			}
+			entry.Partition = partition
+		case HeaderOffset:
+			offset, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return entry, fmt.Errorf("invalid %s header: %w", h.Key, err)
+			}
+			entry.Offset = offset
+		case HeaderTime:
+			entry.Time, _ = time.Parse(time.RFC3339Nano, value)
+		case HeaderError:
+			entry.Error = value
+		case HeaderFailedAt:
+			entry.FailedAt, _ = time.Parse(time.RFC3339Nano, value)
+		default:
+			entry.Headers = append(entry.Headers, Header{Key: h.Key, Value: h.Value})
+			continue
+		}
+		seen[h.Key] = true
+	}
+
+	if !seen[HeaderTopic] || !seen[HeaderOffset] {
+		return entry, fmt.Errorf("message at partition %d offset %d is not a dead-letter entry", msg.Partition, msg.Offset)
+	}
+	return entry, nil
+}
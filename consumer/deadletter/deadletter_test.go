@@ -0,0 +1,146 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func failed() Entry {
+	msg := kafka.Message{
+		Topic:     "group2",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("exp"),
+		Value:     []byte{0, 1, 2},
+		Headers:   []kafka.Header{{Key: "trace", Value: []byte("abc")}},
+		Time:      time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC),
+	}
+	entry := NewEntry(msg, errors.New("decode failed"))
+	entry.FailedAt = time.Date(2024, 5, 1, 12, 1, 0, 0, time.UTC)
+	return entry
+}
+
+func TestEntryFromMessageRoundTrip(t *testing.T) {
+	entry := failed()
+	got, err := EntryFromMessage(entry.deadLetter())
+	if err != nil {
+		t.Fatalf("EntryFromMessage() = %v", err)
+	}
+	if !reflect.DeepEqual(got, entry) {
+		t.Errorf("read back %+v, want %+v", got, entry)
+	}
+	// Re-driven messages carry the original headers only
+	if msg := got.Message(); len(msg.Headers) != 1 || msg.Headers[0].Key != "trace" {
+		t.Errorf("re-driven headers %v, want the original trace header", msg.Headers)
+	}
+}
+
+func TestEntryFromMessageErrors(t *testing.T) {
+	without := func(key string) kafka.Message {
+		msg := failed().deadLetter()
+		var headers []kafka.Header
+		for _, h := range msg.Headers {
+			if h.Key != key {
+				headers = append(headers, h)
+			}
+		}
+		msg.Headers = headers
+		return msg
+	}
+	replaced := func(key, value string) kafka.Message {
+		msg := failed().deadLetter()
+		for i := range msg.Headers {
+			if msg.Headers[i].Key == key {
+				msg.Headers[i].Value = []byte(value)
+			}
+		}
+		return msg
+	}
+
+	tests := []struct {
+		name    string
+		msg     kafka.Message
+		wantErr string
+	}{
+		{"not a dead-letter message", kafka.Message{Value: []byte("x")}, "not a dead-letter entry"},
+		{"missing topic", without(HeaderTopic), "not a dead-letter entry"},
+		{"missing offset", without(HeaderOffset), "not a dead-letter entry"},
+		{"invalid partition", replaced(HeaderPartition, "three"), HeaderPartition},
+		{"invalid offset", replaced(HeaderOffset, "-"), HeaderOffset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := EntryFromMessage(tt.msg); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("EntryFromMessage() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Times are informational, an entry without them is still re-driven
+	entry, err := EntryFromMessage(without(HeaderTime))
+	if err != nil || !entry.Time.IsZero() {
+		t.Errorf("EntryFromMessage() without a time = %+v, %v", entry, err)
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "quarantine")
+	store, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	second, first := failed(), failed()
+	second.Offset = 43
+	for _, entry := range []Entry{second, first} {
+		if err := store.Put(ctx, entry); err != nil {
+			t.Fatalf("Put() = %v", err)
+		}
+	}
+	// Left behind by a crash
+	os.WriteFile(filepath.Join(dir, "group2-3-44.json.tmp"), []byte("{"), 0o644)
+
+	paths, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("listed %v, want the 2 entries", paths)
+	}
+	for i, want := range []Entry{first, second} {
+		got, err := ReadEntry(paths[i])
+		if err != nil {
+			t.Fatalf("ReadEntry() = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("entry %d is %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+type failingStore struct{ err error }
+
+func (s failingStore) Put(ctx context.Context, entry Entry) error { return s.err }
+func (s failingStore) Close() error                               { return nil }
+
+func TestMultiStoreWritesEveryStore(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewDirStore(dir)
+	down := errors.New("broker down")
+	m := MultiStore{failingStore{down}, store}
+
+	if err := m.Put(context.Background(), failed()); !errors.Is(err, down) {
+		t.Errorf("Put() = %v, want the failing store's error", err)
+	}
+	if paths, _ := store.List(); len(paths) != 1 {
+		t.Errorf("%d entries quarantined after another store failed, want 1", len(paths))
+	}
+}
@@ -0,0 +1,79 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DirStore quarantines entries as JSON files in a local directory, one file
+// per message
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore creates the quarantine directory if needed
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// Put writes entry to <topic>-<partition>-<offset>.json. The file is written
+// to a temporary name first so a crash never leaves a partial entry behind.
+func (s *DirStore) Put(ctx context.Context, entry Entry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal entry: %w", err)
+	}
+
+	path := filepath.Join(s.dir, fmt.Sprintf("%s-%d-%d.json", entry.Topic, entry.Partition, entry.Offset))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	return nil
+}
+
+// Close is a no-op, every entry is written synchronously
+func (s *DirStore) Close() error {
+	return nil
+}
+
+// List returns the paths of all quarantined entries sorted by file name
+func (s *DirStore) List() ([]string, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantine directory: %w", err)
+	}
+
+	var paths []string
+	for _, e := range dirEntries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), ".json") {
+			paths = append(paths, filepath.Join(s.dir, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ReadEntry loads a quarantined entry from path
+func ReadEntry(path string) (Entry, error) {
+	var entry Entry
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entry, fmt.Errorf("failed to read quarantine file: %w", err)
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, fmt.Errorf("failed to parse quarantine file %s: %w", path, err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,62 @@
+package dedup
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is a bounded set of recently seen keys. The least recently used key
+// is evicted once the cache is full.
+type Cache struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List // front is most recently used
+	items map[Key]*list.Element
+}
+
+// NewCache creates a cache holding at most size keys
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:  size,
+		order: list.New(),
+		items: make(map[Key]*list.Element, size),
+	}
+}
+
+// Contains reports whether key was added and marks it as recently used
+func (c *Cache) Contains(key Key) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if ok {
+		c.order.MoveToFront(elem)
+	}
+	return ok
+}
+
+// Add inserts key, evicting the least recently used key if needed
+func (c *Cache) Add(key Key) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(key)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(Key))
+	}
+}
+
+// Len returns the number of cached keys
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
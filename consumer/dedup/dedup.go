@@ -0,0 +1,185 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"assignment2/aggregate"
+	"assignment2/forward"
+)
+
+// Key identifies a single reading
+type Key struct {
+	ExperimentID  string `json:"experiment_id"`
+	SensorID      string `json:"sensor_id"`
+	MeasurementID string `json:"measurement_id"`
+}
+
+// Store is the durable record of readings that were already forwarded
+type Store interface {
+	// Claim records keys as forwarded and returns the ones that were not
+	// claimed before
+	Claim(ctx context.Context, keys []Key) ([]Key, error)
+}
+
+// Filter drops readings from measurement groups that were already
+// forwarded, so a redelivered reading never reaches the averages twice.
+// Keys are checked against the in-memory cache first and claimed in the
+// durable store before forwarding, only the readings whose claim succeeded
+// are forwarded: two consumers handling the same redelivered reading cannot
+// both send it. A failed claim is returned so the group is retried. Keys
+// this filter claimed stay its own until their group is forwarded, so a
+// retried forward is not dropped as a duplicate.
+// A corrected group (Revision above 0) is only dropped if it adds nothing.
+type Filter struct {
+	cache *Cache
+	store Store
+	next  aggregate.EmitFunc
+
+	mu sync.Mutex
+	// owned holds keys claimed by this filter whose group was not forwarded
+	// yet
+	owned map[Key]bool
+
+	duplicates atomic.Int64
+}
+
+// NewFilter creates a filter in front of next. store may be nil to only
+// deduplicate against the cache.
+func NewFilter(cache *Cache, store Store, next aggregate.EmitFunc) *Filter {
+	return &Filter{
+		cache: cache,
+		store: store,
+		next:  next,
+		owned: make(map[Key]bool),
+	}
+}
+
+// Duplicates returns the number of readings dropped as duplicates
+func (f *Filter) Duplicates() int64 {
+	return f.duplicates.Load()
+}
+
+// Emit claims the readings of group that were not forwarded yet, forwards
+// them and drops the rest
+func (f *Filter) Emit(ctx context.Context, group aggregate.Group) error {
+	keys := make([]Key, len(group.Readings))
+	seen := make(map[Key]bool)
+	var unknown []Key
+	for i, reading := range group.Readings {
+		keys[i] = Key{ExperimentID: group.ExperimentID, SensorID: reading.Sensor, MeasurementID: group.MeasurementID}
+		if f.cache.Contains(keys[i]) {
+			seen[keys[i]] = true
+		} else {
+			unknown = append(unknown, keys[i])
+		}
+	}
+
+	if f.store != nil {
+		if err := f.claim(ctx, unknown, seen); err != nil {
+			return fmt.Errorf("failed to claim measurement keys: %w", err)
+		}
+	}
+
+	fresh := group
+	fresh.Readings = nil
+	var forwarded []Key
+	for i, reading := range group.Readings {
+		if seen[keys[i]] {
+			f.duplicates.Add(1)
+			continue
+		}
+		fresh.Readings = append(fresh.Readings, reading)
+		forwarded = append(forwarded, keys[i])
+	}
+
+	if len(fresh.Readings) == 0 {
+		log.Printf("Dropped duplicate measurement group %s of experiment %s", group.MeasurementID, group.ExperimentID)
+		return nil
+	}
+	if group.Revision > 0 {
+		// A correction replaces the earlier revisions downstream, so it
+		// keeps the readings those already carried
+		f.duplicates.Add(int64(len(fresh.Readings) - len(group.Readings)))
+		fresh = group
+	} else if len(fresh.Readings) < len(group.Readings) {
+		fresh.Partial = true
+	}
+
+	if err := f.next(ctx, fresh); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range forwarded {
+		f.cache.Add(key)
+		delete(f.owned, key)
+	}
+	return nil
+}
+
+// claim claims the keys this filter does not own yet and marks the ones
+// claimed before as seen
+func (f *Filter) claim(ctx context.Context, keys []Key, seen map[Key]bool) error {
+	f.mu.Lock()
+	var claims []Key
+	for _, key := range keys {
+		if !f.owned[key] {
+			claims = append(claims, key)
+		}
+	}
+	f.mu.Unlock()
+	if len(claims) == 0 {
+		return nil
+	}
+
+	claimed, err := f.store.Claim(ctx, claims)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range claimed {
+		f.owned[key] = true
+	}
+	for _, key := range claims {
+		if !f.owned[key] {
+			seen[key] = true
+			f.cache.Add(key)
+		}
+	}
+	return nil
+}
+
+// HTTPStore keeps the keys in Postgres through postgres_service
+type HTTPStore struct {
+	client *forward.Client
+}
+
+// NewHTTPStore creates a store backed by postgres_service
+func NewHTTPStore(client *forward.Client) *HTTPStore {
+	return &HTTPStore{client: client}
+}
+
+type keysRequest struct {
+	Keys []Key `json:"keys"`
+}
+
+type keysResponse struct {
+	Claimed []Key `json:"claimed"`
+}
+
+// Claim inserts the keys and returns the ones postgres_service did not
+// have yet
+func (s *HTTPStore) Claim(ctx context.Context, keys []Key) ([]Key, error) {
+	var resp keysResponse
+	if err := s.client.Call(ctx, "/measurement-keys", keysRequest{Keys: keys}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Claimed, nil
+}
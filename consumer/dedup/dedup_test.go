@@ -0,0 +1,236 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"assignment2/aggregate"
+)
+
+// memoryStore is a Store that records its calls
+type memoryStore struct {
+	claimed map[Key]bool
+	claims  [][]Key
+	fail    error
+}
+
+func (s *memoryStore) Claim(ctx context.Context, keys []Key) ([]Key, error) {
+	s.claims = append(s.claims, keys)
+	if s.fail != nil {
+		return nil, s.fail
+	}
+	var claimed []Key
+	for _, key := range keys {
+		if !s.claimed[key] {
+			s.claimed[key] = true
+			claimed = append(claimed, key)
+		}
+	}
+	return claimed, nil
+}
+
+func key(sensor string) Key {
+	return Key{ExperimentID: "exp", SensorID: sensor, MeasurementID: "m1"}
+}
+
+func group(revision int, sensors ...string) aggregate.Group {
+	g := aggregate.Group{ExperimentID: "exp", MeasurementID: "m1", Expected: 2, Revision: revision}
+	for _, sensor := range sensors {
+		g.Readings = append(g.Readings, aggregate.Reading{Sensor: sensor})
+	}
+	return g
+}
+
+func sensors(g aggregate.Group) []string {
+	var names []string
+	for _, reading := range g.Readings {
+		names = append(names, reading.Sensor)
+	}
+	return names
+}
+
+func TestFilterEmit(t *testing.T) {
+	tests := []struct {
+		name       string
+		cached     []Key
+		stored     []Key
+		group      aggregate.Group
+		want       []string // forwarded sensors, nil if the group is dropped
+		partial    bool
+		claims     []Key // keys the filter tried to claim
+		duplicates int64
+	}{
+		{
+			name:   "new group is forwarded and claimed",
+			group:  group(0, "a", "b"),
+			want:   []string{"a", "b"},
+			claims: []Key{key("a"), key("b")},
+		},
+		{
+			name:       "cached keys skip the store",
+			cached:     []Key{key("a")},
+			group:      group(0, "a", "b"),
+			want:       []string{"b"},
+			partial:    true,
+			claims:     []Key{key("b")},
+			duplicates: 1,
+		},
+		{
+			name:       "keys claimed before are dropped",
+			stored:     []Key{key("b")},
+			group:      group(0, "a", "b"),
+			want:       []string{"a"},
+			partial:    true,
+			claims:     []Key{key("a"), key("b")},
+			duplicates: 1,
+		},
+		{
+			name:       "fully forwarded group is dropped",
+			cached:     []Key{key("a"), key("b")},
+			group:      group(0, "a", "b"),
+			duplicates: 2,
+		},
+		{
+			name:   "correction keeps the readings already forwarded",
+			cached: []Key{key("a")},
+			group:  group(1, "a", "b"),
+			want:   []string{"a", "b"},
+			claims: []Key{key("b")},
+		},
+		{
+			name:       "correction adding nothing is dropped",
+			cached:     []Key{key("a"), key("b")},
+			group:      group(1, "a", "b"),
+			duplicates: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewCache(10)
+			for _, k := range tt.cached {
+				cache.Add(k)
+			}
+			store := &memoryStore{claimed: make(map[Key]bool)}
+			for _, k := range tt.stored {
+				store.claimed[k] = true
+			}
+			var forwarded []aggregate.Group
+			filter := NewFilter(cache, store, func(ctx context.Context, g aggregate.Group) error {
+				forwarded = append(forwarded, g)
+				return nil
+			})
+
+			if err := filter.Emit(context.Background(), tt.group); err != nil {
+				t.Fatalf("Emit() = %v", err)
+			}
+
+			switch {
+			case tt.want == nil && len(forwarded) > 0:
+				t.Errorf("forwarded %v, want the group dropped", sensors(forwarded[0]))
+			case tt.want != nil && len(forwarded) != 1:
+				t.Fatalf("forwarded %d groups, want 1", len(forwarded))
+			case tt.want != nil:
+				if got := sensors(forwarded[0]); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("forwarded %v, want %v", got, tt.want)
+				}
+				if forwarded[0].Partial != tt.partial {
+					t.Errorf("Partial = %v, want %v", forwarded[0].Partial, tt.partial)
+				}
+			}
+
+			var claims []Key
+			for _, keys := range store.claims {
+				claims = append(claims, keys...)
+			}
+			if !reflect.DeepEqual(claims, tt.claims) {
+				t.Errorf("claimed %v, want %v", claims, tt.claims)
+			}
+			if got := filter.Duplicates(); got != tt.duplicates {
+				t.Errorf("Duplicates() = %d, want %d", got, tt.duplicates)
+			}
+			if forwarded != nil {
+				for _, reading := range forwarded[0].Readings {
+					if !cache.Contains(key(reading.Sensor)) {
+						t.Errorf("forwarded reading of %s is not cached", reading.Sensor)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFilterFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		claim   error
+		forward error
+	}{
+		// The group is retried, nothing was forwarded or claimed
+		{"failed claim", errors.New("down"), nil},
+		// The keys are claimed but the retry still forwards them
+		{"failed forward", nil, errors.New("down")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStore{claimed: make(map[Key]bool), fail: tt.claim}
+			cache := NewCache(10)
+			var forwarded []aggregate.Group
+			failure := tt.forward
+			filter := NewFilter(cache, store, func(ctx context.Context, g aggregate.Group) error {
+				if failure != nil {
+					return failure
+				}
+				forwarded = append(forwarded, g)
+				return nil
+			})
+
+			if err := filter.Emit(context.Background(), group(0, "a", "b")); err == nil {
+				t.Fatal("Emit() succeeded, want the failure returned")
+			}
+			if len(forwarded) != 0 || cache.Contains(key("a")) {
+				t.Fatalf("failed group was forwarded or cached")
+			}
+
+			// The retry after the store or the service recovered
+			store.fail, failure = nil, nil
+			if err := filter.Emit(context.Background(), group(0, "a", "b")); err != nil {
+				t.Fatalf("retried Emit() = %v", err)
+			}
+			if len(forwarded) != 1 || len(forwarded[0].Readings) != 2 || forwarded[0].Partial {
+				t.Errorf("retry forwarded %v, want the whole group", forwarded)
+			}
+			if filter.Duplicates() != 0 {
+				t.Errorf("Duplicates() = %d, want 0", filter.Duplicates())
+			}
+
+			// Another consumer's redelivery is dropped
+			other := NewFilter(NewCache(10), store, func(ctx context.Context, g aggregate.Group) error {
+				t.Errorf("redelivered group %v forwarded twice", sensors(g))
+				return nil
+			})
+			if err := other.Emit(context.Background(), group(0, "a", "b")); err != nil {
+				t.Fatalf("redelivered Emit() = %v", err)
+			}
+		})
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCache(2)
+	cache.Add(key("a"))
+	cache.Add(key("b"))
+	cache.Contains(key("a"))
+	cache.Add(key("c"))
+
+	want := map[string]bool{"a": true, "b": false, "c": true}
+	for sensor, cached := range want {
+		if got := cache.Contains(key(sensor)); got != cached {
+			t.Errorf("Contains(%s) = %v, want %v", sensor, got, cached)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+}
@@ -0,0 +1,38 @@
+package events
+
+import "context"
+
+type topicKey struct{}
+
+// WithTopic returns a copy of ctx that carries the topic the events being
+// handled were consumed from
+func WithTopic(ctx context.Context, topic string) context.Context {
+	return context.WithValue(ctx, topicKey{}, topic)
+}
+
+// Topic returns the topic carried by ctx, or "" if there is none
+func Topic(ctx context.Context) string {
+	topic, _ := ctx.Value(topicKey{}).(string)
+	return topic
+}
+
+type holdKey struct{}
+
+// HoldFunc keeps the message the events being handled came from
+// uncommitted until the returned release function is called
+type HoldFunc func() (release func())
+
+// WithHold returns a copy of ctx that lets handlers hold the message of the
+// events being handled, for handlers that keep an event after returning
+func WithHold(ctx context.Context, hold HoldFunc) context.Context {
+	return context.WithValue(ctx, holdKey{}, hold)
+}
+
+// Hold keeps the message of the events being handled uncommitted until the
+// returned function is called. Without a hold in ctx it does nothing.
+func Hold(ctx context.Context) (release func()) {
+	if hold, ok := ctx.Value(holdKey{}).(HoldFunc); ok {
+		return hold()
+	}
+	return func() {}
+}
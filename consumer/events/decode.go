@@ -0,0 +1,244 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// readerUnions holds the union fields of the reader schemas, by schema name
+var readerUnions = func() map[string]*unions {
+	result := make(map[string]*unions, len(Schemas))
+	for name, schema := range Schemas {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal([]byte(schema), &parsed); err == nil {
+			result[name] = unionsOf(parsed, "")
+		}
+	}
+	return result
+}()
+
+// Decode converts a native goavro record of the reader schema name into the
+// typed event for name
+func Decode(name string, native interface{}) (Event, error) {
+	return decode(name, native, readerUnions[name])
+}
+
+// decode is Decode for a record written with a schema whose union fields are
+// u
+func decode(name string, native interface{}, u *unions) (Event, error) {
+	record, ok := native.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected record, got %T", name, native)
+	}
+
+	var err error
+	d := &decoder{record: record, unions: u, err: &err}
+	var event Event
+
+	switch name {
+	case ExperimentConfiguredName:
+		r := d.nested("temperature_range")
+		event = &ExperimentConfigured{
+			Experiment: d.str("experiment"),
+			Researcher: d.str("researcher"),
+			Sensors:    d.strs("sensors"),
+			TemperatureRange: TemperatureRange{
+				UpperThreshold: r.float("upper_threshold"),
+				LowerThreshold: r.float("lower_threshold"),
+			},
+		}
+	case StabilizationStartedName:
+		event = &StabilizationStarted{
+			Experiment: d.str("experiment"),
+			Timestamp:  d.float("timestamp"),
+		}
+	case ExperimentStartedName:
+		event = &ExperimentStarted{
+			Experiment: d.str("experiment"),
+			Timestamp:  d.float("timestamp"),
+		}
+	case SensorTemperatureMeasuredName:
+		event = &SensorTemperatureMeasured{
+			Experiment:      d.str("experiment"),
+			Sensor:          d.str("sensor"),
+			MeasurementID:   d.str("measurement_id"),
+			Timestamp:       d.float("timestamp"),
+			Temperature:     d.float("temperature"),
+			MeasurementHash: d.str("measurement_hash"),
+		}
+	case ExperimentTerminatedName:
+		event = &ExperimentTerminated{
+			Experiment: d.str("experiment"),
+			Timestamp:  d.float("timestamp"),
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, name)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return event, nil
+}
+
+// decoder reads typed fields from a native record and keeps the first error
+type decoder struct {
+	record map[string]interface{}
+	unions *unions
+	err    *error
+}
+
+func (d *decoder) fail(field, want string, got interface{}) {
+	if *d.err == nil {
+		*d.err = fmt.Errorf("field %q: expected %s, got %T", field, want, got)
+	}
+}
+
+func (d *decoder) nested(field string) *decoder {
+	record, ok := d.value(field).(map[string]interface{})
+	if !ok {
+		d.fail(field, "record", d.record[field])
+	}
+	return &decoder{record: record, unions: d.unions.of(field), err: d.err}
+}
+
+func (d *decoder) str(field string) string {
+	value, ok := d.value(field).(string)
+	if !ok {
+		d.fail(field, "string", d.record[field])
+	}
+	return value
+}
+
+func (d *decoder) float(field string) float64 {
+	switch value := d.value(field).(type) {
+	case float64:
+		return value
+	case float32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case int32:
+		return float64(value)
+	default:
+		d.fail(field, "number", d.record[field])
+		return 0
+	}
+}
+
+func (d *decoder) strs(field string) []string {
+	items, ok := d.value(field).([]interface{})
+	if !ok {
+		d.fail(field, "array", d.record[field])
+		return nil
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		value, ok := item.(string)
+		if !ok {
+			d.fail(field, "array of strings", item)
+			return nil
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// value returns a field of the record, unwrapped if it is a union
+func (d *decoder) value(field string) interface{} {
+	return d.unions.unwrap(field, d.record[field])
+}
+
+// unions holds the branch names of the union fields of a record schema, and
+// the unions of its nested records
+type unions struct {
+	branches map[string]map[string]bool
+	nested   map[string]*unions
+}
+
+// unionsOf collects the unions of a record schema declared in namespace
+func unionsOf(record map[string]interface{}, namespace string) *unions {
+	namespace = namespaceOf(record, namespace)
+	u := &unions{branches: make(map[string]map[string]bool), nested: make(map[string]*unions)}
+	for _, field := range fields(record) {
+		name, _ := field["name"].(string)
+		if branches, ok := field["type"].([]interface{}); ok {
+			u.branches[name] = make(map[string]bool, len(branches))
+			for _, branch := range branches {
+				u.branches[name][branchName(branch, namespace)] = true
+			}
+		}
+		if nested := recordType(field["type"]); nested != nil {
+			u.nested[name] = unionsOf(nested, namespace)
+		}
+	}
+	return u
+}
+
+// of returns the unions of a nested record field
+func (u *unions) of(field string) *unions {
+	if u == nil {
+		return nil
+	}
+	return u.nested[field]
+}
+
+// unwrap returns the value of a goavro union, which is encoded as a
+// single-entry map keyed by the branch name. Values of fields that are not
+// unions, such as single-field records, are returned as they are.
+func (u *unions) unwrap(field string, value interface{}) interface{} {
+	union, ok := value.(map[string]interface{})
+	if u == nil || !ok || len(union) != 1 {
+		return value
+	}
+	for branch, inner := range union {
+		if u.branches[field][branch] {
+			return inner
+		}
+	}
+	return value
+}
+
+// primitives are the Avro types that are not named
+var primitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// branchName returns the name goavro gives a union branch: the full name
+// of named types and the type name of the others
+func branchName(t interface{}, namespace string) string {
+	switch t := t.(type) {
+	case string:
+		return fullName(t, namespace)
+	case map[string]interface{}:
+		kind, _ := t["type"].(string)
+		switch kind {
+		case "record", "enum", "fixed":
+			name, _ := t["name"].(string)
+			return fullName(name, namespaceOf(t, namespace))
+		}
+		return kind
+	}
+	return ""
+}
+
+// namespaceOf returns the namespace of a named type declared in namespace
+func namespaceOf(named map[string]interface{}, namespace string) string {
+	name, _ := named["name"].(string)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i]
+	}
+	if ns, ok := named["namespace"].(string); ok {
+		return ns
+	}
+	return namespace
+}
+
+func fullName(name, namespace string) string {
+	if primitives[name] || namespace == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return namespace + "." + name
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrUnknownEvent is returned when a schema name has no typed event
+	ErrUnknownEvent = errors.New("unknown event")
+	// ErrNoHandler is returned when no handler is registered for an event
+	ErrNoHandler = errors.New("no handler registered")
+	// ErrSkip can be returned by a handler to stop the remaining handlers
+	// for an event without failing it
+	ErrSkip = errors.New("skip remaining handlers")
+)
+
+// Handler processes a single typed event
+type Handler interface {
+	Handle(ctx context.Context, event Event) error
+}
+
+// HandlerFunc adapts a plain function to the Handler interface
+type HandlerFunc func(ctx context.Context, event Event) error
+
+// Handle calls f(ctx, event)
+func (f HandlerFunc) Handle(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// Dispatcher routes decoded records to the handlers registered for their
+// schema name
+type Dispatcher struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// NewDispatcher creates an empty dispatcher
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		handlers: make(map[string][]Handler),
+	}
+}
+
+// Register adds a handler for the given schema name. Handlers registered for
+// the same name are called in registration order.
+func (d *Dispatcher) Register(name string, handler Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[name] = append(d.handlers[name], handler)
+}
+
+// RegisterFunc is a shorthand for Register(name, HandlerFunc(fn))
+func (d *Dispatcher) RegisterFunc(name string, fn func(ctx context.Context, event Event) error) {
+	d.Register(name, HandlerFunc(fn))
+}
+
+// Dispatch decodes a native record of the given schema and hands it to
+// every handler registered for that schema. It stops at the first handler
+// that returns an error.
+func (d *Dispatcher) Dispatch(ctx context.Context, name string, native interface{}) error {
+	event, err := Decode(name, native)
+	if err != nil {
+		return err
+	}
+	return d.DispatchEvent(ctx, event)
+}
+
+// DispatchEvent hands an already decoded event to its handlers. A handler
+// returning ErrSkip ends the chain successfully.
+func (d *Dispatcher) DispatchEvent(ctx context.Context, event Event) error {
+	return d.Resume(ctx, event, &Progress{})
+}
+
+// Progress records how many of an event's handlers succeeded, so retrying a
+// failed dispatch does not run them again
+type Progress struct {
+	done int
+}
+
+// Resume is DispatchEvent starting at the first handler progress has not
+// recorded as successful, and recording every handler that succeeds
+func (d *Dispatcher) Resume(ctx context.Context, event Event, progress *Progress) error {
+	d.mu.RLock()
+	handlers := d.handlers[event.EventName()]
+	d.mu.RUnlock()
+
+	if len(handlers) == 0 {
+		return fmt.Errorf("%w: %s", ErrNoHandler, event.EventName())
+	}
+
+	for ; progress.done < len(handlers); progress.done++ {
+		if err := handlers[progress.done].Handle(ctx, event); err != nil {
+			if errors.Is(err, ErrSkip) {
+				progress.done = len(handlers)
+				return nil
+			}
+			return fmt.Errorf("%s handler failed: %w", event.EventName(), err)
+		}
+	}
+	return nil
+}
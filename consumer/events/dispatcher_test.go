@@ -0,0 +1,74 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDispatcherResume(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name     string
+		results  [][]error // per attempt, the result of each handler called
+		wantRuns []string
+		wantErr  []bool // per attempt
+	}{
+		{
+			name:     "all succeed",
+			results:  [][]error{{nil, nil, nil}},
+			wantRuns: []string{"a", "b", "c"},
+			wantErr:  []bool{false},
+		},
+		{
+			name:     "retry starts at the failed handler",
+			results:  [][]error{{nil, errFailed}, {nil, nil}},
+			wantRuns: []string{"a", "b", "b", "c"},
+			wantErr:  []bool{true, false},
+		},
+		{
+			name:     "skip ends the chain",
+			results:  [][]error{{nil, ErrSkip}, {}},
+			wantRuns: []string{"a", "b"},
+			wantErr:  []bool{false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var runs []string
+			var attempt []error
+			d := NewDispatcher()
+			for _, name := range []string{"a", "b", "c"} {
+				d.RegisterFunc(ExperimentStartedName, func(ctx context.Context, event Event) error {
+					runs = append(runs, name)
+					err := attempt[0]
+					attempt = attempt[1:]
+					return err
+				})
+			}
+
+			var progress Progress
+			for i, results := range tt.results {
+				attempt = results
+				err := d.Resume(context.Background(), started("exp"), &progress)
+				if (err != nil) != tt.wantErr[i] {
+					t.Errorf("attempt %d: Resume() = %v, want error %v", i, err, tt.wantErr[i])
+				}
+				if err != nil && !errors.Is(err, errFailed) {
+					t.Errorf("attempt %d: Resume() = %v, want it to wrap the handler error", i, err)
+				}
+			}
+			if !reflect.DeepEqual(runs, tt.wantRuns) {
+				t.Errorf("handlers ran %v, want %v", runs, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestDispatcherNoHandler(t *testing.T) {
+	err := NewDispatcher().DispatchEvent(context.Background(), started("exp"))
+	if !errors.Is(err, ErrNoHandler) {
+		t.Errorf("DispatchEvent() = %v, want %v", err, ErrNoHandler)
+	}
+}
@@ -0,0 +1,46 @@
+package events
+
+import "fmt"
+
+// Native converts an event into the native goavro record of its schema, the
+// inverse of Decode. Fields outside the schema, such as Tampered, are left
+// out.
+func Native(event Event) (map[string]interface{}, error) {
+	switch e := event.(type) {
+	case *ExperimentConfigured:
+		return map[string]interface{}{
+			"experiment": e.Experiment,
+			"researcher": e.Researcher,
+			"sensors":    stringsToNative(e.Sensors),
+			"temperature_range": map[string]interface{}{
+				"upper_threshold": float32(e.TemperatureRange.UpperThreshold),
+				"lower_threshold": float32(e.TemperatureRange.LowerThreshold),
+			},
+		}, nil
+	case *StabilizationStarted:
+		return map[string]interface{}{"experiment": e.Experiment, "timestamp": e.Timestamp}, nil
+	case *ExperimentStarted:
+		return map[string]interface{}{"experiment": e.Experiment, "timestamp": e.Timestamp}, nil
+	case *SensorTemperatureMeasured:
+		return map[string]interface{}{
+			"experiment":       e.Experiment,
+			"sensor":           e.Sensor,
+			"measurement_id":   e.MeasurementID,
+			"timestamp":        e.Timestamp,
+			"temperature":      float32(e.Temperature),
+			"measurement_hash": e.MeasurementHash,
+		}, nil
+	case *ExperimentTerminated:
+		return map[string]interface{}{"experiment": e.Experiment, "timestamp": e.Timestamp}, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnknownEvent, event)
+	}
+}
+
+func stringsToNative(values []string) []interface{} {
+	native := make([]interface{}, len(values))
+	for i, v := range values {
+		native[i] = v
+	}
+	return native
+}
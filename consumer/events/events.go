@@ -0,0 +1,78 @@
+package events
+
+// Schema names used by the experiment producer. Each OCF container carries
+// exactly one of these as the name of its writer schema.
+const (
+	ExperimentConfiguredName      = "experiment_configured"
+	StabilizationStartedName      = "stabilization_started"
+	ExperimentStartedName         = "experiment_started"
+	SensorTemperatureMeasuredName = "sensor_temperature_measured"
+	ExperimentTerminatedName      = "experiment_terminated"
+)
+
+// Event is implemented by every typed event decoded from the topic
+type Event interface {
+	// EventName returns the schema name the event was decoded from
+	EventName() string
+	// ExperimentID returns the experiment the event belongs to
+	ExperimentID() string
+}
+
+// TemperatureRange holds the accepted temperature band of an experiment
+type TemperatureRange struct {
+	UpperThreshold float64 `json:"upper_threshold"`
+	LowerThreshold float64 `json:"lower_threshold"`
+}
+
+// ExperimentConfigured announces a new experiment and its sensors
+type ExperimentConfigured struct {
+	Experiment       string           `json:"experiment"`
+	Researcher       string           `json:"researcher"`
+	Sensors          []string         `json:"sensors"`
+	TemperatureRange TemperatureRange `json:"temperature_range"`
+}
+
+// StabilizationStarted marks the start of the stabilization phase
+type StabilizationStarted struct {
+	Experiment string  `json:"experiment"`
+	Timestamp  float64 `json:"timestamp"`
+}
+
+// ExperimentStarted marks the start of the measurement phase
+type ExperimentStarted struct {
+	Experiment string  `json:"experiment"`
+	Timestamp  float64 `json:"timestamp"`
+}
+
+// SensorTemperatureMeasured is a single reading of one sensor.
+// All sensors of an experiment share the same MeasurementID per sample.
+type SensorTemperatureMeasured struct {
+	Experiment      string  `json:"experiment"`
+	Sensor          string  `json:"sensor"`
+	MeasurementID   string  `json:"measurement_id"`
+	Timestamp       float64 `json:"timestamp"`
+	Temperature     float64 `json:"temperature"`
+	MeasurementHash string  `json:"measurement_hash"`
+
+	// Tampered is not part of the schema, it is set by the hash verifier
+	// when the reading does not match its measurement hash
+	Tampered bool `json:"tampered,omitempty"`
+}
+
+// ExperimentTerminated marks the end of an experiment
+type ExperimentTerminated struct {
+	Experiment string  `json:"experiment"`
+	Timestamp  float64 `json:"timestamp"`
+}
+
+func (e *ExperimentConfigured) EventName() string      { return ExperimentConfiguredName }
+func (e *StabilizationStarted) EventName() string      { return StabilizationStartedName }
+func (e *ExperimentStarted) EventName() string         { return ExperimentStartedName }
+func (e *SensorTemperatureMeasured) EventName() string { return SensorTemperatureMeasuredName }
+func (e *ExperimentTerminated) EventName() string      { return ExperimentTerminatedName }
+
+func (e *ExperimentConfigured) ExperimentID() string      { return e.Experiment }
+func (e *StabilizationStarted) ExperimentID() string      { return e.Experiment }
+func (e *ExperimentStarted) ExperimentID() string         { return e.Experiment }
+func (e *SensorTemperatureMeasured) ExperimentID() string { return e.Experiment }
+func (e *ExperimentTerminated) ExperimentID() string      { return e.Experiment }
@@ -0,0 +1,178 @@
+package events
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+// ocfMagic starts every Avro object container
+var ocfMagic = []byte("Obj\x01")
+
+// Limits on a single container block, well above what a Kafka message holds
+// but low enough that a corrupt header cannot make the decoder allocate
+// without bound
+const (
+	maxBlockCount = 1 << 20
+	maxBlockSize  = 16 << 20
+)
+
+// container is an Avro object container split into its parts, with the
+// blocks still in their binary encoding
+type container struct {
+	schema []byte
+	blocks []block
+}
+
+// block holds the binary records of one container block
+type block struct {
+	count int64
+	data  []byte
+}
+
+// parseContainer splits an OCF container and decompresses its blocks. The
+// records are decoded later with the cached codec of the writer schema,
+// goavro's OCFReader would compile the schema again for every message.
+func parseContainer(value []byte) (*container, error) {
+	if !bytes.HasPrefix(value, ocfMagic) {
+		return nil, errors.New("not an OCF container")
+	}
+	r := &binaryReader{buf: value[len(ocfMagic):]}
+
+	meta := r.metadata()
+	sync := r.fixed(16)
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid OCF header: %w", r.err)
+	}
+	schema, ok := meta["avro.schema"]
+	if !ok {
+		return nil, errors.New("OCF header has no schema")
+	}
+	codec := string(meta["avro.codec"])
+
+	c := &container{schema: schema}
+	for len(r.buf) > 0 {
+		count := r.long()
+		data := r.bytes()
+		if !bytes.Equal(r.fixed(16), sync) && r.err == nil {
+			r.err = errors.New("sync marker mismatch")
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("invalid OCF block: %w", r.err)
+		}
+		if count < 0 || count > maxBlockCount {
+			return nil, fmt.Errorf("invalid OCF block: record count %d out of range", count)
+		}
+
+		data, err := decompress(codec, data)
+		if err != nil {
+			return nil, err
+		}
+		c.blocks = append(c.blocks, block{count: count, data: data})
+	}
+	return c, nil
+}
+
+// decompress returns the records of a block compressed with codec, at most
+// maxBlockSize bytes
+func decompress(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case "", "null":
+		return data, nil
+	case "deflate":
+		decoded, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(data)), maxBlockSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to inflate block: %w", err)
+		}
+		if len(decoded) > maxBlockSize {
+			return nil, fmt.Errorf("inflated block exceeds %d bytes", maxBlockSize)
+		}
+		return decoded, nil
+	case "snappy":
+		// The last 4 bytes are the CRC32 of the decompressed block
+		if len(data) < 4 {
+			return nil, errors.New("snappy block without checksum")
+		}
+		size, err := snappy.DecodedLen(data[:len(data)-4])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress block: %w", err)
+		}
+		if size > maxBlockSize {
+			return nil, fmt.Errorf("decompressed block exceeds %d bytes", maxBlockSize)
+		}
+		decoded, err := snappy.Decode(nil, data[:len(data)-4])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress block: %w", err)
+		}
+		if crc32.ChecksumIEEE(decoded) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+			return nil, errors.New("snappy block checksum mismatch")
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("unsupported OCF compression %q", codec)
+	}
+}
+
+// binaryReader reads Avro primitives and keeps the first error
+type binaryReader struct {
+	buf []byte
+	err error
+}
+
+func (r *binaryReader) long() int64 {
+	if r.err != nil {
+		return 0
+	}
+	// Avro longs use the same zig-zag varint encoding as Go
+	value, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = errors.New("invalid long")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return value
+}
+
+func (r *binaryReader) fixed(size int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if size < 0 || size > len(r.buf) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	value := r.buf[:size]
+	r.buf = r.buf[size:]
+	return value
+}
+
+func (r *binaryReader) bytes() []byte {
+	return r.fixed(int(r.long()))
+}
+
+// metadata reads the header's map of bytes
+func (r *binaryReader) metadata() map[string][]byte {
+	meta := make(map[string][]byte)
+	for r.err == nil {
+		count := r.long()
+		if count == 0 {
+			break
+		}
+		if count < 0 {
+			// A negative count is followed by the block size in bytes
+			count = -count
+			r.long()
+		}
+		for ; count > 0 && r.err == nil; count-- {
+			key := string(r.bytes())
+			meta[key] = r.bytes()
+		}
+	}
+	return meta
+}
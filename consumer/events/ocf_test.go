@@ -0,0 +1,208 @@
+package events
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/linkedin/goavro/v2"
+)
+
+var testSync = bytes.Repeat([]byte{0x5a}, 16)
+
+// rawBlock is a container block as written, data already compressed
+type rawBlock struct {
+	count int64
+	data  []byte
+}
+
+func appendLong(buf []byte, value int64) []byte {
+	return binary.AppendVarint(buf, value)
+}
+
+func appendBytes(buf, value []byte) []byte {
+	return append(appendLong(buf, int64(len(value))), value...)
+}
+
+// ocf assembles a container by hand so tests can corrupt any part of it.
+// An empty codec leaves avro.codec out of the header.
+func ocf(schema, codec string, blocks ...rawBlock) []byte {
+	meta := map[string]string{"avro.schema": schema}
+	if codec != "" {
+		meta["avro.codec"] = codec
+	}
+
+	buf := append([]byte(nil), ocfMagic...)
+	buf = appendLong(buf, int64(len(meta)))
+	for key, value := range meta {
+		buf = appendBytes(buf, []byte(key))
+		buf = appendBytes(buf, []byte(value))
+	}
+	buf = appendLong(buf, 0)
+	buf = append(buf, testSync...)
+	for _, b := range blocks {
+		buf = appendLong(buf, b.count)
+		buf = appendBytes(buf, b.data)
+		buf = append(buf, testSync...)
+	}
+	return buf
+}
+
+// records returns the binary encoding of events that share a schema
+func records(t *testing.T, evs ...Event) []byte {
+	t.Helper()
+	codec, err := Codec(evs[0].EventName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf []byte
+	for _, event := range evs {
+		native, err := Native(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf, err = codec.BinaryFromNative(buf, native); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf
+}
+
+func deflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func snappyBlock(data []byte) []byte {
+	return binary.BigEndian.AppendUint32(snappy.Encode(nil, data), crc32.ChecksumIEEE(data))
+}
+
+func started(experiment string) *ExperimentStarted {
+	return &ExperimentStarted{Experiment: experiment, Timestamp: 1.5}
+}
+
+func TestOCFDecoderDecode(t *testing.T) {
+	schema := Schemas[ExperimentStartedName]
+	one := records(t, started("a"))
+	two := records(t, started("b"), started("c"))
+
+	corruptSnappy := snappyBlock(one)
+	corruptSnappy[len(corruptSnappy)-1]++
+	mismatchedSync := ocf(schema, "null", rawBlock{1, one})
+	mismatchedSync[len(mismatchedSync)-1]++
+
+	tests := []struct {
+		name    string
+		value   []byte
+		want    []string // experiments of the decoded events
+		wantErr string
+	}{
+		{"no codec", ocf(schema, "", rawBlock{1, one}), []string{"a"}, ""},
+		{"null codec", ocf(schema, "null", rawBlock{1, one}, rawBlock{2, two}), []string{"a", "b", "c"}, ""},
+		{"deflate", ocf(schema, "deflate", rawBlock{1, deflate(t, one)}, rawBlock{2, deflate(t, two)}), []string{"a", "b", "c"}, ""},
+		{"snappy", ocf(schema, "snappy", rawBlock{2, snappyBlock(two)}), []string{"b", "c"}, ""},
+		{"no blocks", ocf(schema, "null"), nil, ""},
+
+		{"not a container", []byte("{}"), nil, "not an OCF container"},
+		{"truncated header", ocf(schema, "null")[:10], nil, "invalid OCF header"},
+		{"no schema", append(append(append([]byte(nil), ocfMagic...), 0), testSync...), nil, "no schema"},
+		{"truncated block", ocf(schema, "null", rawBlock{1, one})[:len(ocf(schema, "null"))+3], nil, "invalid OCF block"},
+		{"sync marker mismatch", mismatchedSync, nil, "sync marker mismatch"},
+		{"negative count", ocf(schema, "null", rawBlock{-1, one}), nil, "out of range"},
+		{"count too large", ocf(schema, "null", rawBlock{maxBlockCount + 1, one}), nil, "out of range"},
+		{"count beyond records", ocf(schema, "null", rawBlock{2, one}), nil, "failed to read record"},
+		{"corrupt deflate", ocf(schema, "deflate", rawBlock{1, []byte{0xff, 0xff}}), nil, "failed to inflate"},
+		{"snappy checksum mismatch", ocf(schema, "snappy", rawBlock{1, corruptSnappy}), nil, "checksum mismatch"},
+		{"snappy without checksum", ocf(schema, "snappy", rawBlock{1, []byte{1}}), nil, "without checksum"},
+		{"corrupt snappy", ocf(schema, "snappy", rawBlock{1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}}), nil, "failed to decompress"},
+		{"unsupported codec", ocf(schema, "zstandard", rawBlock{1, one}), nil, "unsupported OCF compression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewOCFDecoder()
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := d.Decode(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() = %v", err)
+			}
+
+			var got []string
+			for _, event := range decoded {
+				got = append(got, event.ExperimentID())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decoded %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecompressLimitsInflatedSize(t *testing.T) {
+	huge := deflate(t, make([]byte, maxBlockSize+1))
+	if _, err := decompress("deflate", huge); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("decompress(deflate) error = %v, want size limit", err)
+	}
+
+	// snappy declares the decoded length up front, it is checked before
+	// anything is allocated
+	header := binary.AppendUvarint(nil, maxBlockSize+1)
+	if _, err := decompress("snappy", append(header, 0, 0, 0, 0)); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("decompress(snappy) error = %v, want size limit", err)
+	}
+}
+
+// The hand-written parser must read what goavro's own writer produces
+func TestOCFDecoderReadsGoavroContainers(t *testing.T) {
+	for _, compression := range []string{goavro.CompressionNullLabel, goavro.CompressionDeflateLabel, goavro.CompressionSnappyLabel} {
+		t.Run(compression, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := goavro.NewOCFWriter(goavro.OCFConfig{
+				W:               &buf,
+				Schema:          Schemas[ExperimentStartedName],
+				CompressionName: compression,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, experiment := range []string{"a", "b"} {
+				native, _ := Native(started(experiment))
+				if err := w.Append([]interface{}{native}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			d, err := NewOCFDecoder()
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := d.Decode(buf.Bytes())
+			if err != nil {
+				t.Fatalf("Decode() = %v", err)
+			}
+			want := []Event{started("a"), started("b")}
+			if !reflect.DeepEqual(decoded, want) {
+				t.Errorf("decoded %+v, want %+v", decoded, want)
+			}
+		})
+	}
+}
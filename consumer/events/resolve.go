@@ -0,0 +1,254 @@
+package events
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// maxWriterSchemas bounds the writer schema cache. Producers rarely use more
+// than a few versions of each schema at the same time.
+const maxWriterSchemas = 64
+
+// OCFDecoder decodes OCF containers into typed events. Writer schemas are
+// compiled once and cached by the fingerprint of their canonical form, and
+// records are resolved against the reader schemas in Schemas: fields the
+// writer adds are ignored, fields it lacks take the reader's default.
+type OCFDecoder struct {
+	readers map[string]map[string]interface{}
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	writers map[uint64]*list.Element
+	// texts finds the cached schema of a schema text already seen without
+	// compiling it
+	texts map[[sha256.Size]byte]*list.Element
+}
+
+// writerSchema is a compiled writer schema and how its records map onto the
+// reader schema of the same name
+type writerSchema struct {
+	name   string
+	codec  *goavro.Codec
+	plan   *plan
+	unions *unions
+	// texts are the schema texts with this canonical form, at most
+	// maxWriterSchemas of them
+	texts [][sha256.Size]byte
+}
+
+// plan fills in the fields a writer schema lacks
+type plan struct {
+	defaults map[string]interface{}
+	nested   map[string]*plan
+}
+
+// NewOCFDecoder parses the reader schemas
+func NewOCFDecoder() (*OCFDecoder, error) {
+	readers := make(map[string]map[string]interface{}, len(Schemas))
+	for name, schema := range Schemas {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal([]byte(schema), &parsed); err != nil {
+			return nil, fmt.Errorf("failed to parse %s reader schema: %w", name, err)
+		}
+		readers[name] = parsed
+	}
+	return &OCFDecoder{
+		readers: readers,
+		order:   list.New(),
+		writers: make(map[uint64]*list.Element),
+		texts:   make(map[[sha256.Size]byte]*list.Element),
+	}, nil
+}
+
+// Decode reads every record of the container in value
+func (d *OCFDecoder) Decode(value []byte) ([]Event, error) {
+	c, err := parseContainer(value)
+	if err != nil {
+		return nil, err
+	}
+	// All records in a container share the writer schema
+	writer, err := d.writer(c.schema)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded []Event
+	for _, b := range c.blocks {
+		data := b.data
+		for i := int64(0); i < b.count; i++ {
+			var native interface{}
+			native, data, err = writer.codec.NativeFromBinary(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read record: %w", err)
+			}
+			if record, ok := native.(map[string]interface{}); ok {
+				writer.plan.apply(record, writer.unions)
+			}
+
+			event, err := decode(writer.name, native, writer.unions)
+			if err != nil {
+				return nil, err
+			}
+			decoded = append(decoded, event)
+		}
+	}
+	return decoded, nil
+}
+
+// Schemas returns the number of cached writer schemas
+func (d *OCFDecoder) Schemas() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.order.Len()
+}
+
+// writer returns the cached writer schema, compiling it on first use.
+// Schema texts differing only in formatting, docs or field order share the
+// compiled schema. Once the cache is full the least recently used schema is
+// evicted. Schemas that fail to compile or resolve are not cached, their
+// messages are dead-lettered and the schema may be fixed by the time they
+// are re-driven.
+func (d *OCFDecoder) writer(schema []byte) (*writerSchema, error) {
+	text := sha256.Sum256(schema)
+	d.mu.Lock()
+	if elem, ok := d.texts[text]; ok {
+		d.order.MoveToFront(elem)
+		d.mu.Unlock()
+		return elem.Value.(*writerSchema), nil
+	}
+	d.mu.Unlock()
+
+	writer, err := d.compile(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	elem, ok := d.writers[writer.codec.Rabin]
+	if ok {
+		d.order.MoveToFront(elem)
+		writer = elem.Value.(*writerSchema)
+	} else {
+		elem = d.order.PushFront(writer)
+		d.writers[writer.codec.Rabin] = elem
+	}
+	if _, ok := d.texts[text]; !ok && len(writer.texts) < maxWriterSchemas {
+		writer.texts = append(writer.texts, text)
+		d.texts[text] = elem
+	}
+	for d.order.Len() > maxWriterSchemas {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		evicted := oldest.Value.(*writerSchema)
+		delete(d.writers, evicted.codec.Rabin)
+		for _, text := range evicted.texts {
+			delete(d.texts, text)
+		}
+	}
+	return writer, nil
+}
+
+func (d *OCFDecoder) compile(schema []byte) (*writerSchema, error) {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(schema, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	name, _ := parsed["name"].(string)
+	name = name[strings.LastIndex(name, ".")+1:]
+	reader, ok := d.readers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEvent, name)
+	}
+
+	codec, err := goavro.NewCodec(string(schema))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile %s schema: %w", name, err)
+	}
+	p, err := resolve(reader, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%s schema: %w", name, err)
+	}
+	return &writerSchema{name: name, codec: codec, plan: p, unions: unionsOf(parsed, "")}, nil
+}
+
+// resolve matches the fields of a reader record schema with the writer's
+func resolve(reader, writer map[string]interface{}) (*plan, error) {
+	written := make(map[string]map[string]interface{})
+	for _, field := range fields(writer) {
+		name, _ := field["name"].(string)
+		written[name] = field
+	}
+
+	p := &plan{defaults: make(map[string]interface{}), nested: make(map[string]*plan)}
+	for _, field := range fields(reader) {
+		name, _ := field["name"].(string)
+		w, ok := written[name]
+		if !ok {
+			def, ok := field["default"]
+			if !ok {
+				return nil, fmt.Errorf("field %q is missing and has no default", name)
+			}
+			p.defaults[name] = def
+			continue
+		}
+
+		readerRecord, writerRecord := recordType(field["type"]), recordType(w["type"])
+		if readerRecord != nil && writerRecord != nil {
+			sub, err := resolve(readerRecord, writerRecord)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			p.nested[name] = sub
+		}
+	}
+	return p, nil
+}
+
+// apply adds the missing fields to a native record with the unions u
+func (p *plan) apply(record map[string]interface{}, u *unions) {
+	for name, value := range p.defaults {
+		record[name] = value
+	}
+	for name, sub := range p.nested {
+		if nested, ok := u.unwrap(name, record[name]).(map[string]interface{}); ok {
+			sub.apply(nested, u.of(name))
+		}
+	}
+}
+
+// fields returns the field definitions of a record schema
+func fields(schema map[string]interface{}) []map[string]interface{} {
+	list, _ := schema["fields"].([]interface{})
+	result := make([]map[string]interface{}, 0, len(list))
+	for _, field := range list {
+		if field, ok := field.(map[string]interface{}); ok {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// recordType returns the record schema of a field type, including a record
+// inside a union
+func recordType(t interface{}) map[string]interface{} {
+	switch t := t.(type) {
+	case map[string]interface{}:
+		if t["type"] == "record" {
+			return t
+		}
+	case []interface{}:
+		for _, branch := range t {
+			if record := recordType(branch); record != nil {
+				return record
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// written encodes native with a writer schema and wraps it in a container
+func written(t *testing.T, schema string, native map[string]interface{}) []byte {
+	t.Helper()
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := codec.BinaryFromNative(nil, native)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ocf(schema, "null", rawBlock{1, data})
+}
+
+func TestOCFDecoderResolvesWriterSchemas(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		native  map[string]interface{}
+		want    Event
+		wantErr string
+	}{
+		{
+			name:   "reader schema",
+			schema: Schemas[SensorTemperatureMeasuredName],
+			native: map[string]interface{}{
+				"experiment": "exp", "sensor": "s", "measurement_id": "m",
+				"timestamp": 2.0, "temperature": float32(20.5), "measurement_hash": "h",
+			},
+			want: &SensorTemperatureMeasured{Experiment: "exp", Sensor: "s", MeasurementID: "m", Timestamp: 2, Temperature: 20.5, MeasurementHash: "h"},
+		},
+		{
+			name: "missing field takes the default",
+			schema: `{"type": "record", "name": "sensor_temperature_measured", "fields": [
+				{"name": "experiment", "type": "string"},
+				{"name": "sensor", "type": "string"},
+				{"name": "measurement_id", "type": "string"},
+				{"name": "timestamp", "type": "double"},
+				{"name": "temperature", "type": "float"}
+			]}`,
+			native: map[string]interface{}{
+				"experiment": "exp", "sensor": "s", "measurement_id": "m",
+				"timestamp": 2.0, "temperature": float32(20.5),
+			},
+			want: &SensorTemperatureMeasured{Experiment: "exp", Sensor: "s", MeasurementID: "m", Timestamp: 2, Temperature: 20.5},
+		},
+		{
+			name: "namespaced name and added field",
+			schema: `{"type": "record", "name": "lab.experiment_started", "fields": [
+				{"name": "experiment", "type": "string"},
+				{"name": "site", "type": "string"},
+				{"name": "timestamp", "type": "double"}
+			]}`,
+			native: map[string]interface{}{"experiment": "exp", "site": "lab", "timestamp": 3.0},
+			want:   &ExperimentStarted{Experiment: "exp", Timestamp: 3},
+		},
+		{
+			name: "configuration without researcher",
+			schema: `{"type": "record", "name": "experiment_configured", "fields": [
+				{"name": "experiment", "type": "string"},
+				{"name": "sensors", "type": {"type": "array", "items": "string"}},
+				{"name": "temperature_range", "type": {"type": "record", "name": "temperature_range", "fields": [
+					{"name": "upper_threshold", "type": "float"},
+					{"name": "lower_threshold", "type": "float"}
+				]}}
+			]}`,
+			native: map[string]interface{}{
+				"experiment": "exp",
+				"sensors":    []interface{}{"a", "b"},
+				"temperature_range": map[string]interface{}{
+					"upper_threshold": float32(30), "lower_threshold": float32(10),
+				},
+			},
+			want: &ExperimentConfigured{Experiment: "exp", Sensors: []string{"a", "b"}, TemperatureRange: TemperatureRange{UpperThreshold: 30, LowerThreshold: 10}},
+		},
+		{
+			name: "missing field without default",
+			schema: `{"type": "record", "name": "experiment_started", "fields": [
+				{"name": "experiment", "type": "string"}
+			]}`,
+			native:  map[string]interface{}{"experiment": "exp"},
+			wantErr: `field "timestamp" is missing and has no default`,
+		},
+		{
+			name: "unknown event",
+			schema: `{"type": "record", "name": "experiment_paused", "fields": [
+				{"name": "experiment", "type": "string"}
+			]}`,
+			native:  map[string]interface{}{"experiment": "exp"},
+			wantErr: ErrUnknownEvent.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewOCFDecoder()
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := d.Decode(written(t, tt.schema, tt.native))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %q", err, tt.wantErr)
+				}
+				// Failed schemas are not cached, a fixed one may come later
+				if d.Schemas() != 0 {
+					t.Errorf("Schemas() = %d after a failure, want 0", d.Schemas())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() = %v", err)
+			}
+			if len(decoded) != 1 || !reflect.DeepEqual(decoded[0], tt.want) {
+				t.Errorf("decoded %+v, want %+v", decoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestOCFDecoderCachesWriterSchemas(t *testing.T) {
+	d, err := NewOCFDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode := func(schema string) {
+		t.Helper()
+		native := map[string]interface{}{"experiment": "exp", "timestamp": 1.0}
+		if _, err := d.Decode(written(t, schema, native)); err != nil {
+			t.Fatalf("Decode() = %v", err)
+		}
+	}
+
+	decode(Schemas[ExperimentStartedName])
+	decode(Schemas[ExperimentStartedName])
+	// Docs and formatting are not part of the canonical form
+	decode(`{"type": "record", "name": "experiment_started", "doc": "v2",
+		"fields": [{"name": "experiment", "type": "string"}, {"name": "timestamp", "type": "double"}]}`)
+	if d.Schemas() != 1 {
+		t.Fatalf("Schemas() = %d after decoding one schema three times, want 1", d.Schemas())
+	}
+
+	// Every namespace makes a distinct writer schema, the oldest ones are
+	// evicted
+	for i := range maxWriterSchemas + 10 {
+		decode(fmt.Sprintf(`{"type": "record", "name": "v%d.experiment_started", "fields": [
+			{"name": "experiment", "type": "string"},
+			{"name": "timestamp", "type": "double"}
+		]}`, i))
+	}
+	if d.Schemas() != maxWriterSchemas {
+		t.Errorf("Schemas() = %d, want %d", d.Schemas(), maxWriterSchemas)
+	}
+}
+
+func TestOCFDecoderUnions(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		native map[string]interface{}
+		want   Event
+	}{
+		{
+			name: "optional fields",
+			schema: `{"type": "record", "name": "lab.experiment_configured", "fields": [
+				{"name": "experiment", "type": ["null", "string"]},
+				{"name": "researcher", "type": "string"},
+				{"name": "sensors", "type": {"type": "array", "items": "string"}},
+				{"name": "temperature_range", "type": ["null", {"type": "record", "name": "temperature_range", "fields": [
+					{"name": "upper_threshold", "type": ["null", "float"]},
+					{"name": "lower_threshold", "type": "float"}
+				]}]}
+			]}`,
+			native: map[string]interface{}{
+				"experiment": goavro.Union("string", "exp"),
+				"researcher": "r",
+				"sensors":    []interface{}{"a"},
+				"temperature_range": goavro.Union("lab.temperature_range", map[string]interface{}{
+					"upper_threshold": goavro.Union("float", float32(30)), "lower_threshold": float32(10),
+				}),
+			},
+			want: &ExperimentConfigured{Experiment: "exp", Researcher: "r", Sensors: []string{"a"}, TemperatureRange: TemperatureRange{UpperThreshold: 30, LowerThreshold: 10}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewOCFDecoder()
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := d.Decode(written(t, tt.schema, tt.native))
+			if err != nil {
+				t.Fatalf("Decode() = %v", err)
+			}
+			if len(decoded) != 1 || !reflect.DeepEqual(decoded[0], tt.want) {
+				t.Errorf("decoded %+v, want %+v", decoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnionsUnwrap(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"type": "record", "name": "r", "namespace": "lab", "fields": [
+		{"name": "optional", "type": ["null", "string", {"type": "record", "name": "inner", "fields": []}]},
+		{"name": "single", "type": {"type": "record", "name": "single", "fields": [
+			{"name": "string", "type": "string"}
+		]}}
+	]}`), &schema); err != nil {
+		t.Fatal(err)
+	}
+	u := unionsOf(schema, "")
+	record := map[string]interface{}{}
+	tests := []struct {
+		name  string
+		field string
+		value interface{}
+		want  interface{}
+	}{
+		{"primitive branch", "optional", map[string]interface{}{"string": "x"}, "x"},
+		{"named branch", "optional", map[string]interface{}{"lab.inner": record}, record},
+		{"null", "optional", nil, nil},
+		{"not a branch", "optional", map[string]interface{}{"int": 1}, map[string]interface{}{"int": 1}},
+		// A record whose only field is called like a branch
+		{"single-field record", "single", map[string]interface{}{"string": "x"}, map[string]interface{}{"string": "x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := u.unwrap(tt.field, tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unwrap(%q, %v) = %v, want %v", tt.field, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOCFDecoderInvalidSchema(t *testing.T) {
+	d, err := NewOCFDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Decode(ocf("not json", "null"))
+	if err == nil || errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("Decode() error = %v, want a schema parse error", err)
+	}
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"fmt"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Schemas holds the Avro schema of every event, as written by the experiment
+// producer. The consumer also reads with them, so fields that older or newer
+// producers may not write carry a default.
+var Schemas = map[string]string{
+	ExperimentConfiguredName: `{
+		"type": "record",
+		"name": "experiment_configured",
+		"fields": [
+			{"name": "experiment", "type": "string"},
+			{"name": "researcher", "type": "string", "default": ""},
+			{"name": "sensors", "type": {"type": "array", "items": "string"}},
+			{"name": "temperature_range", "type": {
+				"type": "record",
+				"name": "temperature_range",
+				"fields": [
+					{"name": "upper_threshold", "type": "float"},
+					{"name": "lower_threshold", "type": "float"}
+				]
+			}}
+		]
+	}`,
+	StabilizationStartedName: `{
+		"type": "record",
+		"name": "stabilization_started",
+		"fields": [
+			{"name": "experiment", "type": "string"},
+			{"name": "timestamp", "type": "double"}
+		]
+	}`,
+	ExperimentStartedName: `{
+		"type": "record",
+		"name": "experiment_started",
+		"fields": [
+			{"name": "experiment", "type": "string"},
+			{"name": "timestamp", "type": "double"}
+		]
+	}`,
+	SensorTemperatureMeasuredName: `{
+		"type": "record",
+		"name": "sensor_temperature_measured",
+		"fields": [
+			{"name": "experiment", "type": "string"},
+			{"name": "sensor", "type": "string"},
+			{"name": "measurement_id", "type": "string"},
+			{"name": "timestamp", "type": "double"},
+			{"name": "temperature", "type": "float"},
+			{"name": "measurement_hash", "type": "string", "default": ""}
+		]
+	}`,
+	ExperimentTerminatedName: `{
+		"type": "record",
+		"name": "experiment_terminated",
+		"fields": [
+			{"name": "experiment", "type": "string"},
+			{"name": "timestamp", "type": "double"}
+		]
+	}`,
+}
+
+// Codec compiles the schema of the named event
+func Codec(name string) (*goavro.Codec, error) {
+	schema, ok := Schemas[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, name)
+	}
+	return goavro.NewCodec(schema)
+}
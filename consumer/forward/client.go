@@ -0,0 +1,188 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"assignment2/events"
+	"assignment2/metrics"
+)
+
+// TopicHeader carries the topic a forwarded event was consumed from
+const TopicHeader = "X-Source-Topic"
+
+// ErrPermanent marks a forward that must not be retried, e.g. a payload the
+// downstream service rejected as invalid
+var ErrPermanent = errors.New("permanent forward failure")
+
+// RetryPolicy controls how failed forwards are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, 0 retries forever
+	MaxAttempts int
+	// InitialBackoff is the delay after the first failed attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponential backoff
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy retries forever so a Kafka message is never dropped
+// because a downstream service is temporarily unavailable
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    0,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+	}
+}
+
+// BoundedRetryPolicy gives up after a few attempts. It is meant for
+// requests the caller can do without, e.g. diagnostics that are logged and
+// dropped or lookups with a fallback, rather than holding up the stream.
+func BoundedRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}
+}
+
+// Client posts JSON payloads to a downstream HTTP service
+type Client struct {
+	name    string
+	baseURL string
+	http    *http.Client
+	retry   RetryPolicy
+}
+
+// NewClient creates a client for the service reachable at baseURL
+func NewClient(name, baseURL string, retry RetryPolicy) *Client {
+	return &Client{
+		name:    name,
+		baseURL: baseURL,
+		http:    &http.Client{Timeout: 10 * time.Second},
+		retry:   retry,
+	}
+}
+
+// WithRetry returns a client for the same service using the given retry
+// policy
+func (c *Client) WithRetry(retry RetryPolicy) *Client {
+	clone := *c
+	clone.retry = retry
+	return &clone
+}
+
+// Name returns the downstream service name
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Post sends payload as JSON to path, retrying transient failures according
+// to the client's retry policy
+func (c *Client) Post(ctx context.Context, path string, payload interface{}) error {
+	return c.Call(ctx, path, payload, nil)
+}
+
+// Call is Post that also decodes the JSON response into result, unless
+// result is nil
+func (c *Client) Call(ctx context.Context, path string, payload, result interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%w: failed to marshal payload: %v", ErrPermanent, err)
+	}
+	return c.send(ctx, http.MethodPost, path, body, result)
+}
+
+// Get fetches path and decodes the JSON response into result, retrying
+// like Post
+func (c *Client) Get(ctx context.Context, path string, result interface{}) error {
+	return c.send(ctx, http.MethodGet, path, nil, result)
+}
+
+// send makes the request, retrying transient failures
+func (c *Client) send(ctx context.Context, method, path string, body []byte, result interface{}) error {
+	backoff := c.retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := c.request(ctx, method, path, body, result)
+		metrics.ForwardSeconds.WithLabelValues(c.name).Observe(time.Since(start).Seconds())
+		metrics.ForwardRequests.WithLabelValues(c.name, outcome(err)).Inc()
+		if err == nil || errors.Is(err, ErrPermanent) {
+			return err
+		}
+		if c.retry.MaxAttempts > 0 && attempt >= c.retry.MaxAttempts {
+			return fmt.Errorf("%s: giving up after %d attempts: %w", c.name, attempt, err)
+		}
+
+		log.Printf("Forward to %s%s failed (attempt %d), retrying in %v: %v", c.name, path, attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > c.retry.MaxBackoff {
+			backoff = c.retry.MaxBackoff
+		}
+	}
+}
+
+// outcome labels the result of a single request
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrPermanent):
+		return "rejected"
+	default:
+		return "error"
+	}
+}
+
+func (c *Client) request(ctx context.Context, method, path string, body []byte, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("%w: failed to build request: %v", ErrPermanent, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if topic := events.Topic(ctx); topic != "" {
+		req.Header.Set(TopicHeader, topic)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if result == nil {
+			io.Copy(io.Discard, resp.Body)
+			return nil
+		}
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("%s: invalid response: %w", c.name, err)
+		}
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("%s responded %d: %s", c.name, resp.StatusCode, bytes.TrimSpace(msg))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+	return err
+}
@@ -0,0 +1,324 @@
+package forward
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"assignment2/aggregate"
+	"assignment2/events"
+	"assignment2/lifecycle"
+	"assignment2/metrics"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// service is a fake downstream service that answers with the queued
+// statuses, 200 once they run out, and records every request. GET requests
+// are answered with the stored experiment, 404 without one.
+type service struct {
+	mu         sync.Mutex
+	statuses   []int
+	paths      []string
+	topics     []string
+	bodies     [][]byte
+	experiment string
+	gets       int
+}
+
+func (s *service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body json.RawMessage
+	json.NewDecoder(r.Body).Decode(&body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method == http.MethodGet {
+		s.gets++
+		if s.experiment == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(s.experiment))
+		return
+	}
+	s.paths = append(s.paths, r.URL.Path)
+	s.topics = append(s.topics, r.Header.Get(TopicHeader))
+	s.bodies = append(s.bodies, body)
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newService(t *testing.T, statuses ...int) (*service, *Client) {
+	t.Helper()
+	s := &service{statuses: statuses}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, NewClient("test", server.URL, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+}
+
+func TestClientPost(t *testing.T) {
+	tests := []struct {
+		name          string
+		statuses      []int
+		wantAttempts  int
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{"ok", nil, 1, false, false},
+		{"server error is retried", []int{500, 503}, 3, false, false},
+		{"too many requests is retried", []int{429}, 2, false, false},
+		{"client error is permanent", []int{400}, 1, true, true},
+		{"attempts run out", []int{500, 500, 500}, 3, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, client := newService(t, tt.statuses...)
+			ctx := events.WithTopic(context.Background(), "group2")
+
+			err := client.Post(ctx, "/events/x", map[string]int{"a": 1})
+			if (err != nil) != tt.wantErr || errors.Is(err, ErrPermanent) != tt.wantPermanent {
+				t.Errorf("Post() = %v, want error %v, permanent %v", err, tt.wantErr, tt.wantPermanent)
+			}
+			if len(s.paths) != tt.wantAttempts {
+				t.Errorf("%d attempts, want %d", len(s.paths), tt.wantAttempts)
+			}
+			if s.topics[0] != "group2" {
+				t.Errorf("topic header %q, want group2", s.topics[0])
+			}
+		})
+	}
+}
+
+// count returns the requests of the test client with the given result
+func count(t *testing.T, result string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.ForwardRequests.WithLabelValues("test", result).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestClientCountsRequests(t *testing.T) {
+	results := []string{"ok", "error", "rejected"}
+	before := make(map[string]float64)
+	for _, result := range results {
+		before[result] = count(t, result)
+	}
+	_, client := newService(t, 503, 500, 200, 400)
+	ctx := context.Background()
+	client.Post(ctx, "/events/x", nil)
+	client.Post(ctx, "/events/x", nil)
+
+	// Every attempt counts, not only the last one of a call
+	want := map[string]float64{"ok": 1, "error": 2, "rejected": 1}
+	for _, result := range results {
+		if got := count(t, result) - before[result]; got != want[result] {
+			t.Errorf("%s requests counted %v times, want %v", result, got, want[result])
+		}
+	}
+}
+
+func TestRouterStarted(t *testing.T) {
+	started := &events.ExperimentStarted{Experiment: "exp", Timestamp: 10}
+	terminated := &events.ExperimentTerminated{Experiment: "exp", Timestamp: 20}
+
+	// As stored by postgres_service for an experiment started before a restart
+	running := `{"id": "exp", "status": "running", "started_at": "1970-01-01T00:00:10Z"}`
+	stabilizing := `{"id": "exp", "status": "stabilizing"}`
+
+	tests := []struct {
+		name      string
+		before    []events.Event
+		stored    string
+		timestamp float64
+		want      bool
+		lookups   int
+	}{
+		{"not started", nil, "", 15, false, 1},
+		{"measured before the start", []events.Event{started}, "", 9.5, false, 0},
+		{"measured at the start", []events.Event{started}, "", 10, true, 0},
+		{"measured after the start", []events.Event{started}, "", 15, true, 0},
+		{"terminated", []events.Event{started, terminated}, "", 15, false, 1},
+		{"started before a restart", nil, running, 15, true, 1},
+		{"measured before the start before a restart", nil, running, 9.5, false, 1},
+		{"stabilizing before a restart", nil, stabilizing, 15, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, postgres := newService(t)
+			stored.experiment = tt.stored
+			average, avgClient := newService(t)
+			router := NewRouter(postgres, avgClient)
+			d := events.NewDispatcher()
+			router.Register(d)
+			for _, event := range tt.before {
+				if err := d.DispatchEvent(context.Background(), event); err != nil {
+					t.Fatalf("DispatchEvent(%s) = %v", event.EventName(), err)
+				}
+			}
+
+			group := aggregate.Group{
+				Topic:         "group2",
+				ExperimentID:  "exp",
+				MeasurementID: "m1",
+				Timestamp:     tt.timestamp,
+				Readings:      []aggregate.Reading{{Sensor: "a", Temperature: 20}, {Sensor: "b", Temperature: 22, Tampered: true}},
+				Partial:       true,
+			}
+			if err := router.ForwardGroup(context.Background(), group); err != nil {
+				t.Fatalf("ForwardGroup() = %v", err)
+			}
+
+			last := len(average.bodies) - 1
+			var got MeasurementGroup
+			if err := json.Unmarshal(average.bodies[last], &got); err != nil {
+				t.Fatal(err)
+			}
+			want := MeasurementGroup{
+				ExperimentID:     "exp",
+				MeasurementID:    "m1",
+				Timestamp:        tt.timestamp,
+				Started:          tt.want,
+				MeasurementCount: 2,
+				Measurements:     []float64{20, 22},
+				Sensors:          []string{"a", "b"},
+				Partial:          true,
+				TamperedCount:    1,
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("forwarded %+v, want %+v", got, want)
+			}
+			if average.paths[last] != "/measurements" || average.topics[last] != "group2" {
+				t.Errorf("forwarded to %s with topic %q", average.paths[last], average.topics[last])
+			}
+
+			// The outcome of a lookup is kept for the next group
+			if err := router.ForwardGroup(context.Background(), group); err != nil {
+				t.Fatalf("ForwardGroup() = %v", err)
+			}
+			if stored.gets != tt.lookups {
+				t.Errorf("%d lookups, want %d", stored.gets, tt.lookups)
+			}
+		})
+	}
+}
+
+func TestRouterForwardGroupTopic(t *testing.T) {
+	_, pgClient := newService(t)
+	average, avgClient := newService(t)
+	router := NewRouter(pgClient, avgClient)
+
+	// Groups emitted by the expiry timer have no topic in their context
+	ctx := events.WithTopic(context.Background(), "unrelated")
+	for _, topic := range []string{"group3", ""} {
+		group := aggregate.Group{Topic: topic, ExperimentID: "exp", MeasurementID: "m1"}
+		if err := router.ForwardGroup(ctx, group); err != nil {
+			t.Fatalf("ForwardGroup() = %v", err)
+		}
+	}
+	if want := []string{"group3", ""}; !reflect.DeepEqual(average.topics, want) {
+		t.Errorf("topic headers %q, want %q", average.topics, want)
+	}
+}
+
+func TestRouterRetriesOnlyTheFailedService(t *testing.T) {
+	tests := []struct {
+		event        events.Event
+		wantPostgres []string
+		wantAverage  []string
+	}{
+		{
+			&events.ExperimentConfigured{Experiment: "exp"},
+			[]string{"/events/experiment_configured"},
+			[]string{"/events/experiment_configured", "/events/experiment_configured"},
+		},
+		{
+			&events.StabilizationStarted{Experiment: "exp"},
+			[]string{"/events/stabilization_started"},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event.EventName(), func(t *testing.T) {
+			postgres, pgClient := newService(t)
+			// average_calc_service rejects the first attempt for good
+			average, avgClient := newService(t, http.StatusBadRequest)
+			router := NewRouter(pgClient, avgClient)
+			d := events.NewDispatcher()
+			router.Register(d)
+
+			var progress events.Progress
+			for attempt := 0; attempt < 2; attempt++ {
+				d.Resume(context.Background(), tt.event, &progress)
+			}
+
+			if !reflect.DeepEqual(postgres.paths, tt.wantPostgres) {
+				t.Errorf("postgres_service got %v, want %v", postgres.paths, tt.wantPostgres)
+			}
+			if !reflect.DeepEqual(average.paths, tt.wantAverage) {
+				t.Errorf("average_calc_service got %v, want %v", average.paths, tt.wantAverage)
+			}
+		})
+	}
+}
+
+func TestRouterReportViolationGivesUp(t *testing.T) {
+	// The postgres client itself would retry forever
+	postgres := &service{statuses: []int{500, 500, 500, 500}}
+	server := httptest.NewServer(postgres)
+	defer server.Close()
+	router := NewRouter(NewClient("postgres_service", server.URL, DefaultRetryPolicy()), nil)
+
+	violation := lifecycle.Violation{ExperimentID: "exp", Kind: lifecycle.Duplicate}
+	if err := router.ReportViolation(context.Background(), violation); err == nil {
+		t.Fatal("ReportViolation() succeeded, want it to give up")
+	}
+	if want := BoundedRetryPolicy().MaxAttempts; len(postgres.paths) != want {
+		t.Errorf("%d attempts, want %d", len(postgres.paths), want)
+	}
+}
+
+func TestRouterSensors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{"configured", http.StatusOK, `{"id": "exp", "sensors": "[\"a\", \"b\"]", "status": "running"}`, []string{"a", "b"}, false},
+		{"terminated", http.StatusOK, `{"id": "exp", "sensors": "[\"a\"]", "status": "terminated"}`, nil, false},
+		{"unknown", http.StatusNotFound, `experiment not found`, nil, true},
+		{"invalid sensors", http.StatusOK, `{"id": "exp", "sensors": "a,b"}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.Method + " " + r.URL.Path
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			router := NewRouter(NewClient("postgres_service", server.URL, DefaultRetryPolicy()), nil)
+
+			got, err := router.Sensors(context.Background(), "exp")
+			if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sensors() = %v, %v, want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+			if path != "GET /experiments/exp" {
+				t.Errorf("requested %s", path)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package forward
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"assignment2/aggregate"
+	"assignment2/events"
+	"assignment2/lifecycle"
+)
+
+// MeasurementGroup is the grouped payload average_calc_service receives
+type MeasurementGroup struct {
+	ExperimentID     string    `json:"experiment_id"`
+	MeasurementID    string    `json:"measurement_id"`
+	Timestamp        float64   `json:"timestamp"`
+	Started          bool      `json:"started"`
+	MeasurementCount int       `json:"measurement_count"`
+	Measurements     []float64 `json:"measurements"`
+	// Sensors holds the sensor of each measurement
+	Sensors []string `json:"sensors"`
+	// Partial is set when not every configured sensor reported in time
+	Partial bool `json:"partial"`
+	// TamperedCount is the number of readings that failed hash verification
+	TamperedCount int `json:"tampered_count"`
+	// Revision is increased each time the group is re-sent corrected with
+	// late readings, a revision replaces the earlier ones
+	Revision int `json:"revision"`
+}
+
+// Router forwards lifecycle events to postgres_service and measurement
+// groups to average_calc_service
+type Router struct {
+	postgres *Client
+	average  *Client
+	// bounded reaches postgres_service with a bounded retry policy, for
+	// violations and lookups whose callers cope with a failure
+	bounded *Client
+
+	mu sync.Mutex
+	// started holds the experiment_started timestamp of running experiments
+	started map[string]float64
+	// misses holds when experiments not found running were looked up
+	misses map[string]time.Time
+}
+
+// lookupRetry is how long an experiment postgres_service did not know as
+// running is not looked up again
+const lookupRetry = time.Minute
+
+// lookupTimeout bounds a lookup, which delays the group that triggered it
+const lookupTimeout = 2 * time.Second
+
+// NewRouter creates a router using the given downstream clients
+func NewRouter(postgres, average *Client) *Router {
+	return &Router{
+		postgres: postgres,
+		average:  average,
+		bounded:  postgres.WithRetry(BoundedRetryPolicy()),
+		started:  make(map[string]float64),
+		misses:   make(map[string]time.Time),
+	}
+}
+
+// Register installs the router as handler for every lifecycle event.
+// Measurements reach the router grouped, through ForwardGroup. Each service
+// gets its own handler, so a failure sending to one does not resend to the
+// other when the event is retried.
+func (r *Router) Register(d *events.Dispatcher) {
+	for _, name := range []string{
+		events.ExperimentConfiguredName,
+		events.StabilizationStartedName,
+		events.ExperimentStartedName,
+		events.ExperimentTerminatedName,
+	} {
+		d.RegisterFunc(name, r.persistEvent)
+		d.RegisterFunc(name, r.announceEvent)
+	}
+}
+
+// persistEvent persists a non-measurement event through postgres_service
+func (r *Router) persistEvent(ctx context.Context, event events.Event) error {
+	return r.postgres.Post(ctx, "/events/"+event.EventName(), event)
+}
+
+// announceEvent tells average_calc_service about the configuration and
+// termination of experiments, to check their averages against the
+// temperature range, and tracks which experiments started
+func (r *Router) announceEvent(ctx context.Context, event events.Event) error {
+	switch e := event.(type) {
+	case *events.ExperimentConfigured:
+		return r.average.Post(ctx, "/events/"+event.EventName(), event)
+	case *events.ExperimentStarted:
+		r.setStarted(e.Experiment, e.Timestamp)
+	case *events.ExperimentTerminated:
+		if err := r.average.Post(ctx, "/events/"+event.EventName(), event); err != nil {
+			return err
+		}
+		r.clearStarted(e.Experiment)
+	}
+	return nil
+}
+
+// ReportViolation persists a lifecycle violation through postgres_service,
+// giving up after a few attempts
+func (r *Router) ReportViolation(ctx context.Context, v lifecycle.Violation) error {
+	return r.bounded.Post(ctx, "/violations", v)
+}
+
+// Experiment is an experiment as stored by postgres_service
+type Experiment struct {
+	ID string `json:"id"`
+	// Sensors is the JSON array of the configured sensor ids
+	Sensors   string     `json:"sensors"`
+	Status    string     `json:"status"`
+	StartedAt *time.Time `json:"started_at"`
+}
+
+// experiment fetches an experiment from postgres_service
+func (r *Router) experiment(ctx context.Context, id string) (*Experiment, error) {
+	var experiment Experiment
+	if err := r.bounded.Get(ctx, "/experiments/"+url.PathEscape(id), &experiment); err != nil {
+		return nil, err
+	}
+	return &experiment, nil
+}
+
+// Sensors looks up the configured sensors of an experiment in
+// postgres_service, for experiments whose experiment_configured event was
+// consumed before a restart. A terminated experiment has none, its
+// readings are late.
+func (r *Router) Sensors(ctx context.Context, id string) ([]string, error) {
+	experiment, err := r.experiment(ctx, id)
+	if err != nil || experiment.Status == "terminated" {
+		return nil, err
+	}
+	var sensors []string
+	if err := json.Unmarshal([]byte(experiment.Sensors), &sensors); err != nil {
+		return nil, fmt.Errorf("invalid sensors of experiment %s: %w", id, err)
+	}
+	return sensors, nil
+}
+
+// ForwardGroup sends a measurement group to average_calc_service. Groups
+// may be emitted outside of event handling, so the topic is taken from the
+// group. A group is started if it was measured after experiment_started,
+// however long the aggregator held it.
+func (r *Router) ForwardGroup(ctx context.Context, group aggregate.Group) error {
+	ctx = events.WithTopic(ctx, group.Topic)
+	measurements := make([]float64, len(group.Readings))
+	sensors := make([]string, len(group.Readings))
+	tampered := 0
+	for i, reading := range group.Readings {
+		measurements[i] = reading.Temperature
+		sensors[i] = reading.Sensor
+		if reading.Tampered {
+			tampered++
+		}
+	}
+
+	return r.average.Post(ctx, "/measurements", MeasurementGroup{
+		ExperimentID:     group.ExperimentID,
+		MeasurementID:    group.MeasurementID,
+		Timestamp:        group.Timestamp,
+		Started:          r.isStarted(ctx, group.ExperimentID, group.Timestamp),
+		MeasurementCount: len(measurements),
+		Measurements:     measurements,
+		Sensors:          sensors,
+		Partial:          group.Partial,
+		TamperedCount:    tampered,
+		Revision:         group.Revision,
+	})
+}
+
+func (r *Router) setStarted(experiment string, at float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started[experiment] = at
+}
+
+func (r *Router) clearStarted(experiment string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.started, experiment)
+}
+
+// isStarted reports whether a measurement taken at timestamp belongs to the
+// running phase of its experiment. An experiment the router did not see
+// start, e.g. because it started before a restart, is looked up in
+// postgres_service.
+func (r *Router) isStarted(ctx context.Context, experiment string, timestamp float64) bool {
+	r.mu.Lock()
+	at, ok := r.started[experiment]
+	r.mu.Unlock()
+	if !ok {
+		at, ok = r.lookupStarted(ctx, experiment)
+	}
+	return ok && timestamp >= at
+}
+
+// lookupStarted returns the start of an experiment postgres_service knows
+// as running. Experiments it does not are not asked for again within
+// lookupRetry.
+func (r *Router) lookupStarted(ctx context.Context, id string) (float64, bool) {
+	r.mu.Lock()
+	now := time.Now()
+	for missed, at := range r.misses {
+		if now.Sub(at) >= lookupRetry {
+			delete(r.misses, missed)
+		}
+	}
+	_, recent := r.misses[id]
+	r.mu.Unlock()
+	if recent {
+		return 0, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	experiment, err := r.experiment(ctx, id)
+	if err != nil || experiment.Status != "running" || experiment.StartedAt == nil {
+		if err != nil {
+			log.Printf("Start of experiment %s unknown, its groups are not started: %v", id, err)
+		}
+		r.mu.Lock()
+		r.misses[id] = time.Now()
+		r.mu.Unlock()
+		return 0, false
+	}
+
+	at := float64(experiment.StartedAt.UnixNano()) / 1e9
+	r.setStarted(id, at)
+	return at, true
+}
@@ -0,0 +1,301 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"assignment2/events"
+)
+
+// State is the lifecycle phase of an experiment
+type State string
+
+const (
+	Unknown     State = "unknown"
+	Configured  State = "configured"
+	Stabilizing State = "stabilizing"
+	Running     State = "running"
+	Terminated  State = "terminated"
+)
+
+// Kind classifies a lifecycle violation
+type Kind string
+
+const (
+	// UnknownExperiment is any event for an experiment that was never configured
+	UnknownExperiment Kind = "unknown_experiment"
+	// AfterTermination is any event for an experiment that already terminated
+	AfterTermination Kind = "after_termination"
+	// Duplicate is a phase event that was already seen
+	Duplicate Kind = "duplicate"
+	// MissingPhase is a phase event that skips an earlier phase
+	MissingPhase Kind = "missing_phase"
+	// OutOfOrder is a phase event for a phase the experiment already left
+	OutOfOrder Kind = "out_of_order"
+	// BeforeStabilization is a measurement for an experiment whose sensors
+	// are not reporting yet
+	BeforeStabilization Kind = "before_stabilization"
+)
+
+// Kinds lists every violation kind
+var Kinds = []Kind{UnknownExperiment, AfterTermination, Duplicate, MissingPhase, OutOfOrder, BeforeStabilization}
+
+// Violation describes an event that does not fit its experiment's lifecycle
+type Violation struct {
+	ExperimentID  string  `json:"experiment_id"`
+	Kind          Kind    `json:"kind"`
+	Event         string  `json:"event"`
+	MeasurementID string  `json:"measurement_id,omitempty"` // set for flagged measurements
+	State         State   `json:"state"`
+	Detail        string  `json:"detail"`
+	Timestamp     float64 `json:"timestamp,omitempty"`
+}
+
+// ReportFunc receives violations that should be persisted
+type ReportFunc func(ctx context.Context, v Violation) error
+
+// phases maps each phase event to the state it moves to, in lifecycle order
+var phases = []struct {
+	event string
+	state State
+}{
+	{events.ExperimentConfiguredName, Configured},
+	{events.StabilizationStartedName, Stabilizing},
+	{events.ExperimentStartedName, Running},
+	{events.ExperimentTerminatedName, Terminated},
+}
+
+type experiment struct {
+	state        State
+	terminatedAt time.Time
+	// lastSeen is the arrival of the latest event, it expires experiments
+	// that were never configured
+	lastSeen time.Time
+	// reported holds the kinds already persisted for measurements, so a
+	// stream of stray readings is counted but reported only once
+	reported map[Kind]bool
+}
+
+// pruneInterval is how often the tracker looks for experiments to forget
+const pruneInterval = time.Minute
+
+// Tracker runs a state machine per experiment
+// (configured -> stabilizing -> running -> terminated) and flags events
+// that do not fit it
+type Tracker struct {
+	report    ReportFunc
+	retention time.Duration
+	now       func() time.Time
+
+	mu          sync.Mutex
+	experiments map[string]*experiment
+	counters    map[Kind]*atomic.Int64
+	pruned      time.Time
+}
+
+// NewTracker creates a tracker. Terminated experiments are remembered for
+// retention to catch late events, experiments that were never configured
+// for retention after their last event. report may be nil.
+func NewTracker(retention time.Duration, report ReportFunc) *Tracker {
+	counters := make(map[Kind]*atomic.Int64, len(Kinds))
+	for _, kind := range Kinds {
+		counters[kind] = &atomic.Int64{}
+	}
+	return &Tracker{
+		report:      report,
+		retention:   retention,
+		now:         time.Now,
+		experiments: make(map[string]*experiment),
+		counters:    counters,
+	}
+}
+
+// Register installs the tracker for every event type. It should be
+// registered first so it sees every event, including rejected ones.
+func (t *Tracker) Register(d *events.Dispatcher) {
+	for _, phase := range phases {
+		d.RegisterFunc(phase.event, t.handle)
+	}
+	d.RegisterFunc(events.SensorTemperatureMeasuredName, t.handle)
+}
+
+// Count returns how many violations of kind were seen
+func (t *Tracker) Count(kind Kind) int64 {
+	return t.counters[kind].Load()
+}
+
+// State returns the current state of an experiment
+func (t *Tracker) State(experimentID string) State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if exp, ok := t.experiments[experimentID]; ok {
+		return exp.state
+	}
+	return Unknown
+}
+
+// Active returns the number of experiments that are configured and not
+// terminated
+func (t *Tracker) Active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	active := 0
+	for _, exp := range t.experiments {
+		if exp.state != Terminated && exp.state != Unknown {
+			active++
+		}
+	}
+	return active
+}
+
+// handle observes the event and reports its violations. Reporting failures
+// are logged only, violations are diagnostics and must not stall the stream.
+func (t *Tracker) handle(ctx context.Context, event events.Event) error {
+	for _, v := range t.Observe(event) {
+		log.Printf("Lifecycle violation in experiment %s: %s %s in state %s: %s",
+			v.ExperimentID, v.Kind, v.Event, v.State, v.Detail)
+		if t.report == nil {
+			continue
+		}
+		if err := t.report(ctx, v); err != nil {
+			log.Printf("Failed to report lifecycle violation: %v", err)
+		}
+	}
+	return nil
+}
+
+// Observe advances the experiment's state machine and returns the
+// violations that should be reported. Every violation is counted, even the
+// ones that are not returned.
+func (t *Tracker) Observe(event events.Event) []Violation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if now.Sub(t.pruned) >= pruneInterval {
+		t.prune(now)
+	}
+
+	id := event.ExperimentID()
+	exp, ok := t.experiments[id]
+	if !ok {
+		exp = &experiment{state: Unknown, reported: make(map[Kind]bool)}
+	}
+	exp.lastSeen = now
+
+	var violations []Violation
+	flag := func(kind Kind, detail string) {
+		t.counters[kind].Add(1)
+		v := Violation{
+			ExperimentID: id,
+			Kind:         kind,
+			Event:        event.EventName(),
+			State:        exp.state,
+			Detail:       detail,
+			Timestamp:    timestamp(event),
+		}
+		if m, ok := event.(*events.SensorTemperatureMeasured); ok {
+			v.MeasurementID = m.MeasurementID
+			if exp.reported[kind] {
+				return
+			}
+			exp.reported[kind] = true
+		}
+		violations = append(violations, v)
+	}
+
+	if event.EventName() == events.SensorTemperatureMeasuredName {
+		switch exp.state {
+		case Unknown:
+			flag(UnknownExperiment, "measurement for an experiment that was never configured")
+		case Configured:
+			flag(BeforeStabilization, "measurement before stabilization started")
+		case Terminated:
+			flag(AfterTermination, "measurement after the experiment terminated")
+		}
+		t.experiments[id] = exp
+		return violations
+	}
+
+	next := phaseIndex(event.EventName())
+	current := stateIndex(exp.state)
+
+	switch {
+	case exp.state == Terminated && next != current:
+		flag(AfterTermination, fmt.Sprintf("%s after the experiment terminated", event.EventName()))
+	case next == current:
+		flag(Duplicate, fmt.Sprintf("%s received twice", event.EventName()))
+	case next < current:
+		flag(OutOfOrder, fmt.Sprintf("%s after the experiment reached %s", event.EventName(), exp.state))
+	case exp.state == Unknown && next > 0:
+		flag(UnknownExperiment, fmt.Sprintf("%s for an experiment that was never configured", event.EventName()))
+	case next > current+1:
+		flag(MissingPhase, fmt.Sprintf("%s without %s", event.EventName(), phases[current+1].event))
+	}
+
+	// Later phases still advance the state so one missing event does not
+	// flag every following one
+	if next > current {
+		exp.state = phases[next].state
+		if exp.state == Terminated {
+			exp.terminatedAt = now
+		}
+	}
+	t.experiments[id] = exp
+	return violations
+}
+
+// prune forgets experiments that terminated longer than retention ago and
+// unknown experiments without events for as long. Must be called with t.mu
+// held.
+func (t *Tracker) prune(now time.Time) {
+	t.pruned = now
+	cutoff := now.Add(-t.retention)
+	for id, exp := range t.experiments {
+		switch {
+		case exp.state == Terminated && exp.terminatedAt.Before(cutoff):
+			delete(t.experiments, id)
+		case exp.state == Unknown && exp.lastSeen.Before(cutoff):
+			delete(t.experiments, id)
+		}
+	}
+}
+
+// phaseIndex returns the position of a phase event in the lifecycle
+func phaseIndex(name string) int {
+	for i, phase := range phases {
+		if phase.event == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// stateIndex returns the position of a state in the lifecycle, -1 for Unknown
+func stateIndex(state State) int {
+	for i, phase := range phases {
+		if phase.state == state {
+			return i
+		}
+	}
+	return -1
+}
+
+func timestamp(event events.Event) float64 {
+	switch e := event.(type) {
+	case *events.StabilizationStarted:
+		return e.Timestamp
+	case *events.ExperimentStarted:
+		return e.Timestamp
+	case *events.SensorTemperatureMeasured:
+		return e.Timestamp
+	case *events.ExperimentTerminated:
+		return e.Timestamp
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,120 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"assignment2/events"
+)
+
+var (
+	configured   = &events.ExperimentConfigured{Experiment: "exp"}
+	stabilizing  = &events.StabilizationStarted{Experiment: "exp", Timestamp: 1}
+	started      = &events.ExperimentStarted{Experiment: "exp", Timestamp: 2}
+	measured     = &events.SensorTemperatureMeasured{Experiment: "exp", Timestamp: 3}
+	terminated   = &events.ExperimentTerminated{Experiment: "exp", Timestamp: 4}
+	fullSequence = []events.Event{configured, stabilizing, started, measured, terminated}
+)
+
+func TestTrackerObserve(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []events.Event
+		want   []Kind // reported violations, in order
+		state  State
+	}{
+		{"full lifecycle", fullSequence, nil, Terminated},
+		{"measurement before configuration", []events.Event{measured}, []Kind{UnknownExperiment}, Unknown},
+		{"stray measurements are reported once", []events.Event{measured, measured, measured}, []Kind{UnknownExperiment}, Unknown},
+		{"measurement before stabilization", []events.Event{configured, measured, measured}, []Kind{BeforeStabilization}, Configured},
+		{"measurement during stabilization", []events.Event{configured, stabilizing, measured}, nil, Stabilizing},
+		{"phase before configuration", []events.Event{stabilizing}, []Kind{UnknownExperiment}, Stabilizing},
+		{"duplicate phase", []events.Event{configured, configured}, []Kind{Duplicate}, Configured},
+		{"skipped phase", []events.Event{configured, started}, []Kind{MissingPhase}, Running},
+		{"earlier phase after a later one", []events.Event{configured, stabilizing, started, stabilizing}, []Kind{OutOfOrder}, Running},
+		{"phase after termination", []events.Event{configured, terminated, started}, []Kind{MissingPhase, AfterTermination}, Terminated},
+		{"measurement after termination", append(fullSequence, measured), []Kind{AfterTermination}, Terminated},
+		{"duplicate termination", append(fullSequence, terminated), []Kind{Duplicate}, Terminated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker(time.Hour, nil)
+			var got []Kind
+			for _, event := range tt.events {
+				for _, v := range tracker.Observe(event) {
+					if v.ExperimentID != "exp" || v.Event != event.EventName() {
+						t.Errorf("violation %+v does not describe %s", v, event.EventName())
+					}
+					got = append(got, v.Kind)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("violations %v, want %v", got, tt.want)
+			}
+			if state := tracker.State("exp"); state != tt.state {
+				t.Errorf("State() = %s, want %s", state, tt.state)
+			}
+		})
+	}
+}
+
+func TestTrackerCountsUnreportedViolations(t *testing.T) {
+	tracker := NewTracker(time.Hour, nil)
+	for range 3 {
+		tracker.Observe(measured)
+	}
+	if got := tracker.Count(UnknownExperiment); got != 3 {
+		t.Errorf("Count(UnknownExperiment) = %d, want 3", got)
+	}
+}
+
+func TestTrackerDropsFailedReports(t *testing.T) {
+	var reported []Kind
+	report := func(ctx context.Context, v Violation) error {
+		reported = append(reported, v.Kind)
+		return errors.New("postgres_service unavailable")
+	}
+	tracker := NewTracker(time.Hour, report)
+
+	// A violation that could not be reported must not hold up the event
+	for _, event := range []events.Event{measured, configured, configured} {
+		if err := tracker.handle(context.Background(), event); err != nil {
+			t.Fatalf("handle(%s) = %v, want the failure dropped", event.EventName(), err)
+		}
+	}
+	if want := []Kind{UnknownExperiment, Duplicate}; !reflect.DeepEqual(reported, want) {
+		t.Errorf("reported %v, want %v", reported, want)
+	}
+}
+
+func TestTrackerPrune(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tracker := NewTracker(time.Hour, nil)
+	tracker.now = func() time.Time { return now }
+
+	for _, event := range fullSequence {
+		tracker.Observe(event)
+	}
+	tracker.Observe(&events.ExperimentConfigured{Experiment: "active"})
+	tracker.Observe(&events.SensorTemperatureMeasured{Experiment: "stray"})
+	if got := tracker.Active(); got != 1 {
+		t.Errorf("Active() = %d, want 1", got)
+	}
+
+	now = now.Add(2 * time.Hour)
+	tracker.Observe(&events.StabilizationStarted{Experiment: "active"})
+
+	want := map[string]State{"exp": Unknown, "stray": Unknown, "active": Stabilizing}
+	for id, state := range want {
+		if got := tracker.State(id); got != state {
+			t.Errorf("State(%s) = %s after retention, want %s", id, got, state)
+		}
+	}
+	// A late measurement of the forgotten experiment is unknown again
+	if vs := tracker.Observe(measured); len(vs) != 1 || vs[0].Kind != UnknownExperiment {
+		t.Errorf("violations after pruning %+v, want %s", vs, UnknownExperiment)
+	}
+}
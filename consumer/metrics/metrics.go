@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every consumer metric. It is separate from the default
+// registry so only the pipeline's own metrics and the process and Go
+// runtime collectors are exposed.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// MessagesConsumed counts fetched messages per topic
+	MessagesConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_messages_total",
+		Help: "Messages fetched from the source.",
+	}, []string{"topic"})
+
+	// RecordsConsumed counts decoded records per event type
+	RecordsConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_records_total",
+		Help: "Records decoded from fetched messages, by event type.",
+	}, []string{"event"})
+
+	// DecodeFailures counts messages that could not be decoded
+	DecodeFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "consumer_decode_failures_total",
+		Help: "Messages whose OCF container could not be decoded.",
+	})
+
+	// DeadLettered counts messages moved to the dead-letter store
+	DeadLettered = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "consumer_dead_lettered_total",
+		Help: "Messages that could never be processed and were dead-lettered.",
+	})
+
+	// PartitionLag is the number of messages behind the high-water mark
+	PartitionLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consumer_partition_lag",
+		Help: "Messages between the last fetched offset and the partition's high-water mark.",
+	}, []string{"topic", "partition"})
+
+	// ProcessingSeconds is the time from fetching a message until every
+	// record in it was handled
+	ProcessingSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "consumer_message_processing_seconds",
+		Help:    "Time from fetching a message until all its records were handled, including queueing and retries.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	})
+
+	// HandlingSeconds is the time the handlers took for one record
+	HandlingSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "consumer_event_handling_seconds",
+		Help:    "Time the handlers took for a single record including retries, by event type.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 4, 10),
+	}, []string{"event"})
+
+	// ForwardRequests counts requests to the downstream services by outcome
+	ForwardRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consumer_forward_requests_total",
+		Help: "Requests to downstream services, by service and result (ok, error or rejected).",
+	}, []string{"service", "result"})
+
+	// ForwardSeconds is the duration of single downstream requests
+	ForwardSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "consumer_forward_request_seconds",
+		Help:    "Duration of a single request to a downstream service.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"service"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		prometheus.NewGoCollector(),
+		MessagesConsumed,
+		RecordsConsumed,
+		DecodeFailures,
+		DeadLettered,
+		PartitionLag,
+		ProcessingSeconds,
+		HandlingSeconds,
+		ForwardRequests,
+		ForwardSeconds,
+	)
+}
+
+// CounterFunc registers a counter whose value is read from fn on every scrape
+func CounterFunc(name, help string, labels map[string]string, fn func() float64) {
+	Registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name:        name,
+		Help:        help,
+		ConstLabels: labels,
+	}, fn))
+}
+
+// GaugeFunc registers a gauge whose value is read from fn on every scrape
+func GaugeFunc(name, help string, fn func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: name,
+		Help: help,
+	}, fn))
+}
+
+// Serve exposes /metrics on addr until ctx is cancelled
+func Serve(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	log.Printf("Serving metrics on %s/metrics", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Metrics server failed: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	DecodeFailures.Inc()
+	MessagesConsumed.WithLabelValues("group2").Add(2)
+	CounterFunc("consumer_test_readings_total", "Readings seen by the test.", map[string]string{"result": "ok"}, func() float64 { return 3 })
+	GaugeFunc("consumer_test_pending", "Pending items of the test.", func() float64 { return 5 })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	go func() {
+		Serve(ctx, addr)
+		close(served)
+	}()
+
+	var body string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			continue
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		body = string(data)
+		break
+	}
+	for _, want := range []string{
+		`consumer_messages_total{topic="group2"} 2`,
+		"consumer_decode_failures_total 1",
+		`consumer_test_readings_total{result="ok"} 3`,
+		"consumer_test_pending 5",
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics lacks %q", want)
+		}
+	}
+
+	cancel()
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Error("Serve() still running after its context was cancelled")
+	}
+}
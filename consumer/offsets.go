@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"assignment2/source"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// partitionOffsets holds the uncommitted offsets of a partition
+type partitionOffsets struct {
+	fetched []int64 // in fetch order
+	done    map[int64]bool
+	holds   map[int64]int // unreleased holds by offset
+}
+
+// offsetTracker commits offsets in fetch order although workers finish
+// messages out of order: a message is committed only once it and every
+// message fetched before it from the same partition are done. A message
+// whose events are kept beyond their handling, such as readings in a
+// pending group, is held until they are emitted.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[topicPartition]*partitionOffsets
+
+	ready    chan struct{}
+	stop     chan struct{}
+	finished chan struct{}
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: make(map[topicPartition]*partitionOffsets),
+		ready:      make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		finished:   make(chan struct{}),
+	}
+}
+
+// Add records a fetched message, it must be called in fetch order
+func (t *offsetTracker) Add(msg kafka.Message) {
+	key := topicPartition{msg.Topic, msg.Partition}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	po, ok := t.partitions[key]
+	if !ok {
+		po = &partitionOffsets{done: make(map[int64]bool), holds: make(map[int64]int)}
+		t.partitions[key] = po
+	}
+	po.fetched = append(po.fetched, msg.Offset)
+}
+
+// Done marks a message as processed
+func (t *offsetTracker) Done(msg kafka.Message) {
+	t.mu.Lock()
+	if po, ok := t.partitions[topicPartition{msg.Topic, msg.Partition}]; ok {
+		po.done[msg.Offset] = true
+	}
+	t.mu.Unlock()
+	t.notify()
+}
+
+// Hold keeps a message uncommitted, even once it is done, until the
+// returned function is called. Releasing more than once has no effect.
+func (t *offsetTracker) Hold(msg kafka.Message) (release func()) {
+	key := topicPartition{msg.Topic, msg.Partition}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	po, ok := t.partitions[key]
+	if !ok {
+		return func() {}
+	}
+	po.holds[msg.Offset]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			if po.holds[msg.Offset]--; po.holds[msg.Offset] <= 0 {
+				delete(po.holds, msg.Offset)
+			}
+			t.mu.Unlock()
+			t.notify()
+		})
+	}
+}
+
+// notify wakes Run up to commit
+func (t *offsetTracker) notify() {
+	select {
+	case t.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Run commits finished offsets until ctx is cancelled or Close is called
+func (t *offsetTracker) Run(ctx context.Context, src source.Source) {
+	defer close(t.finished)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.ready:
+			t.commit(ctx, src)
+		case <-t.stop:
+			t.commit(ctx, src)
+			return
+		}
+	}
+}
+
+// Close commits what is left and stops Run
+func (t *offsetTracker) Close() {
+	close(t.stop)
+	<-t.finished
+}
+
+// commit commits the newest message of every partition that has no
+// unfinished message before it
+func (t *offsetTracker) commit(ctx context.Context, src source.Source) {
+	msgs := t.take()
+	if len(msgs) == 0 {
+		return
+	}
+
+	err := retry(ctx, fmt.Sprintf("commit of %d partitions", len(msgs)), func() error {
+		return src.Commit(ctx, msgs...)
+	})
+	if err != nil {
+		log.Printf("Failed to commit offsets: %v", err)
+	}
+}
+
+// take removes the finished prefix of every partition and returns the last
+// message of each. A message is finished once it is done and not held.
+func (t *offsetTracker) take() []kafka.Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var msgs []kafka.Message
+	for key, po := range t.partitions {
+		n := 0
+		for n < len(po.fetched) && po.done[po.fetched[n]] && po.holds[po.fetched[n]] == 0 {
+			delete(po.done, po.fetched[n])
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		msgs = append(msgs, kafka.Message{Topic: key.topic, Partition: key.partition, Offset: po.fetched[n-1]})
+		po.fetched = po.fetched[n:]
+	}
+	return msgs
+}
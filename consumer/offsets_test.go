@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func message(partition int, offset int64) kafka.Message {
+	return kafka.Message{Topic: "t", Partition: partition, Offset: offset}
+}
+
+// committed returns the partition -> offset of the messages take returns
+func committed(msgs []kafka.Message) map[int]int64 {
+	offsets := make(map[int]int64)
+	for _, msg := range msgs {
+		offsets[msg.Partition] = msg.Offset
+	}
+	return offsets
+}
+
+func TestOffsetTrackerTake(t *testing.T) {
+	tests := []struct {
+		name    string
+		fetched []kafka.Message
+		done    []kafka.Message
+		held    []kafka.Message
+		want    map[int]int64
+	}{
+		{
+			name:    "nothing done",
+			fetched: []kafka.Message{message(0, 1), message(0, 2)},
+			want:    map[int]int64{},
+		},
+		{
+			name:    "done prefix",
+			fetched: []kafka.Message{message(0, 1), message(0, 2), message(0, 3)},
+			done:    []kafka.Message{message(0, 1), message(0, 2)},
+			want:    map[int]int64{0: 2},
+		},
+		{
+			name:    "gap stops the prefix",
+			fetched: []kafka.Message{message(0, 1), message(0, 2), message(0, 3)},
+			done:    []kafka.Message{message(0, 1), message(0, 3)},
+			want:    map[int]int64{0: 1},
+		},
+		{
+			name:    "partitions are independent",
+			fetched: []kafka.Message{message(0, 1), message(1, 7), message(0, 2), message(1, 8)},
+			done:    []kafka.Message{message(0, 2), message(1, 7), message(1, 8)},
+			want:    map[int]int64{1: 8},
+		},
+		{
+			name:    "held message stops the prefix",
+			fetched: []kafka.Message{message(0, 1), message(0, 2), message(0, 3)},
+			done:    []kafka.Message{message(0, 1), message(0, 2), message(0, 3)},
+			held:    []kafka.Message{message(0, 2)},
+			want:    map[int]int64{0: 1},
+		},
+		{
+			name:    "hold of an unknown partition is ignored",
+			fetched: []kafka.Message{message(0, 1)},
+			done:    []kafka.Message{message(0, 1)},
+			held:    []kafka.Message{message(3, 1)},
+			want:    map[int]int64{0: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			for _, msg := range tt.fetched {
+				tracker.Add(msg)
+			}
+			for _, msg := range tt.held {
+				tracker.Hold(msg)
+			}
+			for _, msg := range tt.done {
+				tracker.Done(msg)
+			}
+
+			if got := committed(tracker.take()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("take() = %v, want %v", got, tt.want)
+			}
+			if got := tracker.take(); len(got) != 0 {
+				t.Errorf("second take() = %v, want nothing", got)
+			}
+		})
+	}
+}
+
+func TestOffsetTrackerRelease(t *testing.T) {
+	tracker := newOffsetTracker()
+	for offset := int64(1); offset <= 3; offset++ {
+		tracker.Add(message(0, offset))
+	}
+
+	// Two readings of offset 2 are held, releasing one is not enough and
+	// releasing the same hold twice does not count for the other
+	first := tracker.Hold(message(0, 2))
+	second := tracker.Hold(message(0, 2))
+	for offset := int64(1); offset <= 3; offset++ {
+		tracker.Done(message(0, offset))
+	}
+
+	steps := []struct {
+		release func()
+		want    map[int]int64
+	}{
+		{func() {}, map[int]int64{0: 1}},
+		{first, map[int]int64{}},
+		{first, map[int]int64{}},
+		{second, map[int]int64{0: 3}},
+	}
+	for i, step := range steps {
+		step.release()
+		if got := committed(tracker.take()); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: take() = %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+// commitRecorder is a source that records committed offsets
+type commitRecorder struct {
+	mu      sync.Mutex
+	commits []int64
+}
+
+func (s *commitRecorder) Fetch(ctx context.Context) (kafka.Message, error) {
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (s *commitRecorder) Commit(ctx context.Context, msgs ...kafka.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, msg := range msgs {
+		s.commits = append(s.commits, msg.Offset)
+	}
+	return nil
+}
+
+func (s *commitRecorder) Close() error { return nil }
+
+func TestOffsetTrackerCloseCommitsFinished(t *testing.T) {
+	tracker := newOffsetTracker()
+	src := &commitRecorder{}
+	go tracker.Run(context.Background(), src)
+
+	for offset := int64(1); offset <= 3; offset++ {
+		tracker.Add(message(0, offset))
+	}
+	tracker.Done(message(0, 1))
+	tracker.Done(message(0, 2))
+	tracker.Close()
+
+	sort.Slice(src.commits, func(i, j int) bool { return src.commits[i] < src.commits[j] })
+	if n := len(src.commits); n == 0 || src.commits[n-1] != 2 {
+		t.Errorf("committed %v, want up to offset 2", src.commits)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"assignment2/deadletter"
+	"assignment2/events"
+	"assignment2/metrics"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// job is a fetched message on its way to a worker
+type job struct {
+	msg     kafka.Message
+	fetched time.Time
+	events  []events.Event
+	// err is set when the message failed to decode, it is dead-lettered
+	err error
+}
+
+// workerPool handles messages on a fixed number of workers. Every
+// experiment is pinned to one worker, so its events are handled in the order
+// they were fetched while different experiments run in parallel. Each worker
+// has a bounded queue: a slow experiment stalls fetching instead of
+// buffering without limit.
+type workerPool struct {
+	proc        *processor
+	deadLetters deadletter.Store
+	offsets     *offsetTracker
+	cancel      context.CancelCauseFunc
+
+	queues []chan job
+	wg     sync.WaitGroup
+}
+
+// newWorkerPool starts workers goroutines with queueSize jobs of buffer
+// each. A worker that cannot go on cancels ctx through cancel with the
+// reason.
+func newWorkerPool(ctx context.Context, cancel context.CancelCauseFunc, workers, queueSize int, proc *processor, deadLetters deadletter.Store, offsets *offsetTracker) *workerPool {
+	p := &workerPool{
+		proc:        proc,
+		deadLetters: deadLetters,
+		offsets:     offsets,
+		cancel:      cancel,
+		queues:      make([]chan job, workers),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan job, queueSize)
+		p.wg.Add(1)
+		go p.run(ctx, p.queues[i])
+	}
+	return p
+}
+
+// Submit queues j on the worker of its experiment, blocking while that
+// worker's queue is full
+func (p *workerPool) Submit(ctx context.Context, j job) error {
+	select {
+	case p.queues[p.worker(j)] <- j:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// Close lets the workers finish their queues and waits for them
+func (p *workerPool) Close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+// worker picks the queue of a job by its experiment. Messages that did not
+// decode have no experiment and are spread by key and partition instead.
+func (p *workerPool) worker(j job) int {
+	h := fnv.New32a()
+	if len(j.events) > 0 {
+		h.Write([]byte(j.events[0].ExperimentID()))
+	} else {
+		fmt.Fprintf(h, "%s/%d", j.msg.Key, j.msg.Partition)
+	}
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+func (p *workerPool) run(ctx context.Context, queue <-chan job) {
+	defer p.wg.Done()
+	for j := range queue {
+		if err := p.handle(ctx, j); err != nil {
+			p.cancel(err)
+			return
+		}
+		p.offsets.Done(j.msg)
+		metrics.ProcessingSeconds.Observe(time.Since(j.fetched).Seconds())
+	}
+}
+
+// handle processes a job, dead-lettering it if that can never succeed. An
+// error means the message was neither processed nor dead-lettered and its
+// offset must stay uncommitted.
+func (p *workerPool) handle(ctx context.Context, j job) error {
+	msg := j.msg
+	err := j.err
+	if err == nil {
+		// Handlers that keep events, like the aggregator, hold the message
+		// so its offset is only committed once they are emitted
+		holdCtx := events.WithHold(ctx, func() func() { return p.offsets.Hold(msg) })
+		err = p.proc.handle(holdCtx, msg, j.events)
+	}
+	if err == nil {
+		return nil
+	}
+	if !isPermanent(err) {
+		// Only cancellation ends the retries
+		return fmt.Errorf("stopped processing partition %d offset %d: %w", msg.Partition, msg.Offset, err)
+	}
+
+	// Retrying cannot help, move the message aside so it can be re-driven later
+	log.Printf("Dead-lettering message at partition %d offset %d: %v", msg.Partition, msg.Offset, err)
+	metrics.DeadLettered.Inc()
+	if p.deadLetters == nil {
+		log.Printf("No dead-letter store configured, skipping %s partition %d offset %d (%d bytes)",
+			msg.Topic, msg.Partition, msg.Offset, len(msg.Value))
+		return nil
+	}
+	entry := deadletter.NewEntry(msg, err)
+	err = retry(ctx, fmt.Sprintf("dead-lettering of partition %d offset %d", msg.Partition, msg.Offset), func() error {
+		return p.deadLetters.Put(ctx, entry)
+	})
+	if err != nil {
+		return fmt.Errorf("stopped dead-lettering partition %d offset %d: %w", msg.Partition, msg.Offset, err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"assignment2/events"
+	"assignment2/forward"
+	"assignment2/metrics"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Backoff bounds used while a message or commit is retried
+const (
+	minRetryBackoff = 200 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+)
+
+// decodeError marks a message whose bytes cannot be turned into events.
+// Retrying such a message can never succeed.
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string { return e.err.Error() }
+func (e *decodeError) Unwrap() error { return e.err }
+
+// processor decodes OCF containers and hands every record to the dispatcher
+type processor struct {
+	decoder    *events.OCFDecoder
+	dispatcher *events.Dispatcher
+}
+
+// decode reads every record of the OCF container in value into typed events
+func (p *processor) decode(value []byte) ([]events.Event, error) {
+	decoded, err := p.decodeOCF(value)
+	if err != nil {
+		metrics.DecodeFailures.Inc()
+		return nil, err
+	}
+	for _, event := range decoded {
+		metrics.RecordsConsumed.WithLabelValues(event.EventName()).Inc()
+	}
+	return decoded, nil
+}
+
+func (p *processor) decodeOCF(value []byte) ([]events.Event, error) {
+	decoded, err := p.decoder.Decode(value)
+	if err != nil {
+		return nil, &decodeError{err}
+	}
+	return decoded, nil
+}
+
+// handle dispatches the decoded records of msg with its topic in the
+// context. The message only counts as processed once every record was
+// accepted by its handlers, so a handler that fails transiently is retried
+// until it succeeds or ctx is cancelled. Neither the records nor the
+// handlers of a record that already succeeded are run again.
+func (p *processor) handle(ctx context.Context, msg kafka.Message, decoded []events.Event) error {
+	ctx = events.WithTopic(ctx, msg.Topic)
+	for _, event := range decoded {
+		start := time.Now()
+		var progress events.Progress
+		err := retry(ctx, fmt.Sprintf("%s at partition %d offset %d", event.EventName(), msg.Partition, msg.Offset), func() error {
+			err := p.dispatcher.Resume(ctx, event, &progress)
+			if isPermanent(err) {
+				return stopRetry{err}
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		metrics.HandlingSeconds.WithLabelValues(event.EventName()).Observe(time.Since(start).Seconds())
+	}
+	return nil
+}
+
+// isPermanent reports whether retrying err can never succeed
+func isPermanent(err error) bool {
+	var decodeErr *decodeError
+	return errors.As(err, &decodeErr) ||
+		errors.Is(err, forward.ErrPermanent) ||
+		errors.Is(err, events.ErrUnknownEvent) ||
+		errors.Is(err, events.ErrNoHandler)
+}
+
+// stopRetry wraps an error that must end a retry loop immediately
+type stopRetry struct {
+	err error
+}
+
+func (e stopRetry) Error() string { return e.err.Error() }
+func (e stopRetry) Unwrap() error { return e.err }
+
+// retry calls fn with exponential backoff until it succeeds, returns a
+// stopRetry error or ctx is cancelled
+func retry(ctx context.Context, what string, fn func() error) error {
+	backoff := minRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		var stop stopRetry
+		if errors.As(err, &stop) {
+			return stop.err
+		}
+
+		log.Printf("Processing %s failed (attempt %d), retrying in %v: %v", what, attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"assignment2/events"
+	"assignment2/metrics"
+	"assignment2/simulate"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func value(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestProcessorDecodeCounts(t *testing.T) {
+	decoder, err := events.NewOCFDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &processor{decoder: decoder, dispatcher: events.NewDispatcher()}
+	encoder, err := simulate.NewEncoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	container, err := encoder.Encode(simulate.Event{
+		Name:   events.ExperimentStartedName,
+		Record: map[string]interface{}{"experiment": "exp", "timestamp": 1.0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := metrics.RecordsConsumed.WithLabelValues(events.ExperimentStartedName)
+	recordsBefore, failuresBefore := value(t, records), value(t, metrics.DecodeFailures)
+
+	if _, err := p.decode(container); err != nil {
+		t.Fatalf("decode() = %v", err)
+	}
+	if _, err := p.decode([]byte("not a container")); err == nil || !isPermanent(err) {
+		t.Errorf("decode() of garbage = %v, want a permanent error", err)
+	}
+
+	if got := value(t, records) - recordsBefore; got != 1 {
+		t.Errorf("%v experiment_started records counted, want 1", got)
+	}
+	if got := value(t, metrics.DecodeFailures) - failuresBefore; got != 1 {
+		t.Errorf("%v decode failures counted, want 1", got)
+	}
+}
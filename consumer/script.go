@@ -1,123 +1,467 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
+
+	"assignment2/aggregate"
+	"assignment2/capture"
+	"assignment2/config"
+	"assignment2/deadletter"
+	"assignment2/dedup"
+	"assignment2/events"
+	"assignment2/forward"
+	"assignment2/lifecycle"
+	"assignment2/metrics"
+	"assignment2/sink"
+	"assignment2/source"
+	"assignment2/verify"
 
-	"github.com/linkedin/goavro/v2"
 	"github.com/segmentio/kafka-go"
 )
 
+// errShutdown is the cause of stopping to fetch on a signal
+var errShutdown = errors.New("shutdown requested")
+
+// lifecycleRetention is how long terminated experiments are remembered to
+// flag late events
+const lifecycleRetention = time.Hour
+
 func main() {
-	if len(os.Args) < 3 {
-		log.Fatal("Usage: go run main.go <topic> <consumer_group>")
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Usage: consumer [flags] <topic> <consumer_group>: %v", err)
 	}
 
-	topic := os.Args[1]
-	consumerGroup := os.Args[2]
+	src, err := newSource(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open %s source: %v", cfg.Source, err)
+	}
+	defer src.Close()
+
+	// Processing stops on a fatal error or once draining exceeds the
+	// deadline, fetching already on the first signal
+	workCtx, stopWork := context.WithCancelCause(context.Background())
+	defer stopWork(nil)
+	fetchCtx, stopFetching := context.WithCancelCause(workCtx)
+	defer stopFetching(nil)
+	go handleSignals(stopFetching, stopWork, cfg.ShutdownTimeout)
+
+	// Route events to the downstream services
+	postgres := forward.NewClient("postgres_service", cfg.PostgresServiceURL, forward.DefaultRetryPolicy())
+	router := forward.NewRouter(
+		postgres,
+		forward.NewClient("average_calc_service", cfg.AvgCalcServiceURL, forward.DefaultRetryPolicy()),
+	)
+	dispatcher := events.NewDispatcher()
 
-	// Load CA certificate
-	caCert, err := os.ReadFile("auth/ca.crt")
+	// Check every event against its experiment's lifecycle first, so even
+	// readings rejected later are tracked
+	var report lifecycle.ReportFunc
+	if cfg.Forward {
+		report = router.ReportViolation
+	}
+	tracker := lifecycle.NewTracker(lifecycleRetention, report)
+	tracker.Register(dispatcher)
+
+	// Verify measurement hashes before anything else sees the reading
+	hashStage, err := newHashStage(cfg)
 	if err != nil {
-		log.Fatalf("Failed to read CA certificate: %v", err)
+		log.Fatalf("Failed to set up measurement hash verification: %v", err)
+	}
+	if hashStage != nil {
+		hashStage.Register(dispatcher)
 	}
 
-	caCertPool := x509.NewCertPool()
-	if !caCertPool.AppendCertsFromPEM(caCert) {
-		log.Fatal("Failed to parse CA certificate")
+	// Sinks see every event that passed verification, marked as tampered
+	// if the hash policy says so
+	sinks, err := sink.Open(cfg.Sinks)
+	if err != nil {
+		log.Fatalf("Failed to set up sinks: %v", err)
+	}
+	defer sinks.Close()
+	for _, s := range sinks {
+		// One handler per sink, so a retry after one sink failed does not
+		// write the event to the others twice
+		sink.Register(dispatcher, s)
 	}
 
-	// Load client certificate and key
-	cert, err := tls.LoadX509KeyPair("auth/kafka-cert.pem", "auth/kafka-key.pem")
+	// Group measurements before the router sees them; registered first so a
+	// terminated experiment's last groups are flushed before it is marked
+	// done. Redelivered readings are dropped before a group is forwarded.
+	var keyStore dedup.Store
+	if cfg.DedupDurable && cfg.Forward {
+		keyStore = dedup.NewHTTPStore(postgres)
+	}
+	filter := dedup.NewFilter(dedup.NewCache(cfg.DedupCacheSize), keyStore, router.ForwardGroup)
+	emit := filter.Emit
+	if hashStage != nil {
+		// A measurement's hash attests the whole group, so its temperature
+		// is checked once the group is complete
+		emit = hashStage.Group(emit)
+	}
+	eventTime, err := newEventTime(cfg)
 	if err != nil {
-		log.Fatalf("Failed to load client certificate: %v", err)
-	}
-
-	tlsConfig := &tls.Config{
-		Certificates:       []tls.Certificate{cert},
-		RootCAs:            caCertPool,
-		InsecureSkipVerify: true,
-	}
-
-	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{
-			"kafka1.dlandau.nl:19092",
-			"kafka2.dlandau.nl:29092",
-			"kafka3.dlandau.nl:39092",
-		},
-		Topic:       topic,
-		GroupID:     consumerGroup,
-		StartOffset: kafka.LastOffset,
-		Dialer: &kafka.Dialer{
-			TLS: tlsConfig,
-		},
-	})
+		log.Fatalf("Failed to set up late reading handling: %v", err)
+	}
+	aggregator := aggregate.New(cfg.GroupTimeout, emit, eventTime)
+	if cfg.Forward {
+		// Experiments configured before a restart are looked up
+		aggregator.LookupSensors(router.Sensors)
+		aggregator.Register(dispatcher)
+		router.Register(dispatcher)
+	}
+	go aggregator.Run(workCtx, cfg.GroupTimeout/4)
+
+	decoder, err := events.NewOCFDecoder()
+	if err != nil {
+		log.Fatalf("Failed to set up decoder: %v", err)
+	}
 
-	defer r.Close()
+	if cfg.MetricsAddr != "" {
+		registerMetrics(decoder, tracker, hashStage, filter, aggregator)
+		go metrics.Serve(context.Background(), cfg.MetricsAddr)
+	}
 
-	// Handle graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	if cfg.Source == "kafka" {
+		fmt.Printf("Consumer started for topic: %s, group: %s\n", strings.Join(cfg.Topics, ","), cfg.GroupID)
+	} else {
+		fmt.Printf("Consumer started replaying %s source: %s\n", cfg.Source, cfg.SourcePath)
+	}
 
-	go func() {
-		<-sigChan
-		fmt.Println("\nEXITING SAFELY!")
-		r.Close()
-		os.Exit(0)
-	}()
+	deadLetters, err := newDeadLetterStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up dead-letter store: %v", err)
+	}
+	if deadLetters != nil {
+		defer deadLetters.Close()
+	}
+
+	var recorder *capture.Recorder
+	if cfg.RecordDir != "" {
+		if recorder, err = capture.NewRecorder(cfg.RecordDir, cfg.RecordMaxBytes); err != nil {
+			log.Fatalf("Failed to set up recorder: %v", err)
+		}
+		defer recorder.Close()
+	}
 
-	fmt.Printf("Consumer started for topic: %s, group: %s\n", topic, consumerGroup)
+	proc := &processor{decoder: decoder, dispatcher: dispatcher}
+
+	// Messages are handled in parallel, offsets are committed in order
+	offsets := newOffsetTracker()
+	go offsets.Run(workCtx, src)
+	pool := newWorkerPool(workCtx, stopWork, cfg.Workers, cfg.WorkerQueueSize, proc, deadLetters, offsets)
 
 	for {
-		msg, err := r.ReadMessage(context.Background())
+		// Fetch without committing, the offset is committed once every
+		// record of the container was handled
+		msg, err := src.Fetch(fetchCtx)
+		if errors.Is(err, source.ErrEOF) || fetchCtx.Err() != nil {
+			break
+		}
 		if err != nil {
 			log.Printf("Consumer error: %v", err)
 			continue
 		}
-
-		// Decode OCF message
-		ocfReader, err := goavro.NewOCFReader(bytes.NewReader(msg.Value))
-		if err != nil {
-			log.Printf("Failed to create OCF reader: %v", err)
-			fmt.Printf("Raw message: %x\n", msg.Value)
-			continue
+		fetched := time.Now()
+		metrics.MessagesConsumed.WithLabelValues(msg.Topic).Inc()
+		if msg.HighWaterMark > 0 {
+			metrics.PartitionLag.WithLabelValues(msg.Topic, strconv.Itoa(msg.Partition)).Set(float64(msg.HighWaterMark - msg.Offset - 1))
 		}
 
-		// Read all records from the OCF container
-		for ocfReader.Scan() {
-			record, err := ocfReader.Read()
+		if recorder != nil {
+			err := retry(workCtx, fmt.Sprintf("capture of partition %d offset %d", msg.Partition, msg.Offset), func() error {
+				return recorder.Write(msg)
+			})
 			if err != nil {
-				log.Printf("Failed to read record: %v", err)
+				stopWork(fmt.Errorf("stopped capturing partition %d offset %d: %w", msg.Partition, msg.Offset, err))
 				break
 			}
+		}
 
-			// Print the schema name
-			schema := ocfReader.Codec().Schema()
-			var schemaMap map[string]interface{}
-			if err := json.Unmarshal([]byte(schema), &schemaMap); err != nil {
-				log.Printf("Failed to parse schema: %v", err)
-			} else {
-				fmt.Printf("%s\n", schemaMap["name"].(string))
-			}
+		decoded, err := proc.decode(msg.Value)
+		offsets.Add(msg)
+		if err := pool.Submit(fetchCtx, job{msg: msg, fetched: fetched, events: decoded, err: err}); err != nil {
+			break
+		}
+	}
 
-			jsonData, err := json.Marshal(record)
-			if err != nil {
-				log.Printf("Failed to marshal record: %v", err)
-				continue
-			}
-			fmt.Printf("%s\n", string(jsonData))
+	// Finish the messages already handed to the workers
+	pool.Close()
+	defer logSummary(tracker, hashStage, filter, aggregator)
+	if err := context.Cause(workCtx); err != nil {
+		// Uncommitted offsets are redelivered on the next start
+		log.Printf("Consumer stopped: %v", err)
+		return
+	}
+
+	// The source is exhausted or the consumer is shutting down, emit
+	// whatever groups are still waiting before the last commit
+	if err := aggregator.Flush(workCtx); err != nil {
+		log.Printf("Failed to flush measurement groups: %v", err)
+	}
+	offsets.Close()
+	if errors.Is(context.Cause(fetchCtx), errShutdown) {
+		log.Println("Drained, exiting")
+	} else {
+		log.Println("Source exhausted, exiting")
+	}
+}
+
+// handleSignals stops fetching on the first SIGTERM or SIGINT, and stops
+// processing if draining takes longer than timeout or a second signal arrives
+func handleSignals(stopFetching, stopWork context.CancelCauseFunc, timeout time.Duration) {
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+
+	sig := <-sigChan
+	fmt.Println("\nEXITING SAFELY!")
+	log.Printf("Received %v, draining for at most %v", sig, timeout)
+	stopFetching(errShutdown)
+
+	select {
+	case <-time.After(timeout):
+		stopWork(fmt.Errorf("draining did not finish within %v", timeout))
+	case sig := <-sigChan:
+		stopWork(fmt.Errorf("received %v while draining", sig))
+	}
+}
+
+// logSummary logs the counters of the pipeline stages. hashStage may be nil.
+func logSummary(tracker *lifecycle.Tracker, hashStage *verify.Stage, filter *dedup.Filter, aggregator *aggregate.Aggregator) {
+	for _, kind := range lifecycle.Kinds {
+		if count := tracker.Count(kind); count > 0 {
+			log.Printf("Lifecycle violations %s: %d", kind, count)
+		}
+	}
+	if hashStage != nil {
+		counters := hashStage.Counters()
+		log.Printf("Measurement hashes: %d verified, %d tampered, %d malformed, %d unverifiable",
+			counters.Verified.Load(), counters.Tampered.Load(), counters.Malformed.Load(), counters.Unverifiable.Load())
+	}
+	log.Printf("Duplicate readings dropped: %d", filter.Duplicates())
+	late := aggregator.Counters()
+	log.Printf("Late readings: %d, %d dropped, %d groups corrected",
+		late.Late.Load(), late.Dropped.Load(), late.Corrected.Load())
+}
+
+// newKafkaSource resolves the topic pattern, moves the consumer group to the
+// configured start position and opens a reader on it, bounded to the current
+// high-water marks in one-shot mode
+func newKafkaSource(cfg *config.Config, dialer *kafka.Dialer) (source.Source, error) {
+	position, err := source.ParsePosition(cfg.StartPosition, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	client, err := cfg.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if cfg.TopicPattern != nil {
+		// Topics created later are only picked up on the next start
+		topics, err := source.MatchTopics(ctx, client, cfg.TopicPattern)
+		if err != nil {
+			return nil, err
+		}
+		if topics = withoutTopic(topics, cfg.DeadLetterTopic); len(topics) == 0 {
+			return nil, fmt.Errorf("no topic matches %s", cfg.TopicPattern)
+		}
+		cfg.Topics = topics
+	}
+	if err := source.ResetGroup(ctx, client, cfg.GroupID, cfg.Topics, position); err != nil {
+		return nil, err
+	}
+
+	startOffset, _ := cfg.KafkaStartOffset()
+	src := source.NewKafkaSource(kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cfg.Brokers,
+		GroupTopics: cfg.Topics,
+		GroupID:     cfg.GroupID,
+		StartOffset: startOffset,
+		Dialer:      dialer,
+	}))
+	if !cfg.OneShot {
+		return src, nil
+	}
+
+	oneShot, err := source.NewOneShot(ctx, client, src, cfg.GroupID, cfg.Topics, startOffset)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return oneShot, nil
+}
+
+// withoutTopic removes topic from topics, so a pattern never makes the
+// consumer read its own dead letters
+func withoutTopic(topics []string, topic string) []string {
+	var kept []string
+	for _, t := range topics {
+		if t != topic {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// newDeadLetterStore builds the store for messages that cannot be processed,
+// or returns nil if neither a dead-letter topic nor a quarantine directory
+// is configured
+func newDeadLetterStore(cfg *config.Config) (deadletter.Store, error) {
+	var stores deadletter.MultiStore
+
+	if cfg.DeadLetterTopic != "" {
+		writer, err := cfg.Writer(cfg.DeadLetterTopic)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, deadletter.NewTopicStore(writer))
+	}
+
+	if cfg.QuarantineDir != "" {
+		store, err := deadletter.NewDirStore(cfg.QuarantineDir)
+		if err != nil {
+			return nil, err
 		}
+		stores = append(stores, store)
+	}
+
+	if len(stores) == 0 {
+		return nil, nil
+	}
+	return stores, nil
+}
+
+// registerMetrics exposes the counters the pipeline stages keep themselves.
+// hashStage may be nil.
+func registerMetrics(decoder *events.OCFDecoder, tracker *lifecycle.Tracker, hashStage *verify.Stage, filter *dedup.Filter, aggregator *aggregate.Aggregator) {
+	metrics.GaugeFunc("consumer_writer_schemas", "Distinct writer schemas seen, each compiled once.", func() float64 {
+		return float64(decoder.Schemas())
+	})
+	metrics.GaugeFunc("consumer_active_experiments", "Experiments that are configured and not terminated.", func() float64 {
+		return float64(tracker.Active())
+	})
+	for _, kind := range lifecycle.Kinds {
+		metrics.CounterFunc("consumer_lifecycle_violations_total", "Events that violate their experiment's lifecycle, by kind.",
+			map[string]string{"kind": string(kind)}, func() float64 { return float64(tracker.Count(kind)) })
+	}
 
-		if err := ocfReader.Err(); err != nil {
-			log.Printf("OCF reader error: %v", err)
+	if hashStage != nil {
+		counters := hashStage.Counters()
+		for result, counter := range map[string]*atomic.Int64{
+			"verified":     &counters.Verified,
+			"tampered":     &counters.Tampered,
+			"malformed":    &counters.Malformed,
+			"unverifiable": &counters.Unverifiable,
+		} {
+			metrics.CounterFunc("consumer_measurement_hashes_total", "Measurement hashes checked, by result.",
+				map[string]string{"result": result}, func() float64 { return float64(counter.Load()) })
 		}
 	}
+
+	metrics.CounterFunc("consumer_duplicate_readings_total", "Readings dropped because they were already forwarded.",
+		nil, func() float64 { return float64(filter.Duplicates()) })
+	late := aggregator.Counters()
+	metrics.CounterFunc("consumer_late_readings_total", "Readings that arrived after the watermark passed their group.",
+		nil, func() float64 { return float64(late.Late.Load()) })
+	metrics.CounterFunc("consumer_late_readings_dropped_total", "Late readings that were dropped.",
+		nil, func() float64 { return float64(late.Dropped.Load()) })
+	metrics.CounterFunc("consumer_corrected_groups_total", "Measurement groups re-emitted with late readings.",
+		nil, func() float64 { return float64(late.Corrected.Load()) })
+	metrics.GaugeFunc("consumer_pending_groups", "Measurement groups waiting for readings or the watermark.", func() float64 {
+		return float64(aggregator.Pending())
+	})
+}
+
+// newEventTime builds the aggregator's event time settings and, for the
+// side-output policy, the late reading directory
+func newEventTime(cfg *config.Config) (aggregate.EventTime, error) {
+	policy, err := aggregate.ParseLatePolicy(cfg.LatePolicy)
+	if err != nil {
+		return aggregate.EventTime{}, err
+	}
+
+	eventTime := aggregate.EventTime{
+		AllowedLateness: cfg.AllowedLateness,
+		Retention:       cfg.LateRetention,
+		Policy:          policy,
+	}
+	if policy == aggregate.LateSideOutput {
+		if cfg.LateDir == "" {
+			return eventTime, fmt.Errorf("late policy %s requires -late-dir", policy)
+		}
+		side, err := aggregate.NewSideOutput(cfg.LateDir)
+		if err != nil {
+			return eventTime, err
+		}
+		eventTime.SideOutput = side.Put
+	}
+	return eventTime, nil
+}
+
+// newHashStage builds the measurement hash verification stage, or returns
+// nil when verification is off
+func newHashStage(cfg *config.Config) (*verify.Stage, error) {
+	policy, err := verify.ParsePolicy(cfg.HashPolicy)
+	if err != nil || policy == verify.PolicyOff {
+		return nil, err
+	}
+
+	verifier, err := verify.New(cfg.HashAlgorithm, cfg.HashKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var quarantine *verify.Quarantine
+	if cfg.TamperQuarantineDir != "" {
+		if quarantine, err = verify.NewQuarantine(cfg.TamperQuarantineDir); err != nil {
+			return nil, err
+		}
+	}
+	return verify.NewStage(verifier, policy, quarantine), nil
+}
+
+// newSource opens the configured input
+func newSource(cfg *config.Config) (source.Source, error) {
+	var src source.Source
+	var err error
+
+	switch cfg.Source {
+	case "dir":
+		src, err = source.NewDirSource(cfg.SourcePath, cfg.Topics[0])
+	case "log":
+		src, err = source.NewLogSource(cfg.SourcePath, cfg.Topics[0])
+	case "capture":
+		src, err = source.NewCaptureSource(cfg.SourcePath)
+	default:
+		dialer, err := cfg.Dialer()
+		if err != nil {
+			return nil, err
+		}
+		if cfg.TLS.Enabled && cfg.TLS.InsecureSkipVerify {
+			log.Println("WARNING: broker certificate verification is disabled")
+		}
+
+		return newKafkaSource(cfg, dialer)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ReplayTiming == "original" {
+		return source.NewPaced(src), nil
+	}
+	return src, nil
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"assignment2/events"
+)
+
+func TestWorkerPoolDrainsQueuedJobs(t *testing.T) {
+	var handled atomic.Int64
+	dispatcher := events.NewDispatcher()
+	dispatcher.RegisterFunc(events.ExperimentStartedName, func(ctx context.Context, event events.Event) error {
+		time.Sleep(time.Millisecond)
+		handled.Add(1)
+		return nil
+	})
+	workCtx, stopWork := context.WithCancelCause(context.Background())
+	defer stopWork(nil)
+	offsets := newOffsetTracker()
+	pool := newWorkerPool(workCtx, stopWork, 2, 10, &processor{dispatcher: dispatcher}, nil, offsets)
+
+	// Fetching stopped right after the messages were submitted
+	fetchCtx, stopFetching := context.WithCancelCause(context.Background())
+	for i := range 10 {
+		msg := message(0, int64(i))
+		offsets.Add(msg)
+		started := &events.ExperimentStarted{Experiment: "exp", Timestamp: float64(i)}
+		if err := pool.Submit(fetchCtx, job{msg: msg, events: []events.Event{started}}); err != nil {
+			t.Fatalf("Submit() = %v", err)
+		}
+	}
+	stopFetching(errShutdown)
+	pool.Close()
+
+	if handled.Load() != 10 {
+		t.Errorf("%d of 10 queued messages handled before Close() returned", handled.Load())
+	}
+	if got := committed(offsets.take()); got[0] != 9 {
+		t.Errorf("committable offsets %v, want up to 9", got)
+	}
+	if err := context.Cause(workCtx); err != nil {
+		t.Errorf("processing stopped: %v", err)
+	}
+}
+
+func TestHandleSignals(t *testing.T) {
+	tests := []struct {
+		name    string
+		signals int
+		timeout time.Duration
+		want    string
+	}{
+		{"draining too long", 1, 20 * time.Millisecond, "did not finish"},
+		{"second signal", 2, time.Hour, "while draining"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetchCtx, stopFetching := context.WithCancelCause(context.Background())
+			workCtx, stopWork := context.WithCancelCause(context.Background())
+			defer stopWork(nil)
+			go handleSignals(stopFetching, stopWork, tt.timeout)
+			// Let handleSignals register for the signals
+			time.Sleep(20 * time.Millisecond)
+
+			syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+			<-fetchCtx.Done()
+			if !errors.Is(context.Cause(fetchCtx), errShutdown) {
+				t.Errorf("fetching stopped with %v, want errShutdown", context.Cause(fetchCtx))
+			}
+			if tt.signals > 1 {
+				if workCtx.Err() != nil {
+					t.Fatal("processing stopped on the first signal")
+				}
+				syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+			}
+
+			select {
+			case <-workCtx.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("processing was not stopped")
+			}
+			if err := context.Cause(workCtx); !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("processing stopped with %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// ExperimentConfig is one entry of a load file such as loads/2.json, the
+// same format the course's experiment producer reads
+type ExperimentConfig struct {
+	// StartTime is the delay in seconds after the producer starts
+	StartTime  float64 `json:"start_time"`
+	Researcher string  `json:"researcher"`
+	NumSensors int     `json:"num_sensors"`
+	// SampleRate is the time between two samples in milliseconds
+	SampleRate           float64 `json:"sample_rate"`
+	StartTemperature     float64 `json:"start_temperature"`
+	StabilizationSamples int     `json:"stabilization_samples"`
+	CarryOutSamples      int     `json:"carry_out_samples"`
+	TempRange            struct {
+		LowerThreshold float64 `json:"lower_threshold"`
+		UpperThreshold float64 `json:"upper_threshold"`
+	} `json:"temp_range"`
+}
+
+// LoadConfig reads a load file holding a list of experiments
+func LoadConfig(path string) ([]ExperimentConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read load file: %w", err)
+	}
+
+	var configs []ExperimentConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse load file: %w", err)
+	}
+
+	for i, cfg := range configs {
+		if err := cfg.validate(); err != nil {
+			return nil, fmt.Errorf("experiment %d: %w", i, err)
+		}
+	}
+	return configs, nil
+}
+
+func (c ExperimentConfig) validate() error {
+	if c.NumSensors <= 0 {
+		return fmt.Errorf("num_sensors must be positive")
+	}
+	if c.SampleRate <= 0 {
+		return fmt.Errorf("sample_rate must be positive")
+	}
+	if c.StabilizationSamples < 0 || c.CarryOutSamples < 0 {
+		return fmt.Errorf("sample counts must not be negative")
+	}
+	if c.TempRange.LowerThreshold > c.TempRange.UpperThreshold {
+		return fmt.Errorf("lower_threshold is above upper_threshold")
+	}
+	return nil
+}
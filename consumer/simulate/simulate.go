@@ -0,0 +1,243 @@
+package simulate
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"assignment2/events"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Event is a generated record together with the time it is due
+type Event struct {
+	Time       time.Time
+	Name       string
+	Experiment string
+	Record     map[string]interface{}
+}
+
+// Options control the generated traffic
+type Options struct {
+	// Seed makes experiment ids, temperatures and hashes reproducible
+	Seed int64
+	// Start is the wall clock time the load file's start_time values are relative to
+	Start time.Time
+	// HashKey encrypts measurement hashes with AES-GCM. Without a key the
+	// hashes are random bytes in the same format.
+	HashKey []byte
+}
+
+// Generate produces the full event sequence of every experiment, merged in
+// time order: experiment_configured, stabilization_started, the
+// stabilization samples, experiment_started, the carry-out samples and
+// experiment_terminated
+func Generate(configs []ExperimentConfig, opts Options) ([]Event, error) {
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	var aead cipher.AEAD
+	if len(opts.HashKey) > 0 {
+		block, err := aes.NewCipher(opts.HashKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash key: %w", err)
+		}
+		if aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+
+	var all []Event
+	for _, cfg := range configs {
+		g := &generator{cfg: cfg, rng: rng, aead: aead}
+		all = append(all, g.run(opts.Start)...)
+	}
+
+	// Stable so the events of one experiment keep their order on equal times
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Time.Before(all[j].Time)
+	})
+	return all, nil
+}
+
+// generator simulates a single experiment
+type generator struct {
+	cfg  ExperimentConfig
+	rng  *rand.Rand
+	aead cipher.AEAD
+
+	experiment string
+	sensors    []string
+	offsets    []float64 // fixed per sensor bias
+	events     []Event
+}
+
+func (g *generator) run(start time.Time) []Event {
+	g.experiment = g.uuid()
+	for i := 0; i < g.cfg.NumSensors; i++ {
+		g.sensors = append(g.sensors, g.uuid())
+		g.offsets = append(g.offsets, (g.rng.Float64()-0.5)*g.spread()/4)
+	}
+
+	at := start.Add(seconds(g.cfg.StartTime))
+	interval := time.Duration(g.cfg.SampleRate * float64(time.Millisecond))
+
+	sensors := make([]interface{}, len(g.sensors))
+	for i, sensor := range g.sensors {
+		sensors[i] = sensor
+	}
+	g.emit(at, events.ExperimentConfiguredName, map[string]interface{}{
+		"experiment": g.experiment,
+		"researcher": g.cfg.Researcher,
+		"sensors":    sensors,
+		"temperature_range": map[string]interface{}{
+			"upper_threshold": float32(g.cfg.TempRange.UpperThreshold),
+			"lower_threshold": float32(g.cfg.TempRange.LowerThreshold),
+		},
+	})
+
+	g.emit(at, events.StabilizationStartedName, g.phase(at))
+
+	// Stabilization drifts from the start temperature into the target range
+	target := (g.cfg.TempRange.LowerThreshold + g.cfg.TempRange.UpperThreshold) / 2
+	for i := 0; i < g.cfg.StabilizationSamples; i++ {
+		at = at.Add(interval)
+		progress := float64(i+1) / float64(g.cfg.StabilizationSamples)
+		g.sample(at, g.cfg.StartTemperature+(target-g.cfg.StartTemperature)*progress)
+	}
+
+	at = at.Add(interval)
+	g.emit(at, events.ExperimentStartedName, g.phase(at))
+
+	for i := 0; i < g.cfg.CarryOutSamples; i++ {
+		at = at.Add(interval)
+		g.sample(at, target)
+	}
+
+	at = at.Add(interval)
+	g.emit(at, events.ExperimentTerminatedName, g.phase(at))
+	return g.events
+}
+
+// sample emits one reading per sensor around base, sharing a measurement id
+// and the measurement's hash
+func (g *generator) sample(at time.Time, base float64) {
+	measurementID := g.uuid()
+	temperatures := make([]float32, len(g.sensors))
+	sum := 0.0
+	for i := range g.sensors {
+		temperatures[i] = float32(base + g.offsets[i] + g.rng.NormFloat64()*g.spread()/8)
+		sum += float64(temperatures[i])
+	}
+	hash := g.hash(measurementID, sum/float64(len(temperatures)))
+
+	for i, sensor := range g.sensors {
+		g.emit(at, events.SensorTemperatureMeasuredName, map[string]interface{}{
+			"experiment":       g.experiment,
+			"sensor":           sensor,
+			"measurement_id":   measurementID,
+			"timestamp":        unixSeconds(at),
+			"temperature":      temperatures[i],
+			"measurement_hash": hash,
+		})
+	}
+}
+
+func (g *generator) phase(at time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"experiment": g.experiment,
+		"timestamp":  unixSeconds(at),
+	}
+}
+
+func (g *generator) emit(at time.Time, name string, record map[string]interface{}) {
+	g.events = append(g.events, Event{Time: at, Name: name, Experiment: g.experiment, Record: record})
+}
+
+// spread is the width of the temperature range, at least 1 degree
+func (g *generator) spread() float64 {
+	if spread := g.cfg.TempRange.UpperThreshold - g.cfg.TempRange.LowerThreshold; spread > 1 {
+		return spread
+	}
+	return 1
+}
+
+// hash builds base64(nonce) "." base64(ciphertext) of a measurement, the
+// plaintext naming it and holding the mean of its readings
+func (g *generator) hash(measurementID string, temperature float64) string {
+	nonce := make([]byte, 12)
+	g.rng.Read(nonce)
+	plaintext, _ := json.Marshal(struct {
+		Experiment    string  `json:"experiment"`
+		MeasurementID string  `json:"measurement_id"`
+		Temperature   float64 `json:"temperature"`
+	}{g.experiment, measurementID, temperature})
+
+	var ciphertext []byte
+	if g.aead != nil {
+		ciphertext = g.aead.Seal(nil, nonce, plaintext, nil)
+	} else {
+		ciphertext = make([]byte, len(plaintext)+16)
+		g.rng.Read(ciphertext)
+	}
+	return base64.StdEncoding.EncodeToString(nonce) + "." + base64.RawStdEncoding.EncodeToString(ciphertext)
+}
+
+// uuid returns a random version 4 UUID drawn from the seeded generator
+func (g *generator) uuid() string {
+	b := make([]byte, 16)
+	g.rng.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Encoder turns generated events into OCF containers, one record each
+type Encoder struct {
+	codecs map[string]*goavro.Codec
+}
+
+// NewEncoder compiles the schema of every event
+func NewEncoder() (*Encoder, error) {
+	codecs := make(map[string]*goavro.Codec, len(events.Schemas))
+	for name := range events.Schemas {
+		codec, err := events.Codec(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile %s schema: %w", name, err)
+		}
+		codecs[name] = codec
+	}
+	return &Encoder{codecs: codecs}, nil
+}
+
+// Encode writes the event as a single-record OCF container
+func (e *Encoder) Encode(event Event) ([]byte, error) {
+	codec, ok := e.codecs[event.Name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", events.ErrUnknownEvent, event.Name)
+	}
+
+	var buf bytes.Buffer
+	w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &buf, Codec: codec})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCF writer: %w", err)
+	}
+	if err := w.Append([]interface{}{event.Record}); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", event.Name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
@@ -0,0 +1,220 @@
+package simulate
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"assignment2/events"
+	"assignment2/verify"
+)
+
+func experiment(startTime float64, sensors, stabilization, carryOut int) ExperimentConfig {
+	cfg := ExperimentConfig{
+		StartTime:            startTime,
+		Researcher:           "r@example.com",
+		NumSensors:           sensors,
+		SampleRate:           100,
+		StartTemperature:     0,
+		StabilizationSamples: stabilization,
+		CarryOutSamples:      carryOut,
+	}
+	cfg.TempRange.LowerThreshold = 10
+	cfg.TempRange.UpperThreshold = 20
+	return cfg
+}
+
+func TestGenerateSchedule(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	generated, err := Generate([]ExperimentConfig{experiment(5, 2, 2, 3)}, Options{Seed: 1, Start: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		configured = events.ExperimentConfiguredName
+		stabilize  = events.StabilizationStartedName
+		sample     = events.SensorTemperatureMeasuredName
+		started    = events.ExperimentStartedName
+		terminated = events.ExperimentTerminatedName
+	)
+	want := []struct {
+		name  string
+		after time.Duration // after start
+	}{
+		{configured, 5 * time.Second},
+		{stabilize, 5 * time.Second},
+		{sample, 5100 * time.Millisecond}, {sample, 5100 * time.Millisecond},
+		{sample, 5200 * time.Millisecond}, {sample, 5200 * time.Millisecond},
+		{started, 5300 * time.Millisecond},
+		{sample, 5400 * time.Millisecond}, {sample, 5400 * time.Millisecond},
+		{sample, 5500 * time.Millisecond}, {sample, 5500 * time.Millisecond},
+		{sample, 5600 * time.Millisecond}, {sample, 5600 * time.Millisecond},
+		{terminated, 5700 * time.Millisecond},
+	}
+	if len(generated) != len(want) {
+		t.Fatalf("generated %d events, want %d", len(generated), len(want))
+	}
+	for i, w := range want {
+		event := generated[i]
+		if event.Name != w.name || !event.Time.Equal(start.Add(w.after)) {
+			t.Errorf("event %d is %s at %v, want %s at %v", i, event.Name, event.Time.Sub(start), w.name, w.after)
+		}
+		if ts, ok := event.Record["timestamp"].(float64); ok && math.Abs(ts-unixSeconds(event.Time)) > 1e-6 {
+			t.Errorf("event %d has timestamp %f, due at %f", i, ts, unixSeconds(event.Time))
+		}
+	}
+
+	// The readings of a sample share its measurement id and hash
+	if generated[2].Record["measurement_id"] != generated[3].Record["measurement_id"] ||
+		generated[2].Record["measurement_hash"] != generated[3].Record["measurement_hash"] ||
+		generated[2].Record["measurement_id"] == generated[4].Record["measurement_id"] {
+		t.Error("readings of one sample do not share a measurement id and hash")
+	}
+	if generated[2].Record["sensor"] == generated[3].Record["sensor"] {
+		t.Error("readings of one sample come from the same sensor")
+	}
+}
+
+func TestGenerateMergesExperiments(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	configs := []ExperimentConfig{experiment(0, 1, 0, 10), experiment(0.25, 1, 0, 1)}
+	generated, err := Generate(configs, Options{Seed: 1, Start: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	perExperiment := make(map[string][]string)
+	for i, event := range generated {
+		if i > 0 && event.Time.Before(generated[i-1].Time) {
+			t.Fatalf("event %d at %v before the previous one at %v", i, event.Time, generated[i-1].Time)
+		}
+		perExperiment[event.Experiment] = append(perExperiment[event.Experiment], event.Name)
+	}
+	if len(perExperiment) != 2 {
+		t.Fatalf("events of %d experiments, want 2", len(perExperiment))
+	}
+	// Equal times keep each experiment's order
+	for experiment, names := range perExperiment {
+		if names[0] != events.ExperimentConfiguredName || names[1] != events.StabilizationStartedName || names[len(names)-1] != events.ExperimentTerminatedName {
+			t.Errorf("experiment %s events %v out of order", experiment, names)
+		}
+	}
+}
+
+func TestGenerateIsReproducible(t *testing.T) {
+	configs := []ExperimentConfig{experiment(0, 3, 2, 2)}
+	start := time.Unix(1700000000, 0)
+	first, _ := Generate(configs, Options{Seed: 7, Start: start})
+	again, _ := Generate(configs, Options{Seed: 7, Start: start})
+	other, _ := Generate(configs, Options{Seed: 8, Start: start})
+
+	if !reflect.DeepEqual(first, again) {
+		t.Error("the same seed generated different events")
+	}
+	if first[0].Experiment == other[0].Experiment {
+		t.Error("different seeds generated the same experiment id")
+	}
+}
+
+func TestGenerateSealsHashes(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	generated, err := Generate([]ExperimentConfig{experiment(0, 3, 1, 0)}, Options{Seed: 1, HashKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := verify.NewAESGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := 0.0
+	var readings []map[string]interface{}
+	for _, event := range generated {
+		if event.Name == events.SensorTemperatureMeasuredName {
+			readings = append(readings, event.Record)
+			sum += float64(event.Record["temperature"].(float32))
+		}
+	}
+	claim, err := v.Open(readings[0]["measurement_hash"].(string))
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	if claim.Experiment != generated[0].Experiment || claim.MeasurementID != readings[0]["measurement_id"] {
+		t.Errorf("hash names %s/%s, want the reading's measurement", claim.Experiment, claim.MeasurementID)
+	}
+	if claim.Temperature == nil || math.Abs(*claim.Temperature-sum/float64(len(readings))) > 1e-6 {
+		t.Errorf("hash holds temperature %v, want the mean %f", claim.Temperature, sum/float64(len(readings)))
+	}
+
+	if _, err := Generate(nil, Options{HashKey: []byte("short")}); err == nil {
+		t.Error("Generate() with a 5 byte key succeeded")
+	}
+}
+
+func TestEncoderRoundTrip(t *testing.T) {
+	generated, err := Generate([]ExperimentConfig{experiment(0, 2, 1, 1)}, Options{Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder, err := NewEncoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := events.NewOCFDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range generated {
+		value, err := encoder.Encode(event)
+		if err != nil {
+			t.Fatalf("Encode(%s) = %v", event.Name, err)
+		}
+		decoded, err := decoder.Decode(value)
+		if err != nil {
+			t.Fatalf("Decode(%s) = %v", event.Name, err)
+		}
+		if len(decoded) != 1 || decoded[0].EventName() != event.Name {
+			t.Errorf("%s decoded as %v", event.Name, decoded)
+		}
+	}
+	if _, err := encoder.Encode(Event{Name: "experiment_paused"}); err == nil {
+		t.Error("Encode() of an unknown event succeeded")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"valid", `[{"num_sensors": 2, "sample_rate": 100, "temp_range": {"lower_threshold": 1, "upper_threshold": 2}}]`, ""},
+		{"no sensors", `[{"num_sensors": 0, "sample_rate": 100}]`, "num_sensors"},
+		{"no sample rate", `[{"num_sensors": 1}]`, "sample_rate"},
+		{"negative samples", `[{"num_sensors": 1, "sample_rate": 100, "carry_out_samples": -1}]`, "sample counts"},
+		{"inverted range", `[{"num_sensors": 1, "sample_rate": 100, "temp_range": {"lower_threshold": 2, "upper_threshold": 1}}]`, "lower_threshold"},
+		{"not a list", `{"num_sensors": 1}`, "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "load.json")
+			os.WriteFile(path, []byte(tt.content), 0o644)
+			configs, err := LoadConfig(path)
+			if tt.wantErr == "" {
+				if err != nil || len(configs) != 1 {
+					t.Errorf("LoadConfig() = %v, %v", configs, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
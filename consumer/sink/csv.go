@@ -0,0 +1,124 @@
+package sink
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"assignment2/events"
+)
+
+// columns holds the CSV header of every event type
+var columns = map[string][]string{
+	events.ExperimentConfiguredName:      {"topic", "experiment", "researcher", "sensors", "upper_threshold", "lower_threshold"},
+	events.StabilizationStartedName:      {"topic", "experiment", "timestamp"},
+	events.ExperimentStartedName:         {"topic", "experiment", "timestamp"},
+	events.SensorTemperatureMeasuredName: {"topic", "experiment", "sensor", "measurement_id", "timestamp", "temperature", "measurement_hash", "tampered"},
+	events.ExperimentTerminatedName:      {"topic", "experiment", "timestamp"},
+}
+
+// csvFile is an open CSV file of one event type
+type csvFile struct {
+	f *os.File
+	w *csv.Writer
+}
+
+// CSV appends events to <event>.csv in a directory, one file per event type
+type CSV struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*csvFile
+}
+
+// NewCSV creates the directory if needed
+func NewCSV(dir string) (*CSV, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create CSV sink directory: %w", err)
+	}
+	return &CSV{dir: dir, files: make(map[string]*csvFile)}, nil
+}
+
+// Write appends event as a row of its event type's file
+func (s *CSV) Write(ctx context.Context, event events.Event) error {
+	row, err := csvRow(events.Topic(ctx), event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := s.open(event.EventName())
+	if err != nil {
+		return err
+	}
+	file.w.Write(row)
+	file.w.Flush()
+	if err := file.w.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV sink: %w", err)
+	}
+	return nil
+}
+
+// open returns the file of an event type, writing the header into new
+// files. Must be called with s.mu held.
+func (s *CSV) open(name string) (*csvFile, error) {
+	if file, ok := s.files[name]; ok {
+		return file, nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.dir, name+".csv"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV sink: %w", err)
+	}
+	file := &csvFile{f: f, w: csv.NewWriter(f)}
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		file.w.Write(columns[name])
+	}
+	s.files[name] = file
+	return file, nil
+}
+
+// Close closes every file
+func (s *CSV) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for name, file := range s.files {
+		file.w.Flush()
+		if cerr := file.f.Close(); err == nil {
+			err = cerr
+		}
+		delete(s.files, name)
+	}
+	return err
+}
+
+// csvRow formats event in the order of its columns
+func csvRow(topic string, event events.Event) ([]string, error) {
+	switch e := event.(type) {
+	case *events.ExperimentConfigured:
+		return []string{topic, e.Experiment, e.Researcher, strings.Join(e.Sensors, ";"),
+			formatFloat(e.TemperatureRange.UpperThreshold), formatFloat(e.TemperatureRange.LowerThreshold)}, nil
+	case *events.StabilizationStarted:
+		return []string{topic, e.Experiment, formatFloat(e.Timestamp)}, nil
+	case *events.ExperimentStarted:
+		return []string{topic, e.Experiment, formatFloat(e.Timestamp)}, nil
+	case *events.SensorTemperatureMeasured:
+		return []string{topic, e.Experiment, e.Sensor, e.MeasurementID, formatFloat(e.Timestamp),
+			formatFloat(e.Temperature), e.MeasurementHash, strconv.FormatBool(e.Tampered)}, nil
+	case *events.ExperimentTerminated:
+		return []string{topic, e.Experiment, formatFloat(e.Timestamp)}, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", events.ErrUnknownEvent, event)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
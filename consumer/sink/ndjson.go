@@ -0,0 +1,69 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"assignment2/events"
+)
+
+// line is a single line of NDJSON output
+type line struct {
+	Topic  string       `json:"topic,omitempty"`
+	Event  string       `json:"event"`
+	Record events.Event `json:"record"`
+}
+
+// NDJSON writes one JSON object per event
+type NDJSON struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+}
+
+// NewNDJSON writes to stdout for "-" and appends to the file path otherwise
+func NewNDJSON(path string) (*NDJSON, error) {
+	if path == "-" {
+		return &NDJSON{w: bufio.NewWriter(os.Stdout)}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open NDJSON sink: %w", err)
+	}
+	return &NDJSON{w: bufio.NewWriter(f), closer: f}, nil
+}
+
+// Write appends event as a line. Lines are flushed right away, so the
+// output can be followed while the consumer runs.
+func (s *NDJSON) Write(ctx context.Context, event events.Event) error {
+	data, err := json.Marshal(line{Topic: events.Topic(ctx), Event: event.EventName(), Record: event})
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", event.EventName(), err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(append(data, '\n'))
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write NDJSON sink: %w", err)
+	}
+	return nil
+}
+
+// Close flushes and closes the file
+func (s *NDJSON) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.w.Flush()
+	if s.closer != nil {
+		if cerr := s.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"assignment2/events"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// ocfFile is an open OCF file of one experiment and event type
+type ocfFile struct {
+	f *os.File
+	w *goavro.OCFWriter
+}
+
+// OCF writes events to <dir>/<experiment>/<event>.avro with the event's
+// writer schema. An experiment's files are closed once it terminates, so
+// the files of finished experiments are complete and can be moved away.
+type OCF struct {
+	dir    string
+	codecs map[string]*goavro.Codec
+
+	mu    sync.Mutex
+	files map[string]map[string]*ocfFile // experiment -> event -> file
+}
+
+// NewOCF creates the directory if needed and compiles the event schemas
+func NewOCF(dir string) (*OCF, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create OCF sink directory: %w", err)
+	}
+	codecs := make(map[string]*goavro.Codec, len(events.Schemas))
+	for name := range events.Schemas {
+		codec, err := events.Codec(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile %s schema: %w", name, err)
+		}
+		codecs[name] = codec
+	}
+	return &OCF{dir: dir, codecs: codecs, files: make(map[string]map[string]*ocfFile)}, nil
+}
+
+// Write appends event to its experiment's file of its type
+func (s *OCF) Write(ctx context.Context, event events.Event) error {
+	native, err := events.Native(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := s.open(event.ExperimentID(), event.EventName())
+	if err != nil {
+		return err
+	}
+	if err := file.w.Append([]interface{}{native}); err != nil {
+		return fmt.Errorf("failed to write OCF sink: %w", err)
+	}
+
+	if event.EventName() == events.ExperimentTerminatedName {
+		return s.closeExperiment(event.ExperimentID())
+	}
+	return nil
+}
+
+// open returns the file of an experiment and event type, appending to it if
+// it already exists. Must be called with s.mu held.
+func (s *OCF) open(experiment, name string) (*ocfFile, error) {
+	if file, ok := s.files[experiment][name]; ok {
+		return file, nil
+	}
+
+	dir := filepath.Join(s.dir, filepath.Base(experiment))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create OCF sink directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, name+".avro"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OCF sink: %w", err)
+	}
+	w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: f, Codec: s.codecs[name]})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open OCF sink: %w", err)
+	}
+
+	if s.files[experiment] == nil {
+		s.files[experiment] = make(map[string]*ocfFile)
+	}
+	file := &ocfFile{f: f, w: w}
+	s.files[experiment][name] = file
+	return file, nil
+}
+
+// closeExperiment closes the files of an experiment. Must be called with
+// s.mu held.
+func (s *OCF) closeExperiment(experiment string) error {
+	var err error
+	for _, file := range s.files[experiment] {
+		if cerr := file.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	delete(s.files, experiment)
+	return err
+}
+
+// Close closes every open file
+func (s *OCF) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for experiment := range s.files {
+		if cerr := s.closeExperiment(experiment); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"assignment2/events"
+)
+
+// Sink receives every decoded event, next to or instead of forwarding
+type Sink interface {
+	// Write stores event, the topic it was consumed from is carried by ctx
+	Write(ctx context.Context, event events.Event) error
+	Close() error
+}
+
+// Multi writes every event to all of its sinks
+type Multi []Sink
+
+// Write writes event to every sink and stops at the first failure
+func (m Multi) Write(ctx context.Context, event events.Event) error {
+	for _, s := range m {
+		if err := s.Write(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every sink
+func (m Multi) Close() error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Register installs s as handler for every event type
+func Register(d *events.Dispatcher, s Sink) {
+	for name := range events.Schemas {
+		d.RegisterFunc(name, s.Write)
+	}
+}
+
+// Open creates the sinks described by specs, each kind:target:
+//
+//	ndjson:-       NDJSON on stdout
+//	ndjson:<file>  NDJSON appended to a file
+//	csv:<dir>      one CSV file per event type
+//	ocf:<dir>      Avro OCF files per experiment and event type
+func Open(specs []string) (Multi, error) {
+	var sinks Multi
+	for _, spec := range specs {
+		kind, target, ok := strings.Cut(spec, ":")
+		if !ok || target == "" {
+			sinks.Close()
+			return nil, fmt.Errorf("invalid sink %q, expected kind:target", spec)
+		}
+
+		var s Sink
+		var err error
+		switch kind {
+		case "ndjson":
+			s, err = NewNDJSON(target)
+		case "csv":
+			s, err = NewCSV(target)
+		case "ocf":
+			s, err = NewOCF(target)
+		default:
+			err = fmt.Errorf("unknown sink kind %q, expected ndjson, csv or ocf", kind)
+		}
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
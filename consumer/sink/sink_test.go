@@ -0,0 +1,190 @@
+package sink
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"assignment2/events"
+)
+
+var (
+	configured = &events.ExperimentConfigured{
+		Experiment:       "exp",
+		Researcher:       "r@example.com",
+		Sensors:          []string{"a", "b"},
+		TemperatureRange: events.TemperatureRange{UpperThreshold: 26.5, LowerThreshold: 25},
+	}
+	measured = &events.SensorTemperatureMeasured{
+		Experiment:      "exp",
+		Sensor:          "a",
+		MeasurementID:   "m1",
+		Timestamp:       1700000000.25,
+		Temperature:     25.5,
+		MeasurementHash: "h",
+		Tampered:        true,
+	}
+	terminated = &events.ExperimentTerminated{Experiment: "exp", Timestamp: 1700000010}
+)
+
+func TestCSVRow(t *testing.T) {
+	tests := []struct {
+		event events.Event
+		want  []string
+	}{
+		{configured, []string{"group2", "exp", "r@example.com", "a;b", "26.5", "25"}},
+		{&events.StabilizationStarted{Experiment: "exp", Timestamp: 1.5}, []string{"group2", "exp", "1.5"}},
+		{&events.ExperimentStarted{Experiment: "exp", Timestamp: 2}, []string{"group2", "exp", "2"}},
+		{measured, []string{"group2", "exp", "a", "m1", "1700000000.25", "25.5", "h", "true"}},
+		{terminated, []string{"group2", "exp", "1700000010"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event.EventName(), func(t *testing.T) {
+			got, err := csvRow("group2", tt.event)
+			if err != nil {
+				t.Fatalf("csvRow() = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("csvRow() = %q, want %q", got, tt.want)
+			}
+			if len(got) != len(columns[tt.event.EventName()]) {
+				t.Errorf("row has %d fields, header %d", len(got), len(columns[tt.event.EventName()]))
+			}
+		})
+	}
+}
+
+func TestCSVWritesHeaderOnce(t *testing.T) {
+	dir := t.TempDir()
+	ctx := events.WithTopic(context.Background(), "group2")
+
+	// A second run appends to the files of the first
+	for range 2 {
+		s, err := NewCSV(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Write(ctx, measured); err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("Close() = %v", err)
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dir, events.SensorTemperatureMeasuredName+".csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || !reflect.DeepEqual(rows[0], columns[events.SensorTemperatureMeasuredName]) {
+		t.Errorf("rows = %q, want the header and 2 rows", rows)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	s, err := NewNDJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := events.WithTopic(context.Background(), "group2")
+	s.Write(ctx, configured)
+	s.Write(context.Background(), terminated)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`{"topic":"group2","event":"experiment_configured","record":{"experiment":"exp","researcher":"r@example.com","sensors":["a","b"],"temperature_range":{"upper_threshold":26.5,"lower_threshold":25}}}`,
+		`{"event":"experiment_terminated","record":{"experiment":"exp","timestamp":1700000010}}`,
+	}
+	if got := strings.Split(strings.TrimSpace(string(data)), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("lines =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestOCFAppendsAcrossRuns(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// Termination closes the experiment's files, a later run reopens them
+	for _, evs := range [][]events.Event{{measured, terminated}, {measured}} {
+		s, err := NewOCF(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, event := range evs {
+			if err := s.Write(ctx, event); err != nil {
+				t.Fatalf("Write(%s) = %v", event.EventName(), err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatalf("Close() = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "exp", events.SensorTemperatureMeasuredName+".avro"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := events.NewOCFDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decoder.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() = %v", err)
+	}
+	// Tampered is not part of the schema
+	want := *measured
+	want.Tampered = false
+	if len(decoded) != 2 || !reflect.DeepEqual(decoded[0], &want) || !reflect.DeepEqual(decoded[1], &want) {
+		t.Errorf("decoded %+v, want 2 copies of %+v", decoded, want)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		specs   []string
+		want    int
+		wantErr string
+	}{
+		{nil, 0, ""},
+		{[]string{"ndjson:" + filepath.Join(dir, "out.ndjson"), "csv:" + filepath.Join(dir, "csv"), "ocf:" + filepath.Join(dir, "ocf")}, 3, ""},
+		{[]string{"ndjson"}, 0, "expected kind:target"},
+		{[]string{"csv:"}, 0, "expected kind:target"},
+		{[]string{"csv:" + dir, "parquet:" + dir}, 0, "unknown sink kind"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.specs, ","), func(t *testing.T) {
+			sinks, err := Open(tt.specs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Open() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open() = %v", err)
+			}
+			defer sinks.Close()
+			if len(sinks) != tt.want {
+				t.Errorf("opened %d sinks, want %d", len(sinks), tt.want)
+			}
+		})
+	}
+}
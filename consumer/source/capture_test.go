@@ -0,0 +1,43 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"assignment2/capture"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestCaptureSource(t *testing.T) {
+	dir := t.TempDir()
+	r, err := capture.NewRecorder(dir, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		r.Write(kafka.Message{Topic: "group2", Partition: 1, Offset: int64(i), Value: []byte{0, byte(i)}, Time: time.Unix(int64(i), 0).UTC()})
+	}
+	r.Close()
+
+	src, err := NewCaptureSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	ctx := context.Background()
+	for i := range 5 {
+		msg, err := src.Fetch(ctx)
+		if err != nil {
+			t.Fatalf("Fetch() = %v", err)
+		}
+		if msg.Offset != int64(i) || msg.Partition != 1 || !msg.Time.Equal(time.Unix(int64(i), 0)) {
+			t.Errorf("message %d at partition %d offset %d time %v", i, msg.Partition, msg.Offset, msg.Time)
+		}
+	}
+	if _, err := src.Fetch(ctx); !errors.Is(err, ErrEOF) {
+		t.Errorf("Fetch() after the last record = %v, want ErrEOF", err)
+	}
+}
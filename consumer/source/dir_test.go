@@ -0,0 +1,46 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Unix(1700000000, 0)
+	for i, name := range []string{"b.avro", "a.avro", "c.avro"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mtime, mtime.Add(time.Duration(i)*time.Second))
+	}
+	os.Mkdir(filepath.Join(dir, "sub"), 0o755)
+
+	src, err := NewDirSource(dir, "group2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	wantTimes := map[string]time.Time{"a.avro": mtime.Add(time.Second), "b.avro": mtime, "c.avro": mtime.Add(2 * time.Second)}
+	for i, want := range []string{"a.avro", "b.avro", "c.avro"} {
+		msg, err := src.Fetch(context.Background())
+		if err != nil {
+			t.Fatalf("Fetch() = %v", err)
+		}
+		if string(msg.Key) != want || string(msg.Value) != want || msg.Offset != int64(i) || !msg.Time.Equal(wantTimes[want]) {
+			t.Errorf("message %d is %s at offset %d time %v, want %s", i, msg.Key, msg.Offset, msg.Time, want)
+		}
+	}
+	if _, err := src.Fetch(context.Background()); !errors.Is(err, ErrEOF) {
+		t.Errorf("Fetch() after the last file = %v, want ErrEOF", err)
+	}
+
+	if _, err := NewDirSource(filepath.Join(dir, "missing"), "group2"); err == nil {
+		t.Error("NewDirSource() of a missing directory succeeded")
+	}
+}
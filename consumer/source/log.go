@@ -0,0 +1,227 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"assignment2/events"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/segmentio/kafka-go"
+)
+
+// logSource reads a log dump one record at a time
+type logSource struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	topic   string
+	codecs  map[string]*goavro.Codec
+
+	lineNo int
+	offset int64
+	last   time.Time // time of the last record with a timestamp
+	done   bool
+	// queued holds the records before the first timestamp until it is known
+	queued []kafka.Message
+}
+
+// NewLogSource replays the text dumps written by the course's example
+// consumer (see logs/example_log.txt): a schema name on one line, followed
+// by the record as a Python dict on the next. Every record is re-encoded as
+// its own OCF container. The record's timestamp, or the previous one for
+// records without a timestamp, is used as the message time. Records before
+// the first timestamp take its time. A record that fails to parse is
+// reported by Fetch and skipped.
+func NewLogSource(path, topic string) (Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return &logSource{
+		file:    f,
+		scanner: scanner,
+		topic:   topic,
+		codecs:  make(map[string]*goavro.Codec),
+	}, nil
+}
+
+func (s *logSource) Fetch(ctx context.Context) (kafka.Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return kafka.Message{}, err
+		}
+		if len(s.queued) > 0 && (!s.last.IsZero() || s.done) {
+			msg := s.queued[0]
+			s.queued = s.queued[1:]
+			return msg, nil
+		}
+		if s.done {
+			return kafka.Message{}, ErrEOF
+		}
+
+		msg, ok, err := s.read()
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		if !ok {
+			s.done = true
+			continue
+		}
+		if msg.Time.IsZero() {
+			s.queued = append(s.queued, msg)
+			continue
+		}
+		if len(s.queued) > 0 {
+			for i := range s.queued {
+				s.queued[i].Time = msg.Time
+			}
+			s.queued = append(s.queued, msg)
+			continue
+		}
+		return msg, nil
+	}
+}
+
+// read returns the message of the next record, false at the end of the log
+func (s *logSource) read() (kafka.Message, bool, error) {
+	var name string
+	for s.scanner.Scan() {
+		s.lineNo++
+		line := strings.TrimSpace(s.scanner.Text())
+
+		if _, known := events.Schemas[line]; known {
+			name = line
+			continue
+		}
+		if name == "" || !strings.HasPrefix(line, "{") {
+			// Anything else, e.g. the partition assignment dump, is not a record
+			name = ""
+			continue
+		}
+
+		codec, ok := s.codecs[name]
+		if !ok {
+			var err error
+			if codec, err = events.Codec(name); err != nil {
+				return kafka.Message{}, false, err
+			}
+			s.codecs[name] = codec
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(pythonToJSON(line), &record); err != nil {
+			return kafka.Message{}, false, fmt.Errorf("line %d: failed to parse %s record: %w", s.lineNo, name, err)
+		}
+		value, err := encodeOCF(codec, record)
+		if err != nil {
+			return kafka.Message{}, false, fmt.Errorf("line %d: %w", s.lineNo, err)
+		}
+
+		if ts, ok := record["timestamp"].(float64); ok {
+			sec, frac := math.Modf(ts)
+			s.last = time.Unix(int64(sec), int64(frac*1e9))
+		}
+		msg := kafka.Message{
+			Topic:  s.topic,
+			Offset: s.offset,
+			Value:  value,
+			Time:   s.last,
+		}
+		s.offset++
+		return msg, true, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		// The scanner cannot go on, the log ends here
+		s.done = true
+		return kafka.Message{}, false, fmt.Errorf("failed to read log: %w", err)
+	}
+	return kafka.Message{}, false, nil
+}
+
+// Commit is a no-op, logs are replayed from the start every time
+func (s *logSource) Commit(ctx context.Context, msgs ...kafka.Message) error {
+	return nil
+}
+
+func (s *logSource) Close() error {
+	return s.file.Close()
+}
+
+// encodeOCF writes a single record as an OCF container
+func encodeOCF(codec *goavro.Codec, record map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &buf, Codec: codec})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCF writer: %w", err)
+	}
+	if err := w.Append([]interface{}{record}); err != nil {
+		return nil, fmt.Errorf("failed to encode record: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// pythonToJSON rewrites a Python literal (single quoted strings, escapes,
+// True, False, None) as JSON
+func pythonToJSON(literal string) []byte {
+	var out bytes.Buffer
+	for i := 0; i < len(literal); i++ {
+		c := literal[i]
+		switch {
+		case c == '\'' || c == '"':
+			// Copy the string, re-quoting it with double quotes
+			var s strings.Builder
+			for i++; i < len(literal) && literal[i] != c; i++ {
+				if literal[i] == '\\' && i+1 < len(literal) {
+					i++
+					switch literal[i] {
+					case 'n':
+						s.WriteByte('\n')
+					case 'r':
+						s.WriteByte('\r')
+					case 't':
+						s.WriteByte('\t')
+					case 'x', 'u', 'U':
+						// Python escapes non-printable characters by code point
+						digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[literal[i]]
+						if i+digits < len(literal) {
+							if r, err := strconv.ParseUint(literal[i+1:i+1+digits], 16, 32); err == nil {
+								s.WriteRune(rune(r))
+								i += digits
+								continue
+							}
+						}
+						s.WriteByte(literal[i])
+					default:
+						s.WriteByte(literal[i])
+					}
+					continue
+				}
+				s.WriteByte(literal[i])
+			}
+			quoted, _ := json.Marshal(s.String())
+			out.Write(quoted)
+		case strings.HasPrefix(literal[i:], "True"):
+			out.WriteString("true")
+			i += len("True") - 1
+		case strings.HasPrefix(literal[i:], "False"):
+			out.WriteString("false")
+			i += len("False") - 1
+		case strings.HasPrefix(literal[i:], "None"):
+			out.WriteString("null")
+			i += len("None") - 1
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
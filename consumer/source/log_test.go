@@ -0,0 +1,146 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"assignment2/events"
+)
+
+func writeLog(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "log.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLogSource(t *testing.T) {
+	configured := []string{
+		"experiment_configured",
+		"{'experiment': 'exp', 'researcher': 'r@example.com', 'sensors': ['a'], 'temperature_range': {'upper_threshold': 30.0, 'lower_threshold': 10.0}}",
+	}
+	started := []string{"experiment_started", "{'experiment': 'exp', 'timestamp': 10.5}"}
+	terminated := []string{"experiment_terminated", "{'experiment': 'exp', 'timestamp': 12.0}"}
+	at := func(sec float64) time.Time {
+		return time.Unix(0, int64(sec*1e9))
+	}
+	join := func(parts ...[]string) []string {
+		var lines []string
+		for _, p := range parts {
+			lines = append(lines, p...)
+		}
+		return lines
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string // event names
+		times []time.Time
+		errs  int
+	}{
+		{
+			name:  "records before the first timestamp take it",
+			lines: join([]string{"[TopicPartition{topic=group2,partition=0}]"}, configured, started, terminated),
+			want:  []string{events.ExperimentConfiguredName, events.ExperimentStartedName, events.ExperimentTerminatedName},
+			times: []time.Time{at(10.5), at(10.5), at(12)},
+		},
+		{
+			name:  "no timestamp at all",
+			lines: configured,
+			want:  []string{events.ExperimentConfiguredName},
+			times: []time.Time{{}},
+		},
+		{
+			name:  "unparsable record is skipped",
+			lines: join(started, []string{"experiment_terminated", "{'experiment': 'exp', 'timestamp': }"}, terminated),
+			want:  []string{events.ExperimentStartedName, events.ExperimentTerminatedName},
+			times: []time.Time{at(10.5), at(12)},
+			errs:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := NewLogSource(writeLog(t, tt.lines...), "group2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer src.Close()
+			decoder, err := events.NewOCFDecoder()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			var times []time.Time
+			errs := 0
+			for {
+				msg, err := src.Fetch(context.Background())
+				if errors.Is(err, ErrEOF) {
+					break
+				}
+				if err != nil {
+					errs++
+					continue
+				}
+				decoded, err := decoder.Decode(msg.Value)
+				if err != nil {
+					t.Fatalf("Decode() = %v", err)
+				}
+				if msg.Offset != int64(len(got)) || msg.Topic != "group2" {
+					t.Errorf("message %d on %s at offset %d", len(got), msg.Topic, msg.Offset)
+				}
+				got = append(got, decoded[0].EventName())
+				times = append(times, msg.Time)
+			}
+			if !reflect.DeepEqual(got, tt.want) || errs != tt.errs {
+				t.Errorf("read %v and %d errors, want %v and %d", got, errs, tt.want, tt.errs)
+			}
+			for i := range times {
+				if i < len(tt.times) && !times[i].Equal(tt.times[i]) {
+					t.Errorf("message %d at %v, want %v", i, times[i], tt.times[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPythonToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		literal string
+		want    string
+	}{
+		{"plain", `{'a': 1, 'b': 2.5}`, `{"a": 1, "b": 2.5}`},
+		{"constants", `{'on': True, 'off': False, 'none': None}`, `{"on": true, "off": false, "none": null}`},
+		{"constants inside strings", `{'s': 'True or None'}`, `{"s": "True or None"}`},
+		{"double quote inside single quotes", `{'s': 'say "hi"'}`, `{"s": "say \"hi\""}`},
+		{"single quote inside double quotes", `{'s': "it's"}`, `{"s": "it's"}`},
+		{"escaped quote", `{'s': 'it\'s'}`, `{"s": "it's"}`},
+		{"escapes", `{'s': 'a\nb\tc\\d'}`, `{"s": "a\nb\tc\\d"}`},
+		{"code points", `{'s': '\x01é\U0001f600'}`, `{"s": "\u0001é😀"}`},
+		{"nesting", `{'r': {'x': [1, {'y': None}], 'z': []}}`, `{"r": {"x": [1, {"y": null}], "z": []}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pythonToJSON(tt.literal)
+			var gotValue, wantValue interface{}
+			if err := json.Unmarshal(got, &gotValue); err != nil {
+				t.Fatalf("pythonToJSON(%s) = %s, not JSON: %v", tt.literal, got, err)
+			}
+			json.Unmarshal([]byte(tt.want), &wantValue)
+			if !reflect.DeepEqual(gotValue, wantValue) {
+				t.Errorf("pythonToJSON(%s) = %s, want %s", tt.literal, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+)
+
+// oneShotIdle is how long a one-shot source waits for a message before it
+// checks whether its remaining partitions hold any messages at all
+const oneShotIdle = 5 * time.Second
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// OneShot stops a Kafka source at the high-water marks its topics had when
+// it was created, for backfills. It expects to be the only member of its
+// consumer group: partitions assigned to another member never finish.
+type OneShot struct {
+	Source
+	client    *kafka.Client
+	end       map[topicPartition]int64 // first offset not to read
+	next      map[topicPartition]int64 // offset after the last message read
+	remaining map[topicPartition]bool  // partitions not read up to end yet
+}
+
+// NewOneShot wraps src, which reads topics as group. startOffset is the
+// reader's start offset for partitions the group has no commit for.
+func NewOneShot(ctx context.Context, client *kafka.Client, src Source, group string, topics []string, startOffset int64) (*OneShot, error) {
+	s := &OneShot{
+		Source:    src,
+		client:    client,
+		end:       make(map[topicPartition]int64),
+		next:      make(map[topicPartition]int64),
+		remaining: make(map[topicPartition]bool),
+	}
+	for _, topic := range topics {
+		if err := s.addTopic(ctx, client, group, topic, startOffset); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// addTopic records the high-water marks of topic and which of its
+// partitions still have messages to read
+func (s *OneShot) addTopic(ctx context.Context, client *kafka.Client, group, topic string, startOffset int64) error {
+	partitions, err := Partitions(ctx, client, topic)
+	if err != nil {
+		return err
+	}
+	ends, err := listOffsets(ctx, client, topic, lastOffsets(partitions))
+	if err != nil {
+		return err
+	}
+	firsts := make([]kafka.OffsetRequest, len(partitions))
+	for i, p := range partitions {
+		firsts[i] = kafka.FirstOffsetOf(p)
+	}
+	starts, err := listOffsets(ctx, client, topic, firsts)
+	if err != nil {
+		return err
+	}
+
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: group,
+		Topics:  map[string][]int{topic: partitions},
+	})
+	if err == nil {
+		err = committed.Error
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch offsets of group %s on %s: %w", group, topic, err)
+	}
+	next := make(map[int]int64)
+	for _, p := range committed.Topics[topic] {
+		next[p.Partition] = p.CommittedOffset
+	}
+
+	for _, p := range partitions {
+		key := topicPartition{topic, p}
+		end := ends[p].LastOffset
+		start, ok := next[p]
+		if !ok || start < 0 {
+			start = end
+			if startOffset == kafka.FirstOffset {
+				start = starts[p].FirstOffset
+			}
+		}
+		s.end[key] = end
+		s.next[key] = start
+		if start < end {
+			s.remaining[key] = true
+		}
+	}
+	return nil
+}
+
+// Fetch returns the next message below the high-water marks, or ErrEOF once
+// every partition reached its mark. A partition whose last offsets are
+// transaction markers or were compacted away never delivers a message at
+// its mark, so once nothing arrives for a while the remaining partitions are
+// checked for messages left to read.
+func (s *OneShot) Fetch(ctx context.Context) (kafka.Message, error) {
+	for len(s.remaining) > 0 {
+		fetchCtx, cancel := context.WithTimeout(ctx, oneShotIdle)
+		msg, err := s.Source.Fetch(fetchCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			if err := s.finishIdle(ctx); err != nil {
+				return kafka.Message{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return msg, err
+		}
+		key := topicPartition{msg.Topic, msg.Partition}
+		end, ok := s.end[key]
+		if !ok {
+			// A partition created after the start
+			continue
+		}
+		s.next[key] = msg.Offset + 1
+		if msg.Offset >= end-1 {
+			delete(s.remaining, key)
+		}
+		if msg.Offset < end {
+			return msg, nil
+		}
+	}
+	return kafka.Message{}, ErrEOF
+}
+
+// finishIdle drops the remaining partitions in which a fetch from the next
+// offset returns no message below the high-water mark
+func (s *OneShot) finishIdle(ctx context.Context) error {
+	for key := range s.remaining {
+		resp, err := s.client.Fetch(ctx, &kafka.FetchRequest{
+			Topic:     key.topic,
+			Partition: key.partition,
+			Offset:    s.next[key],
+			MaxBytes:  1 << 20,
+			MaxWait:   100 * time.Millisecond,
+		})
+		if err == nil {
+			err = resp.Error
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check partition %d of %s: %w", key.partition, key.topic, err)
+		}
+		if !hasMessageBetween(resp.Records, s.next[key], s.end[key]) {
+			delete(s.remaining, key)
+		}
+	}
+	return nil
+}
+
+// hasMessageBetween reports whether records hold a message, not a
+// transaction marker, from offset next up to end. A fetch returns whole
+// batches, which may start before next.
+func hasMessageBetween(records kafka.RecordReader, next, end int64) bool {
+	if _, ok := records.(*protocol.ControlBatch); ok {
+		return false
+	}
+	for {
+		record, err := records.ReadRecord()
+		if err != nil {
+			return false
+		}
+		if record.Offset >= next && record.Offset < end {
+			return true
+		}
+	}
+}
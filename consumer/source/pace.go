@@ -0,0 +1,50 @@
+package source
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Paced replays a source with the original gaps between message times
+type Paced struct {
+	Source
+
+	first     time.Time // time of the first message
+	startedAt time.Time // wall clock when the first message was delivered
+}
+
+// NewPaced wraps src so Fetch waits until each message is due
+func NewPaced(src Source) *Paced {
+	return &Paced{Source: src}
+}
+
+// Fetch returns the next message once as much time has passed since the
+// first message as passed between the two message times
+func (p *Paced) Fetch(ctx context.Context) (kafka.Message, error) {
+	msg, err := p.Source.Fetch(ctx)
+	if err != nil || msg.Time.IsZero() {
+		return msg, err
+	}
+
+	if p.first.IsZero() {
+		p.first = msg.Time
+		p.startedAt = time.Now()
+		return msg, nil
+	}
+
+	wait := time.Until(p.startedAt.Add(msg.Time.Sub(p.first)))
+	if wait <= 0 {
+		return msg, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	case <-timer.C:
+		return msg, nil
+	}
+}
@@ -0,0 +1,80 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// messages serves msgs, then ErrEOF
+type messages struct {
+	msgs []kafka.Message
+}
+
+func (m *messages) Fetch(ctx context.Context) (kafka.Message, error) {
+	if len(m.msgs) == 0 {
+		return kafka.Message{}, ErrEOF
+	}
+	msg := m.msgs[0]
+	m.msgs = m.msgs[1:]
+	return msg, nil
+}
+
+func (m *messages) Commit(ctx context.Context, msgs ...kafka.Message) error { return nil }
+
+func (m *messages) Close() error { return nil }
+
+func TestPaced(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		offsets []time.Duration // message times after start, -1 for none
+		want    time.Duration
+	}{
+		{"original gaps", []time.Duration{0, 30 * time.Millisecond, 60 * time.Millisecond}, 60 * time.Millisecond},
+		{"messages without time are not held", []time.Duration{-1, -1}, 0},
+		{"out of order messages are not held", []time.Duration{60 * time.Millisecond, 0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &messages{}
+			for _, offset := range tt.offsets {
+				var at time.Time
+				if offset >= 0 {
+					at = start.Add(offset)
+				}
+				src.msgs = append(src.msgs, kafka.Message{Time: at})
+			}
+			p := NewPaced(src)
+
+			began := time.Now()
+			for range tt.offsets {
+				if _, err := p.Fetch(context.Background()); err != nil {
+					t.Fatalf("Fetch() = %v", err)
+				}
+			}
+			elapsed := time.Since(began)
+			if elapsed < tt.want || elapsed > tt.want+50*time.Millisecond {
+				t.Errorf("replay took %v, want %v", elapsed, tt.want)
+			}
+			if _, err := p.Fetch(context.Background()); !errors.Is(err, ErrEOF) {
+				t.Errorf("Fetch() at the end = %v, want ErrEOF", err)
+			}
+		})
+	}
+}
+
+func TestPacedCancelled(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	p := NewPaced(&messages{msgs: []kafka.Message{{Time: start}, {Time: start.Add(time.Hour)}}})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	p.Fetch(ctx)
+	if _, err := p.Fetch(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Fetch() of a message due in an hour = %v, want the context's error", err)
+	}
+}
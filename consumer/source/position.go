@@ -0,0 +1,235 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Position is where a consumer group starts reading its topics
+type Position struct {
+	// Kind is committed, earliest, latest, time or offsets
+	Kind string
+	// Time is the wall-clock time to start from for Kind time
+	Time time.Time
+	// Offsets is the next offset to read per partition for Kind offsets
+	Offsets []PartitionOffset
+}
+
+// PartitionOffset is an explicit start offset. An empty Topic stands for the
+// only topic consumed.
+type PartitionOffset struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// ParsePosition parses a start position: committed, earliest, latest, an
+// RFC 3339 time, a duration before now (e.g. 1h) or [topic:]partition:offset
+// triples separated by commas (e.g. 0:120,3:98 or group2:0:120)
+func ParsePosition(value string, now time.Time) (Position, error) {
+	switch v := strings.ToLower(strings.TrimSpace(value)); v {
+	case "", "committed":
+		return Position{Kind: "committed"}, nil
+	case "earliest", "latest":
+		return Position{Kind: v}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return Position{Kind: "time", Time: now.Add(-d)}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return Position{Kind: "time", Time: t}, nil
+	}
+
+	var offsets []PartitionOffset
+	for _, pair := range strings.Split(value, ",") {
+		fields := strings.Split(strings.TrimSpace(pair), ":")
+		var topic string
+		if len(fields) == 3 {
+			topic, fields = fields[0], fields[1:]
+		}
+		if len(fields) != 2 {
+			return Position{}, invalidPosition(value)
+		}
+		p, perr := strconv.Atoi(fields[0])
+		o, oerr := strconv.ParseInt(fields[1], 10, 64)
+		if perr != nil || oerr != nil || p < 0 || o < 0 {
+			return Position{}, invalidPosition(value)
+		}
+		offsets = append(offsets, PartitionOffset{Topic: topic, Partition: p, Offset: o})
+	}
+	return Position{Kind: "offsets", Offsets: offsets}, nil
+}
+
+func invalidPosition(value string) error {
+	return fmt.Errorf("invalid start position %q, expected committed, earliest, latest, a time, a duration or [topic:]partition:offset triples", value)
+}
+
+// ResetGroup commits pos as the group's offsets on topics, so the group's
+// next reader starts there. The group must have no active members. A
+// committed position leaves the offsets untouched, an offsets position only
+// moves the listed partitions.
+func ResetGroup(ctx context.Context, client *kafka.Client, group string, topics []string, pos Position) error {
+	commits := make(map[string][]kafka.OffsetCommit)
+	switch pos.Kind {
+	case "committed":
+		return nil
+	case "offsets":
+		for _, po := range pos.Offsets {
+			topic := po.Topic
+			if topic == "" {
+				if len(topics) != 1 {
+					return fmt.Errorf("start offset for partition %d needs a topic when consuming %d topics", po.Partition, len(topics))
+				}
+				topic = topics[0]
+			}
+			commits[topic] = append(commits[topic], kafka.OffsetCommit{Partition: po.Partition, Offset: po.Offset})
+		}
+	default:
+		for _, topic := range topics {
+			offsets, err := positionOffsets(ctx, client, topic, pos)
+			if err != nil {
+				return err
+			}
+			commits[topic] = offsets
+		}
+	}
+
+	resp, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      group,
+		GenerationID: -1,
+		Topics:       commits,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reset offsets of group %s: %w", group, err)
+	}
+	for topic, partitions := range resp.Topics {
+		for _, p := range partitions {
+			if p.Error != nil {
+				return fmt.Errorf("failed to reset offset of group %s on %s partition %d: %w", group, topic, p.Partition, p.Error)
+			}
+		}
+	}
+	return nil
+}
+
+// positionOffsets resolves an earliest, latest or time position to the
+// offset of every partition of topic
+func positionOffsets(ctx context.Context, client *kafka.Client, topic string, pos Position) ([]kafka.OffsetCommit, error) {
+	partitions, err := Partitions(ctx, client, topic)
+	if err != nil {
+		return nil, err
+	}
+	reqs := make([]kafka.OffsetRequest, len(partitions))
+	for i, p := range partitions {
+		switch pos.Kind {
+		case "earliest":
+			reqs[i] = kafka.FirstOffsetOf(p)
+		case "latest":
+			reqs[i] = kafka.LastOffsetOf(p)
+		default:
+			reqs[i] = kafka.TimeOffsetOf(p, pos.Time)
+		}
+	}
+	listed, err := listOffsets(ctx, client, topic, reqs)
+	if err != nil {
+		return nil, err
+	}
+	var latest map[int]kafka.PartitionOffsets
+	if pos.Kind == "time" {
+		// A time after the last message resolves to the end of the partition
+		if latest, err = listOffsets(ctx, client, topic, lastOffsets(partitions)); err != nil {
+			return nil, err
+		}
+	}
+
+	commits := make([]kafka.OffsetCommit, len(partitions))
+	for i, p := range partitions {
+		offset := listed[p].FirstOffset
+		switch pos.Kind {
+		case "latest":
+			offset = listed[p].LastOffset
+		case "time":
+			offset = latest[p].LastOffset
+			for o := range listed[p].Offsets {
+				if o >= 0 {
+					offset = o
+				}
+			}
+		}
+		commits[i] = kafka.OffsetCommit{Partition: p, Offset: offset}
+	}
+	return commits, nil
+}
+
+// MatchTopics returns the topics on the cluster whose name matches pattern,
+// leaving out internal topics
+func MatchTopics(ctx context.Context, client *kafka.Client, pattern *regexp.Regexp) ([]string, error) {
+	resp, err := client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list topics: %w", err)
+	}
+
+	var topics []string
+	for _, t := range resp.Topics {
+		if t.Error == nil && !t.Internal && pattern.MatchString(t.Name) {
+			topics = append(topics, t.Name)
+		}
+	}
+	return topics, nil
+}
+
+// Partitions returns the partition ids of topic
+func Partitions(ctx context.Context, client *kafka.Client, topic string) ([]int, error) {
+	resp, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata of topic %s: %w", topic, err)
+	}
+	for _, t := range resp.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil {
+			return nil, fmt.Errorf("failed to read metadata of topic %s: %w", topic, t.Error)
+		}
+		partitions := make([]int, len(t.Partitions))
+		for i, p := range t.Partitions {
+			partitions[i] = p.ID
+		}
+		return partitions, nil
+	}
+	return nil, fmt.Errorf("topic %s not found", topic)
+}
+
+func lastOffsets(partitions []int) []kafka.OffsetRequest {
+	reqs := make([]kafka.OffsetRequest, len(partitions))
+	for i, p := range partitions {
+		reqs[i] = kafka.LastOffsetOf(p)
+	}
+	return reqs
+}
+
+// listOffsets resolves reqs on topic, keyed by partition
+func listOffsets(ctx context.Context, client *kafka.Client, topic string, reqs []kafka.OffsetRequest) (map[int]kafka.PartitionOffsets, error) {
+	resp, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: reqs},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets of topic %s: %w", topic, err)
+	}
+
+	offsets := make(map[int]kafka.PartitionOffsets)
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to list offsets of topic %s partition %d: %w", topic, p.Partition, p.Error)
+		}
+		offsets[p.Partition] = p
+	}
+	return offsets, nil
+}
@@ -0,0 +1,76 @@
+package source
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestParsePosition(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    Position
+		wantErr bool
+	}{
+		{"", Position{Kind: "committed"}, false},
+		{"committed", Position{Kind: "committed"}, false},
+		{" Earliest ", Position{Kind: "earliest"}, false},
+		{"latest", Position{Kind: "latest"}, false},
+		{"0", Position{Kind: "time", Time: now}, false},
+		{"1h30m", Position{Kind: "time", Time: now.Add(-90 * time.Minute)}, false},
+		{"2024-05-01T10:00:00Z", Position{Kind: "time", Time: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}, false},
+		{"0:120", Position{Kind: "offsets", Offsets: []PartitionOffset{{Partition: 0, Offset: 120}}}, false},
+		{"0:120, 3:98", Position{Kind: "offsets", Offsets: []PartitionOffset{{Partition: 0, Offset: 120}, {Partition: 3, Offset: 98}}}, false},
+		{"group2:1:7,group3:0:0", Position{Kind: "offsets", Offsets: []PartitionOffset{{Topic: "group2", Partition: 1, Offset: 7}, {Topic: "group3", Partition: 0, Offset: 0}}}, false},
+
+		{"yesterday", Position{}, true},
+		{"0:x", Position{}, true},
+		{"-1:5", Position{}, true},
+		{"0:-5", Position{}, true},
+		{"a:b:0:1", Position{}, true},
+		{"0:1,", Position{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParsePosition(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePosition(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePosition(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasMessageBetween(t *testing.T) {
+	batch := func(offsets ...int64) kafka.RecordReader {
+		records := make([]kafka.Record, len(offsets))
+		for i, offset := range offsets {
+			records[i] = kafka.Record{Offset: offset}
+		}
+		return kafka.NewRecordReader(records...)
+	}
+	tests := []struct {
+		name      string
+		records   kafka.RecordReader
+		next, end int64
+		want      bool
+	}{
+		{"message in range", batch(5, 6), 5, 7, true},
+		{"batch starts before next", batch(3, 4, 5), 5, 7, true},
+		{"only messages before next", batch(3, 4), 5, 7, false},
+		{"only the end offset", batch(7), 5, 7, false},
+		{"empty batch", batch(), 5, 7, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasMessageBetween(tt.records, tt.next, tt.end); got != tt.want {
+				t.Errorf("hasMessageBetween() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package source
+
+import (
+	"context"
+	"errors"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrEOF is returned by Fetch once a finite source is exhausted
+var ErrEOF = errors.New("end of source")
+
+// Source delivers raw messages whose value is an Avro OCF container. Files
+// and log dumps are presented as Kafka messages so the processing path is
+// identical for live and replayed data.
+type Source interface {
+	// Fetch blocks until the next message is available
+	Fetch(ctx context.Context) (kafka.Message, error)
+	// Commit marks messages as processed
+	Commit(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaSource reads from a Kafka topic through a consumer group
+type KafkaSource struct {
+	reader *kafka.Reader
+}
+
+// NewKafkaSource wraps reader
+func NewKafkaSource(reader *kafka.Reader) *KafkaSource {
+	return &KafkaSource{reader: reader}
+}
+
+// Fetch returns the next message without committing it
+func (s *KafkaSource) Fetch(ctx context.Context) (kafka.Message, error) {
+	return s.reader.FetchMessage(ctx)
+}
+
+// Commit commits the offsets of msgs for the consumer group
+func (s *KafkaSource) Commit(ctx context.Context, msgs ...kafka.Message) error {
+	return s.reader.CommitMessages(ctx, msgs...)
+}
+
+// Close closes the reader
+func (s *KafkaSource) Close() error {
+	return s.reader.Close()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"assignment2/events"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestProcessorHandlesWithTopic(t *testing.T) {
+	var topics []string
+	dispatcher := events.NewDispatcher()
+	dispatcher.RegisterFunc(events.ExperimentStartedName, func(ctx context.Context, event events.Event) error {
+		topics = append(topics, events.Topic(ctx))
+		return nil
+	})
+	p := &processor{dispatcher: dispatcher}
+	started := []events.Event{&events.ExperimentStarted{Experiment: "exp"}}
+
+	for _, topic := range []string{"group2", "group3"} {
+		if err := p.handle(context.Background(), kafka.Message{Topic: topic}, started); err != nil {
+			t.Fatalf("handle() = %v", err)
+		}
+	}
+	if want := []string{"group2", "group3"}; !reflect.DeepEqual(topics, want) {
+		t.Errorf("handlers saw topics %q, want %q", topics, want)
+	}
+}
+
+func TestWithoutTopic(t *testing.T) {
+	tests := []struct {
+		topics []string
+		topic  string
+		want   []string
+	}{
+		{[]string{"group2", "group2-dlq", "group3"}, "group2-dlq", []string{"group2", "group3"}},
+		{[]string{"group2"}, "", []string{"group2"}},
+		{[]string{"group2-dlq"}, "group2-dlq", nil},
+	}
+	for _, tt := range tests {
+		if got := withoutTopic(tt.topics, tt.topic); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("withoutTopic(%q, %q) = %q, want %q", tt.topics, tt.topic, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package verify
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+type measurementKey struct {
+	experiment    string
+	measurementID string
+}
+
+// openedHash is the hash of a measurement, opened once for all its readings
+type openedHash struct {
+	hash  string
+	claim Claim
+	err   error
+
+	settled atomic.Bool
+}
+
+// settle reports whether this is the first result for the measurement
+func (o *openedHash) settle() bool {
+	return o.settled.CompareAndSwap(false, true)
+}
+
+type cachedHash struct {
+	key    measurementKey
+	opened *openedHash
+}
+
+// measurementCache keeps the opened hashes of recent measurements. The
+// least recently used one is evicted once the cache is full.
+type measurementCache struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List // front is most recently used
+	items map[measurementKey]*list.Element
+}
+
+func newMeasurementCache(size int) *measurementCache {
+	return &measurementCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[measurementKey]*list.Element),
+	}
+}
+
+// Get returns the opened hash of a measurement, or nil
+func (c *measurementCache) Get(key measurementKey) *openedHash {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedHash).opened
+}
+
+// Add stores the opened hash of a measurement, evicting the least recently
+// used one if needed
+func (c *measurementCache) Add(key measurementKey, opened *openedHash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*cachedHash).opened = opened
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cachedHash{key: key, opened: opened})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cachedHash).key)
+	}
+}
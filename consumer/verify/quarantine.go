@@ -0,0 +1,88 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"assignment2/aggregate"
+	"assignment2/events"
+)
+
+// quarantined is a single line of a quarantine file
+type quarantined struct {
+	Measurement *events.SensorTemperatureMeasured `json:"measurement"`
+	Error       string                            `json:"error"`
+	DetectedAt  time.Time                         `json:"detected_at"`
+}
+
+// Quarantine appends readings that failed verification to one NDJSON file
+// per experiment. It is kept apart from the dead-letter store, which holds
+// messages that could not be decoded at all.
+type Quarantine struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewQuarantine creates the quarantine directory if needed
+func NewQuarantine(dir string) (*Quarantine, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create tamper quarantine directory: %w", err)
+	}
+	return &Quarantine{dir: dir}, nil
+}
+
+// Put appends m and the reason it failed to <experiment>.ndjson
+func (q *Quarantine) Put(m *events.SensorTemperatureMeasured, reason error) error {
+	return q.write(m.Experiment, []*events.SensorTemperatureMeasured{m}, reason)
+}
+
+// PutGroup appends every reading of a group that failed as a whole, one
+// line each, to <experiment>.ndjson
+func (q *Quarantine) PutGroup(group aggregate.Group, reason error) error {
+	measurements := make([]*events.SensorTemperatureMeasured, len(group.Readings))
+	for i, reading := range group.Readings {
+		measurements[i] = &events.SensorTemperatureMeasured{
+			Experiment:      group.ExperimentID,
+			Sensor:          reading.Sensor,
+			MeasurementID:   group.MeasurementID,
+			Timestamp:       group.Timestamp,
+			Temperature:     reading.Temperature,
+			MeasurementHash: group.Hash,
+			Tampered:        reading.Tampered,
+		}
+	}
+	return q.write(group.ExperimentID, measurements, reason)
+}
+
+func (q *Quarantine) write(experiment string, measurements []*events.SensorTemperatureMeasured, reason error) error {
+	var lines []byte
+	for _, m := range measurements {
+		line, err := json.Marshal(quarantined{
+			Measurement: m,
+			Error:       reason.Error(),
+			DetectedAt:  time.Now().UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal quarantined measurement: %w", err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(q.dir, filepath.Base(experiment)+".ndjson"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open tamper quarantine file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(lines); err != nil {
+		return fmt.Errorf("failed to write tamper quarantine file: %w", err)
+	}
+	return nil
+}
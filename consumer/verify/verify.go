@@ -0,0 +1,349 @@
+package verify
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"assignment2/aggregate"
+	"assignment2/events"
+)
+
+var (
+	// ErrTampered is returned when a hash does not match its measurement
+	ErrTampered = errors.New("measurement does not match its hash")
+	// ErrMalformed is returned when a hash cannot be parsed or decrypted
+	ErrMalformed = errors.New("malformed measurement hash")
+	// ErrUnverifiable is returned when a hash is authentic but what it
+	// attests cannot be compared with the readings
+	ErrUnverifiable = errors.New("measurement hash cannot be checked")
+)
+
+// Claim is what a measurement hash attests. The hash belongs to the whole
+// measurement: every sensor's reading with the same measurement id carries
+// the same hash. Fields the plaintext does not hold are left empty.
+type Claim struct {
+	Experiment    string
+	MeasurementID string
+	// Temperature is the temperature of the measurement, the mean of its
+	// sensors' readings
+	Temperature *float64
+}
+
+// Verifier authenticates measurement hashes
+type Verifier interface {
+	// Open returns what hash attests, ErrTampered if it was altered and
+	// ErrMalformed if it cannot be read
+	Open(hash string) (Claim, error)
+}
+
+// Policy decides what happens to a measurement that fails verification
+type Policy string
+
+const (
+	// PolicyOff disables verification
+	PolicyOff Policy = "off"
+	// PolicyMark forwards failing measurements with Tampered set
+	PolicyMark Policy = "mark"
+	// PolicyReject drops failing measurements after quarantining them
+	PolicyReject Policy = "reject"
+)
+
+// ParsePolicy validates a policy name
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(strings.ToLower(name)); p {
+	case PolicyOff, PolicyMark, PolicyReject:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown hash policy %q, expected off, mark or reject", name)
+	}
+}
+
+// New returns the verifier for the named algorithm
+func New(algorithm string, key []byte) (Verifier, error) {
+	switch strings.ToLower(algorithm) {
+	case "aes-gcm":
+		return NewAESGCM(key)
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", algorithm)
+	}
+}
+
+// Counters holds how many measurements passed or failed verification. Each
+// measurement is counted once, by its first result.
+type Counters struct {
+	Verified     atomic.Int64
+	Tampered     atomic.Int64
+	Malformed    atomic.Int64
+	Unverifiable atomic.Int64
+}
+
+// measurementCacheSize bounds the number of measurements whose opened hash
+// is kept until their group is emitted
+const measurementCacheSize = 10000
+
+// Stage verifies measurements in two steps. Each reading is checked as it
+// is dispatched: its hash must be authentic, name its measurement and be
+// the same as the other readings' of the measurement. Once the
+// measurement's group is emitted, the mean of its readings is compared with
+// the temperature the hash attests.
+type Stage struct {
+	verifier     Verifier
+	policy       Policy
+	quarantine   *Quarantine
+	counters     Counters
+	measurements *measurementCache
+}
+
+// NewStage creates a verification stage. quarantine may be nil.
+func NewStage(verifier Verifier, policy Policy, quarantine *Quarantine) *Stage {
+	return &Stage{
+		verifier:     verifier,
+		policy:       policy,
+		quarantine:   quarantine,
+		measurements: newMeasurementCache(measurementCacheSize),
+	}
+}
+
+// Counters returns the stage's counters
+func (s *Stage) Counters() *Counters {
+	return &s.counters
+}
+
+// Register installs the stage as the first measurement handler. It must be
+// registered before any handler that consumes measurements.
+func (s *Stage) Register(d *events.Dispatcher) {
+	d.RegisterFunc(events.SensorTemperatureMeasuredName, s.handle)
+}
+
+func (s *Stage) handle(ctx context.Context, event events.Event) error {
+	m := event.(*events.SensorTemperatureMeasured)
+
+	opened := s.open(m.Experiment, m.MeasurementID, m.MeasurementHash)
+	err := opened.err
+	if err == nil && m.MeasurementHash != opened.hash {
+		err = fmt.Errorf("%w: hash differs from the other readings of the measurement", ErrTampered)
+	}
+	if err == nil {
+		return nil
+	}
+	s.settle(opened, err)
+
+	log.Printf("Measurement %s of sensor %s in experiment %s failed verification: %v",
+		m.MeasurementID, m.Sensor, m.Experiment, err)
+
+	m.Tampered = true
+	if s.quarantine != nil {
+		if qerr := s.quarantine.Put(m, err); qerr != nil {
+			return qerr
+		}
+	}
+
+	if s.policy == PolicyReject {
+		return events.ErrSkip
+	}
+	return nil
+}
+
+// Group returns an emit function that compares every group with the
+// temperature its hash attests before handing it to next. A group that
+// does not match has all its readings marked as tampered, or is dropped by
+// the reject policy. Partial groups cannot be compared and count as
+// unverifiable.
+func (s *Stage) Group(next aggregate.EmitFunc) aggregate.EmitFunc {
+	return func(ctx context.Context, group aggregate.Group) error {
+		for _, reading := range group.Readings {
+			if reading.Tampered {
+				// The measurement already failed reading by reading
+				return next(ctx, group)
+			}
+		}
+
+		opened := s.open(group.ExperimentID, group.MeasurementID, group.Hash)
+		err := opened.err
+		if err == nil {
+			err = checkMean(opened.claim, group)
+		}
+		s.settle(opened, err)
+		if err == nil || errors.Is(err, ErrUnverifiable) {
+			return next(ctx, group)
+		}
+
+		log.Printf("Measurement %s in experiment %s failed verification: %v",
+			group.MeasurementID, group.ExperimentID, err)
+
+		group.Readings = append([]aggregate.Reading(nil), group.Readings...)
+		for i := range group.Readings {
+			group.Readings[i].Tampered = true
+		}
+		if s.quarantine != nil {
+			if qerr := s.quarantine.PutGroup(group, err); qerr != nil {
+				return qerr
+			}
+		}
+
+		if s.policy == PolicyReject {
+			return nil
+		}
+		return next(ctx, group)
+	}
+}
+
+// open returns the opened hash of a measurement, opening hash if the
+// measurement was not seen yet or its cached hash is a different one
+func (s *Stage) open(experiment, measurementID, hash string) *openedHash {
+	key := measurementKey{experiment: experiment, measurementID: measurementID}
+	if opened := s.measurements.Get(key); opened != nil {
+		return opened
+	}
+
+	opened := &openedHash{hash: hash}
+	opened.claim, opened.err = s.verifier.Open(hash)
+	if opened.err == nil {
+		opened.err = opened.claim.check(experiment, measurementID)
+	}
+	s.measurements.Add(key, opened)
+	return opened
+}
+
+// settle counts the result of a measurement unless it was counted already
+func (s *Stage) settle(opened *openedHash, err error) {
+	if !opened.settle() {
+		return
+	}
+	switch {
+	case err == nil:
+		s.counters.Verified.Add(1)
+	case errors.Is(err, ErrUnverifiable):
+		s.counters.Unverifiable.Add(1)
+	case errors.Is(err, ErrMalformed):
+		s.counters.Malformed.Add(1)
+	default:
+		s.counters.Tampered.Add(1)
+	}
+}
+
+// check compares the measurement a claim names, if any, with the one
+// carrying its hash
+func (c Claim) check(experiment, measurementID string) error {
+	if c.Experiment != "" && c.Experiment != experiment {
+		return fmt.Errorf("%w: hash belongs to experiment %s", ErrTampered, c.Experiment)
+	}
+	if c.MeasurementID != "" && c.MeasurementID != measurementID {
+		return fmt.Errorf("%w: hash belongs to measurement %s", ErrTampered, c.MeasurementID)
+	}
+	return nil
+}
+
+// checkMean compares the mean of a complete group with the temperature
+// the claim attests
+func checkMean(claim Claim, group aggregate.Group) error {
+	if claim.Temperature == nil {
+		return fmt.Errorf("%w: hash holds no temperature", ErrUnverifiable)
+	}
+	if group.Partial || len(group.Readings) == 0 {
+		return fmt.Errorf("%w: not every sensor reported", ErrUnverifiable)
+	}
+
+	sum := 0.0
+	for _, reading := range group.Readings {
+		sum += reading.Temperature
+	}
+	mean := sum / float64(len(group.Readings))
+	if !sameTemperature(*claim.Temperature, mean) {
+		return fmt.Errorf("%w: hash holds %v, readings average %v", ErrTampered, *claim.Temperature, mean)
+	}
+	return nil
+}
+
+// AESGCM opens hashes of the form base64(nonce) "." base64(ciphertext),
+// where the ciphertext is the AES-GCM encrypted measurement
+type AESGCM struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCM creates a verifier for a 16, 24 or 32 byte AES key
+func NewAESGCM(key []byte) (*AESGCM, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AES key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCM{aead: aead}, nil
+}
+
+// Open decrypts the hash and reads what its plaintext attests
+func (v *AESGCM) Open(hash string) (Claim, error) {
+	ivPart, ctPart, ok := strings.Cut(hash, ".")
+	if !ok {
+		return Claim{}, fmt.Errorf("%w: missing separator", ErrMalformed)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(ivPart)
+	if err != nil {
+		return Claim{}, fmt.Errorf("%w: nonce: %v", ErrMalformed, err)
+	}
+	ciphertext, err := decodeBase64(ctPart)
+	if err != nil {
+		return Claim{}, fmt.Errorf("%w: ciphertext: %v", ErrMalformed, err)
+	}
+	if len(nonce) != v.aead.NonceSize() {
+		return Claim{}, fmt.Errorf("%w: nonce is %d bytes, expected %d", ErrMalformed, len(nonce), v.aead.NonceSize())
+	}
+
+	plaintext, err := v.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		// Authentication failed, the hash was altered or made with another key
+		return Claim{}, fmt.Errorf("%w: %v", ErrTampered, err)
+	}
+	return parseClaim(plaintext), nil
+}
+
+// decodeBase64 accepts padded and unpadded standard base64
+func decodeBase64(value string) ([]byte, error) {
+	if data, err := base64.StdEncoding.DecodeString(value); err == nil {
+		return data, nil
+	}
+	return base64.RawStdEncoding.DecodeString(value)
+}
+
+// parseClaim reads the plaintext either as a bare temperature or as a JSON
+// object with experiment, measurement_id and temperature fields. Any other
+// plaintext is authentic but attests nothing the consumer can check.
+func parseClaim(plaintext []byte) Claim {
+	text := strings.TrimSpace(string(plaintext))
+	if value, err := strconv.ParseFloat(text, 64); err == nil {
+		return Claim{Temperature: &value}
+	}
+
+	var payload struct {
+		Experiment    string   `json:"experiment"`
+		MeasurementID string   `json:"measurement_id"`
+		Temperature   *float64 `json:"temperature"`
+	}
+	if err := json.Unmarshal([]byte(text), &payload); err != nil {
+		return Claim{}
+	}
+	return Claim{
+		Experiment:    payload.Experiment,
+		MeasurementID: payload.MeasurementID,
+		Temperature:   payload.Temperature,
+	}
+}
+
+// sameTemperature compares with the precision of an Avro float, which is
+// what the readings travelled as
+func sameTemperature(a, b float64) bool {
+	return float32(a) == float32(b) || math.Abs(a-b) <= 1e-6*math.Max(math.Abs(a), math.Abs(b))
+}
@@ -0,0 +1,321 @@
+package verify
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"assignment2/aggregate"
+	"assignment2/events"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+// seal encrypts plaintext into a hash the way the producer does
+func seal(t *testing.T, key []byte, plaintext string, encoding *base64.Encoding) string {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	for i := range nonce {
+		nonce[i] = byte(i)
+	}
+	ciphertext := aead.Seal(nil, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(nonce) + "." + encoding.EncodeToString(ciphertext)
+}
+
+func temperature(value float64) *float64 {
+	return &value
+}
+
+func TestAESGCMOpen(t *testing.T) {
+	v, err := NewAESGCM(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := seal(t, testKey, "20.5", base64.StdEncoding)
+
+	tests := []struct {
+		name    string
+		hash    string
+		want    Claim
+		wantErr error
+	}{
+		{"bare temperature", valid, Claim{Temperature: temperature(20.5)}, nil},
+		{"unpadded ciphertext", seal(t, testKey, "20.5", base64.RawStdEncoding), Claim{Temperature: temperature(20.5)}, nil},
+		{
+			"json claim",
+			seal(t, testKey, `{"experiment": "exp", "measurement_id": "m1", "temperature": 21}`, base64.StdEncoding),
+			Claim{Experiment: "exp", MeasurementID: "m1", Temperature: temperature(21)},
+			nil,
+		},
+		{"json claim without temperature", seal(t, testKey, `{"experiment": "exp"}`, base64.StdEncoding), Claim{Experiment: "exp"}, nil},
+		{"opaque plaintext", seal(t, testKey, "sensor-ok", base64.StdEncoding), Claim{}, nil},
+		{"other key", seal(t, []byte("fedcba9876543210"), "20.5", base64.StdEncoding), Claim{}, ErrTampered},
+		{"altered ciphertext", valid[:len(valid)-4] + "AAA=", Claim{}, ErrTampered},
+		{"no separator", "abc", Claim{}, ErrMalformed},
+		{"invalid nonce", "!!!.abc", Claim{}, ErrMalformed},
+		{"invalid ciphertext", base64.StdEncoding.EncodeToString(make([]byte, 12)) + ".!!!", Claim{}, ErrMalformed},
+		{"short nonce", "AAAA.AAAA", Claim{}, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Open(tt.hash)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Open() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Open() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeVerifier returns fixed claims by hash and counts how often each hash
+// is opened
+type fakeVerifier struct {
+	claims map[string]Claim
+	errs   map[string]error
+	opened map[string]int
+}
+
+func (v *fakeVerifier) Open(hash string) (Claim, error) {
+	v.opened[hash]++
+	if err := v.errs[hash]; err != nil {
+		return Claim{}, err
+	}
+	return v.claims[hash], nil
+}
+
+// reading is a measurement of exp/m1 by sensor with the given hash
+func reading(sensor, hash string, value float64) *events.SensorTemperatureMeasured {
+	return &events.SensorTemperatureMeasured{
+		Experiment:      "exp",
+		Sensor:          sensor,
+		MeasurementID:   "m1",
+		Timestamp:       1,
+		Temperature:     value,
+		MeasurementHash: hash,
+	}
+}
+
+func TestStage(t *testing.T) {
+	verifier := func() *fakeVerifier {
+		return &fakeVerifier{
+			claims: map[string]Claim{
+				"mean20":   {Experiment: "exp", MeasurementID: "m1", Temperature: temperature(20)},
+				"mean25":   {Temperature: temperature(25)},
+				"other":    {MeasurementID: "m2", Temperature: temperature(20)},
+				"nothing":  {},
+				"mean20-b": {Temperature: temperature(20)},
+			},
+			errs: map[string]error{
+				"garbage": ErrMalformed,
+				"forged":  ErrTampered,
+			},
+			opened: make(map[string]int),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		readings []*events.SensorTemperatureMeasured
+		partial  bool
+		// tampered readings by sensor, nil if the group is not forwarded
+		want        map[string]bool
+		counters    [4]int64 // verified, tampered, malformed, unverifiable
+		quarantined int
+	}{
+		{
+			name:     "mean matches",
+			policy:   PolicyMark,
+			readings: []*events.SensorTemperatureMeasured{reading("a", "mean20", 19), reading("b", "mean20", 21)},
+			want:     map[string]bool{"a": false, "b": false},
+			counters: [4]int64{1, 0, 0, 0},
+		},
+		{
+			name:        "mean differs",
+			policy:      PolicyMark,
+			readings:    []*events.SensorTemperatureMeasured{reading("a", "mean25", 19), reading("b", "mean25", 21)},
+			want:        map[string]bool{"a": true, "b": true},
+			counters:    [4]int64{0, 1, 0, 0},
+			quarantined: 2,
+		},
+		{
+			name:        "mean differs rejected",
+			policy:      PolicyReject,
+			readings:    []*events.SensorTemperatureMeasured{reading("a", "mean25", 19), reading("b", "mean25", 21)},
+			counters:    [4]int64{0, 1, 0, 0},
+			quarantined: 2,
+		},
+		{
+			name:        "hash differs between readings",
+			policy:      PolicyMark,
+			readings:    []*events.SensorTemperatureMeasured{reading("a", "mean20", 19), reading("b", "mean20-b", 21)},
+			want:        map[string]bool{"a": false, "b": true},
+			counters:    [4]int64{0, 1, 0, 0},
+			quarantined: 1,
+		},
+		{
+			name:        "hash of another measurement",
+			policy:      PolicyMark,
+			readings:    []*events.SensorTemperatureMeasured{reading("a", "other", 20), reading("b", "other", 20)},
+			want:        map[string]bool{"a": true, "b": true},
+			counters:    [4]int64{0, 1, 0, 0},
+			quarantined: 2,
+		},
+		{
+			name:        "forged hash rejected",
+			policy:      PolicyReject,
+			readings:    []*events.SensorTemperatureMeasured{reading("a", "forged", 20), reading("b", "forged", 20)},
+			counters:    [4]int64{0, 1, 0, 0},
+			quarantined: 2,
+		},
+		{
+			name:        "malformed hash",
+			policy:      PolicyMark,
+			readings:    []*events.SensorTemperatureMeasured{reading("a", "garbage", 20)},
+			want:        map[string]bool{"a": true},
+			counters:    [4]int64{0, 0, 1, 0},
+			quarantined: 1,
+		},
+		{
+			name:     "partial group",
+			policy:   PolicyReject,
+			readings: []*events.SensorTemperatureMeasured{reading("a", "mean25", 19)},
+			partial:  true,
+			want:     map[string]bool{"a": false},
+			counters: [4]int64{0, 0, 0, 1},
+		},
+		{
+			name:     "hash without temperature",
+			policy:   PolicyReject,
+			readings: []*events.SensorTemperatureMeasured{reading("a", "nothing", 19), reading("b", "nothing", 21)},
+			want:     map[string]bool{"a": false, "b": false},
+			counters: [4]int64{0, 0, 0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := verifier()
+			dir := t.TempDir()
+			quarantine, err := NewQuarantine(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewStage(v, tt.policy, quarantine)
+
+			// Readings the stage does not skip reach the aggregator
+			group := aggregate.Group{ExperimentID: "exp", MeasurementID: "m1", Timestamp: 1, Partial: tt.partial}
+			for _, m := range tt.readings {
+				err := s.handle(context.Background(), m)
+				if errors.Is(err, events.ErrSkip) {
+					continue
+				}
+				if err != nil {
+					t.Fatalf("handle(%s) = %v", m.Sensor, err)
+				}
+				if group.Hash == "" {
+					group.Hash = m.MeasurementHash
+				}
+				group.Readings = append(group.Readings, aggregate.Reading{Sensor: m.Sensor, Temperature: m.Temperature, Tampered: m.Tampered})
+			}
+
+			var forwarded *aggregate.Group
+			if len(group.Readings) > 0 {
+				emit := s.Group(func(ctx context.Context, g aggregate.Group) error {
+					forwarded = &g
+					return nil
+				})
+				if err := emit(context.Background(), group); err != nil {
+					t.Fatalf("emit() = %v", err)
+				}
+			}
+
+			var got map[string]bool
+			if forwarded != nil {
+				got = make(map[string]bool)
+				for _, r := range forwarded.Readings {
+					got[r.Sensor] = r.Tampered
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("forwarded %v, want %v", got, tt.want)
+			}
+
+			c := s.Counters()
+			counters := [4]int64{c.Verified.Load(), c.Tampered.Load(), c.Malformed.Load(), c.Unverifiable.Load()}
+			if counters != tt.counters {
+				t.Errorf("counters (verified, tampered, malformed, unverifiable) = %v, want %v", counters, tt.counters)
+			}
+			for hash, n := range v.opened {
+				if n != 1 {
+					t.Errorf("hash %s opened %d times, want once per measurement", hash, n)
+				}
+			}
+			if got := lines(t, filepath.Join(dir, "exp.ndjson")); got != tt.quarantined {
+				t.Errorf("quarantined %d readings, want %d", got, tt.quarantined)
+			}
+		})
+	}
+}
+
+// lines counts the lines of a file, 0 if it does not exist
+func lines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	n := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		n++
+	}
+	return n
+}
+
+func TestSameTemperature(t *testing.T) {
+	tests := []struct {
+		a, b float64
+		want bool
+	}{
+		{20, 20, true},
+		{20.1, float64(float32(20.1)), true},
+		{(19.3 + 20.7 + 21.1) / 3, float64(float32(19.3)+float32(20.7)+float32(21.1)) / 3, true},
+		{20, 20.01, false},
+		{-5, 5, false},
+	}
+	for _, tt := range tests {
+		if got := sameTemperature(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameTemperature(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for name, want := range map[string]Policy{"off": PolicyOff, "Mark": PolicyMark, "REJECT": PolicyReject, "drop": ""} {
+		got, err := ParsePolicy(name)
+		if got != want || (err != nil) != (want == "") {
+			t.Errorf("ParsePolicy(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
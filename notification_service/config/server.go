@@ -0,0 +1,13 @@
+package config
+
+// ServerConfig holds HTTP server configuration
+type ServerConfig struct {
+	Port string
+}
+
+// GetServerConfig returns server configuration from environment variables
+func GetServerConfig() *ServerConfig {
+	return &ServerConfig{
+		Port: getEnv("HTTP_PORT", "8082"),
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"notification_service/models"
+)
+
+// maxAverageSize bounds the body of a single average request
+const maxAverageSize = 1 << 16
+
+// topicHeader carries the Kafka topic the measurements were read from
+const topicHeader = "X-Source-Topic"
+
+// AverageHandler receives the averages and alerts of average_calc_service
+type AverageHandler struct{}
+
+// NewAverageHandler creates a new average handler
+func NewAverageHandler() *AverageHandler {
+	return &AverageHandler{}
+}
+
+// Register adds the average routes to mux
+func (h *AverageHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /averages", h.receiveAverage)
+	mux.HandleFunc("POST /alerts", h.receiveAlert)
+}
+
+// receiveAverage handles POST /averages with an AverageMeasurement as JSON body
+func (h *AverageHandler) receiveAverage(w http.ResponseWriter, r *http.Request) {
+	var avg models.AverageMeasurement
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAverageSize)).Decode(&avg); err != nil {
+		http.Error(w, "invalid average: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if avg.ExperimentID == "" {
+		http.Error(w, "invalid average: experiment_id is required", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Average of experiment %s at %f: %f over %d measurements (revision %d) from topic %q",
+		avg.ExperimentID, avg.Timestamp, avg.AvgMeasurement, avg.MeasurementCount, avg.Revision, r.Header.Get(topicHeader))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// receiveAlert handles POST /alerts with an Alert as JSON body
+func (h *AverageHandler) receiveAlert(w http.ResponseWriter, r *http.Request) {
+	var alert models.Alert
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAverageSize)).Decode(&alert); err != nil {
+		http.Error(w, "invalid alert: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if alert.ExperimentID == "" || (alert.Type != "out_of_range" && alert.Type != "back_in_range") {
+		http.Error(w, "invalid alert: experiment_id and a type of out_of_range or back_in_range are required", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("ALERT %s for experiment %s at %f: average %f, range [%f, %f], excursion since %f, from topic %q",
+		alert.Type, alert.ExperimentID, alert.Timestamp, alert.AvgMeasurement, alert.LowerThreshold, alert.UpperThreshold,
+		alert.ExcursionStart, r.Header.Get(topicHeader))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"log"
+	"net/http"
 	"time"
 
 	"notification_service/config"
+	"notification_service/handlers"
 	"notification_service/models"
 	"notification_service/services"
 )
@@ -27,10 +29,15 @@ func main() {
 	// Demonstrate notification service functionality
 	demonstrateNotificationService(notificationService)
 
-	log.Println("Notification service is running...")
-	
-	// Keep the service running
-	select {}
+	// Receive the averages and alerts of average_calc_service
+	mux := http.NewServeMux()
+	handlers.NewAverageHandler().Register(mux)
+
+	addr := ":" + config.GetServerConfig().Port
+	log.Printf("Notification service is running, listening on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatal("HTTP server failed:", err)
+	}
 }
 
 func demonstrateNotificationService(ns *services.NotificationService) {
@@ -58,4 +58,31 @@ type NotificationRequest struct {
 	Type       string                 `json:"type" validate:"required,oneof=email sms push"`
 	TemplateID *uint                  `json:"template_id,omitempty"`
 	Variables  map[string]interface{} `json:"variables,omitempty"`
-}
\ No newline at end of file
+}
+
+// AverageMeasurement mirrors the average of a measurement group sent by
+// average_calc_service
+type AverageMeasurement struct {
+	ExperimentID     string  `json:"experiment_id"`
+	MeasurementID    string  `json:"measurement_id"`
+	Timestamp        float64 `json:"timestamp"`
+	Started          bool    `json:"started"`
+	AvgMeasurement   float64 `json:"avg_measurement"`
+	MeasurementCount int     `json:"measurement_count"`
+	Partial          bool    `json:"partial"`
+	TamperedCount    int     `json:"tampered_count"`
+	Revision         int     `json:"revision"`
+}
+
+// Alert mirrors an out-of-range or back-in-range alert sent by
+// average_calc_service
+type Alert struct {
+	ExperimentID   string  `json:"experiment_id"`
+	MeasurementID  string  `json:"measurement_id"`
+	Timestamp      float64 `json:"timestamp"`
+	Type           string  `json:"type"` // out_of_range or back_in_range
+	AvgMeasurement float64 `json:"avg_measurement"`
+	LowerThreshold float64 `json:"lower_threshold"`
+	UpperThreshold float64 `json:"upper_threshold"`
+	ExcursionStart float64 `json:"excursion_start"`
+}
@@ -34,6 +34,18 @@ func GetDatabaseConfig() *DatabaseConfig {
 	}
 }
 
+// ServerConfig holds HTTP server configuration
+type ServerConfig struct {
+	Port string
+}
+
+// GetServerConfig returns server configuration from environment variables
+func GetServerConfig() *ServerConfig {
+	return &ServerConfig{
+		Port: getEnv("HTTP_PORT", "8080"),
+	}
+}
+
 // ConnectDatabase initializes the database connection
 func ConnectDatabase() error {
 	config := GetDatabaseConfig()
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"postgres_service/models"
+	"postgres_service/services"
+)
+
+// maxEventSize bounds the body of a single event request
+const maxEventSize = 1 << 20
+
+// topicHeader carries the Kafka topic the consumer read the event from
+const topicHeader = "X-Source-Topic"
+
+// EventHandler exposes the experiment service over HTTP
+type EventHandler struct {
+	experiments *services.ExperimentService
+}
+
+// NewEventHandler creates a new event handler
+func NewEventHandler(experiments *services.ExperimentService) *EventHandler {
+	return &EventHandler{
+		experiments: experiments,
+	}
+}
+
+// Register adds the event routes to mux
+func (h *EventHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /events/{type}", h.recordEvent)
+	mux.HandleFunc("GET /experiments/{id}", h.getExperiment)
+	mux.HandleFunc("POST /violations", h.recordViolation)
+	mux.HandleFunc("GET /experiments/{id}/violations", h.getViolations)
+}
+
+// recordEvent handles POST /events/{type} with the event as JSON body
+func (h *EventHandler) recordEvent(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEventSize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.experiments.RecordEvent(r.PathValue("type"), r.Header.Get(topicHeader), payload); err != nil {
+		if errors.Is(err, services.ErrInvalidEvent) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error recording event: %v", err)
+		http.Error(w, "failed to record event", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordViolation handles POST /violations with a lifecycle violation as JSON body
+func (h *EventHandler) recordViolation(w http.ResponseWriter, r *http.Request) {
+	var req models.ViolationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventSize)).Decode(&req); err != nil {
+		http.Error(w, "invalid violation: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	violation, err := h.experiments.RecordViolation(req, r.Header.Get(topicHeader))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidEvent) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error recording violation: %v", err)
+		http.Error(w, "failed to record violation", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, violation)
+}
+
+// getViolations handles GET /experiments/{id}/violations
+func (h *EventHandler) getViolations(w http.ResponseWriter, r *http.Request) {
+	violations, err := h.experiments.GetViolations(r.PathValue("id"))
+	if err != nil {
+		log.Printf("Error getting violations: %v", err)
+		http.Error(w, "failed to get violations", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, violations)
+}
+
+// getExperiment handles GET /experiments/{id}
+func (h *EventHandler) getExperiment(w http.ResponseWriter, r *http.Request) {
+	experiment, err := h.experiments.GetExperiment(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, experiment)
+}
+
+// writeJSON writes value as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"postgres_service/models"
+	"postgres_service/services"
+)
+
+// maxKeysSize bounds the body of a measurement key batch
+const maxKeysSize = 8 << 20
+
+// MeasurementKeyHandler exposes the measurement key service over HTTP
+type MeasurementKeyHandler struct {
+	keys *services.MeasurementKeyService
+}
+
+// NewMeasurementKeyHandler creates a new measurement key handler
+func NewMeasurementKeyHandler(keys *services.MeasurementKeyService) *MeasurementKeyHandler {
+	return &MeasurementKeyHandler{
+		keys: keys,
+	}
+}
+
+// Register adds the measurement key routes to mux
+func (h *MeasurementKeyHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /measurement-keys/lookup", h.lookup)
+	mux.HandleFunc("POST /measurement-keys", h.claim)
+}
+
+// lookup handles POST /measurement-keys/lookup and responds with the keys
+// that already exist
+func (h *MeasurementKeyHandler) lookup(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeKeys(w, r)
+	if !ok {
+		return
+	}
+
+	existing, err := h.keys.Existing(req.Keys)
+	if err != nil {
+		writeKeyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"existing": existing})
+}
+
+// claim handles POST /measurement-keys and responds with the keys that were
+// new, the caller owns those
+func (h *MeasurementKeyHandler) claim(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeKeys(w, r)
+	if !ok {
+		return
+	}
+
+	claimed, err := h.keys.Claim(req.Keys)
+	if err != nil {
+		writeKeyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"claimed": claimed, "created": len(claimed)})
+}
+
+func decodeKeys(w http.ResponseWriter, r *http.Request) (models.MeasurementKeysRequest, bool) {
+	var req models.MeasurementKeysRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxKeysSize)).Decode(&req); err != nil {
+		http.Error(w, "invalid measurement keys: "+err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+func writeKeyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrInvalidEvent) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Error handling measurement keys: %v", err)
+	http.Error(w, "failed to handle measurement keys", http.StatusInternalServerError)
+}
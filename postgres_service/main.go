@@ -2,9 +2,14 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"postgres_service/config"
+	"postgres_service/handlers"
 	"postgres_service/migrations"
+	"postgres_service/models"
+	"postgres_service/services"
 )
 
 func main() {
@@ -40,9 +45,17 @@ func main() {
 
 	log.Println("Database management service started. Migrations completed.")
 	log.Println("Database is ready for other services to connect.")
-	
-	// Keep the service running (for Docker health checks)
-	select {}
+
+	// Serve lifecycle events forwarded by the consumer
+	mux := http.NewServeMux()
+	handlers.NewEventHandler(services.NewExperimentService()).Register(mux)
+	handlers.NewMeasurementKeyHandler(services.NewMeasurementKeyService()).Register(mux)
+
+	addr := ":" + config.GetServerConfig().Port
+	log.Printf("Listening for events on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatal("HTTP server failed:", err)
+	}
 }
 
 func demonstrateCRUD() {
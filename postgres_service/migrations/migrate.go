@@ -3,6 +3,8 @@ package migrations
 import (
 	"fmt"
 	"log"
+	"strings"
+
 	"postgres_service/config"
 	"postgres_service/models"
 )
@@ -16,6 +18,13 @@ func RunMigrations() error {
 
 	log.Println("Running database migrations...")
 
+	// Unique indexes added to existing tables need their duplicates gone
+	for table, columns := range uniqueKeys {
+		if err := removeDuplicates(table, columns); err != nil {
+			return err
+		}
+	}
+
 	// Auto-migrate all models
 	allModels := models.GetAllModels()
 	for _, model := range allModels {
@@ -27,4 +36,36 @@ func RunMigrations() error {
 
 	log.Println("Database migrations completed successfully!")
 	return nil
-}
\ No newline at end of file
+}
+
+// uniqueKeys lists the columns of unique indexes on tables that may hold
+// rows from before the index existed
+var uniqueKeys = map[string][]string{
+	"experiment_events":     {"experiment_id", "type", "timestamp"},
+	"experiment_violations": {"experiment_id", "kind", "event", "measurement_id"},
+}
+
+// removeDuplicates deletes all but the first of the rows of table that
+// agree on columns. Columns the table does not have yet are ignored.
+func removeDuplicates(table string, columns []string) error {
+	db := config.GetDB()
+	if !db.Migrator().HasTable(table) {
+		return nil
+	}
+
+	var conditions []string
+	for _, column := range columns {
+		if db.Migrator().HasColumn(table, column) {
+			conditions = append(conditions, fmt.Sprintf("a.%[1]s IS NOT DISTINCT FROM b.%[1]s", column))
+		}
+	}
+	query := fmt.Sprintf("DELETE FROM %s a USING %s b WHERE a.id > b.id AND %s", table, table, strings.Join(conditions, " AND "))
+	result := db.Exec(query)
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove duplicates from %s: %w", table, result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Removed %d duplicate rows from %s", result.RowsAffected, table)
+	}
+	return nil
+}
@@ -71,6 +71,93 @@ type NotificationTemplate struct {
 	Variables string         `json:"variables" gorm:"type:jsonb"` // Template variables as JSON
 }
 
+// Experiment represents an experiment announced by the producer
+type Experiment struct {
+	ID                     string     `json:"id" gorm:"primaryKey"` // experiment UUID from the producer
+	CreatedAt              time.Time  `json:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at"`
+	Researcher             string     `json:"researcher" gorm:"not null"`
+	Topic                  string     `json:"topic"`                     // Kafka topic the configuration was consumed from
+	Sensors                string     `json:"sensors" gorm:"type:jsonb"` // Sensor IDs as JSON array
+	LowerThreshold         float64    `json:"lower_threshold"`
+	UpperThreshold         float64    `json:"upper_threshold"`
+	Status                 string     `json:"status" gorm:"default:'configured'"` // configured, stabilizing, running, terminated
+	StabilizationStartedAt *time.Time `json:"stabilization_started_at"`
+	StartedAt              *time.Time `json:"started_at"`
+	TerminatedAt           *time.Time `json:"terminated_at"`
+}
+
+// ExperimentEvent is the append-only log of lifecycle events per experiment.
+// A redelivered event is stored once; experiment_configured carries no
+// timestamp, so nulls do not make two of them distinct.
+type ExperimentEvent struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExperimentID string     `json:"experiment_id" gorm:"index;not null;uniqueIndex:idx_experiment_event,option:NULLS NOT DISTINCT"`
+	Type         string     `json:"type" gorm:"not null;uniqueIndex:idx_experiment_event"` // schema name of the event
+	Topic        string     `json:"topic"`                                                 // Kafka topic the event was consumed from
+	Timestamp    *time.Time `json:"timestamp" gorm:"uniqueIndex:idx_experiment_event"`     // event time reported by the producer
+	Payload      string     `json:"payload" gorm:"type:jsonb"`
+}
+
+// ExperimentViolation is an event the consumer found out of place in its
+// experiment's lifecycle. A violation reported again, e.g. after the
+// consumer restarted, is stored once.
+type ExperimentViolation struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExperimentID  string     `json:"experiment_id" gorm:"index;not null;uniqueIndex:idx_experiment_violation"`
+	Kind          string     `json:"kind" gorm:"not null;uniqueIndex:idx_experiment_violation"` // unknown_experiment, after_termination, duplicate, missing_phase, out_of_order, before_stabilization
+	Event         string     `json:"event" gorm:"not null;uniqueIndex:idx_experiment_violation"`
+	MeasurementID string     `json:"measurement_id,omitempty" gorm:"not null;default:'';uniqueIndex:idx_experiment_violation"` // measurement of a flagged reading
+	State         string     `json:"state"`                                                                                    // experiment state when the event arrived
+	Topic         string     `json:"topic"`                                                                                    // Kafka topic the event was consumed from
+	Detail        string     `json:"detail" gorm:"type:text"`
+	Timestamp     *time.Time `json:"timestamp"`
+}
+
+// MeasurementKey is the idempotency key of a reading the consumer already
+// forwarded to average_calc_service
+type MeasurementKey struct {
+	ExperimentID  string    `json:"experiment_id" gorm:"primaryKey"`
+	SensorID      string    `json:"sensor_id" gorm:"primaryKey"`
+	MeasurementID string    `json:"measurement_id" gorm:"primaryKey"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// MeasurementKeysRequest is a batch of measurement keys from the consumer
+type MeasurementKeysRequest struct {
+	Keys []MeasurementKey `json:"keys"`
+}
+
+// ViolationRequest is a lifecycle violation as reported by the consumer
+type ViolationRequest struct {
+	ExperimentID  string  `json:"experiment_id"`
+	Kind          string  `json:"kind"`
+	Event         string  `json:"event"`
+	MeasurementID string  `json:"measurement_id"`
+	State         string  `json:"state"`
+	Detail        string  `json:"detail"`
+	Timestamp     float64 `json:"timestamp"`
+}
+
+// ExperimentConfiguredRequest is the experiment_configured event as forwarded by the consumer
+type ExperimentConfiguredRequest struct {
+	Experiment       string   `json:"experiment"`
+	Researcher       string   `json:"researcher"`
+	Sensors          []string `json:"sensors"`
+	TemperatureRange struct {
+		UpperThreshold float64 `json:"upper_threshold"`
+		LowerThreshold float64 `json:"lower_threshold"`
+	} `json:"temperature_range"`
+}
+
+// PhaseEventRequest is any event that only carries an experiment and a timestamp
+type PhaseEventRequest struct {
+	Experiment string  `json:"experiment"`
+	Timestamp  float64 `json:"timestamp"`
+}
+
 // GetAllModels returns all models for migration
 func GetAllModels() []interface{} {
 	return []interface{}{
@@ -79,5 +166,9 @@ func GetAllModels() []interface{} {
 		&Tag{},
 		&Notification{},
 		&NotificationTemplate{},
+		&Experiment{},
+		&ExperimentEvent{},
+		&ExperimentViolation{},
+		&MeasurementKey{},
 	}
 }
\ No newline at end of file
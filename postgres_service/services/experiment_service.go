@@ -0,0 +1,201 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"postgres_service/config"
+	"postgres_service/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidEvent is returned for events that cannot be stored
+var ErrInvalidEvent = errors.New("invalid event")
+
+// Event types accepted from the consumer
+const (
+	ExperimentConfigured = "experiment_configured"
+	StabilizationStarted = "stabilization_started"
+	ExperimentStarted    = "experiment_started"
+	ExperimentTerminated = "experiment_terminated"
+)
+
+// ExperimentService persists experiment lifecycle events
+type ExperimentService struct {
+	db *gorm.DB
+}
+
+// NewExperimentService creates a new experiment service instance
+func NewExperimentService() *ExperimentService {
+	return &ExperimentService{
+		db: config.GetDB(),
+	}
+}
+
+// RecordEvent stores a lifecycle event consumed from topic and updates the
+// experiment it belongs to
+func (es *ExperimentService) RecordEvent(eventType, topic string, payload []byte) error {
+	switch eventType {
+	case ExperimentConfigured:
+		var req models.ExperimentConfiguredRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+		}
+		if req.Experiment == "" {
+			return fmt.Errorf("%w: missing experiment", ErrInvalidEvent)
+		}
+		return es.configure(req, topic, payload)
+	case StabilizationStarted, ExperimentStarted, ExperimentTerminated:
+		var req models.PhaseEventRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+		}
+		if req.Experiment == "" {
+			return fmt.Errorf("%w: missing experiment", ErrInvalidEvent)
+		}
+		return es.transition(eventType, topic, req, payload)
+	default:
+		return fmt.Errorf("%w: unsupported event type %s", ErrInvalidEvent, eventType)
+	}
+}
+
+// RecordViolation stores a lifecycle violation the consumer reported for an
+// event consumed from topic
+func (es *ExperimentService) RecordViolation(req models.ViolationRequest, topic string) (*models.ExperimentViolation, error) {
+	if req.ExperimentID == "" || req.Kind == "" || req.Event == "" {
+		return nil, fmt.Errorf("%w: experiment_id, kind and event are required", ErrInvalidEvent)
+	}
+
+	violation := models.ExperimentViolation{
+		ExperimentID:  req.ExperimentID,
+		Kind:          req.Kind,
+		Event:         req.Event,
+		MeasurementID: req.MeasurementID,
+		State:         req.State,
+		Topic:         topic,
+		Detail:        req.Detail,
+	}
+	if req.Timestamp > 0 {
+		at := unixToTime(req.Timestamp)
+		violation.Timestamp = &at
+	}
+
+	// A violation reported again is answered with the one stored first
+	result := es.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&violation)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to store violation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		stored := models.ExperimentViolation{}
+		if err := es.db.Where("experiment_id = ? AND kind = ? AND event = ? AND measurement_id = ?",
+			req.ExperimentID, req.Kind, req.Event, req.MeasurementID).First(&stored).Error; err != nil {
+			return nil, fmt.Errorf("failed to get stored violation: %w", err)
+		}
+		return &stored, nil
+	}
+	return &violation, nil
+}
+
+// GetViolations retrieves the violations of an experiment, oldest first
+func (es *ExperimentService) GetViolations(experimentID string) ([]models.ExperimentViolation, error) {
+	var violations []models.ExperimentViolation
+	if err := es.db.Where("experiment_id = ?", experimentID).Order("created_at").Find(&violations).Error; err != nil {
+		return nil, fmt.Errorf("failed to get violations: %w", err)
+	}
+	return violations, nil
+}
+
+// GetExperiment retrieves an experiment by its ID
+func (es *ExperimentService) GetExperiment(id string) (*models.Experiment, error) {
+	var experiment models.Experiment
+	if err := es.db.First(&experiment, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("experiment not found: %w", err)
+	}
+	return &experiment, nil
+}
+
+func (es *ExperimentService) configure(req models.ExperimentConfiguredRequest, topic string, payload []byte) error {
+	sensors, err := json.Marshal(req.Sensors)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sensors: %w", err)
+	}
+
+	experiment := models.Experiment{
+		ID:             req.Experiment,
+		Researcher:     req.Researcher,
+		Topic:          topic,
+		Sensors:        string(sensors),
+		LowerThreshold: req.TemperatureRange.LowerThreshold,
+		UpperThreshold: req.TemperatureRange.UpperThreshold,
+		Status:         "configured",
+	}
+
+	return es.db.Transaction(func(tx *gorm.DB) error {
+		// Redelivered configuration events overwrite the stored configuration
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"researcher", "topic", "sensors", "lower_threshold", "upper_threshold", "updated_at"}),
+		}).Create(&experiment).Error; err != nil {
+			return fmt.Errorf("failed to store experiment: %w", err)
+		}
+		_, err := es.appendEvent(tx, req.Experiment, ExperimentConfigured, topic, nil, payload)
+		return err
+	})
+}
+
+func (es *ExperimentService) transition(eventType, topic string, req models.PhaseEventRequest, payload []byte) error {
+	at := unixToTime(req.Timestamp)
+
+	var updates map[string]interface{}
+	switch eventType {
+	case StabilizationStarted:
+		updates = map[string]interface{}{"status": "stabilizing", "stabilization_started_at": at}
+	case ExperimentStarted:
+		updates = map[string]interface{}{"status": "running", "started_at": at}
+	case ExperimentTerminated:
+		updates = map[string]interface{}{"status": "terminated", "terminated_at": at}
+	}
+
+	return es.db.Transaction(func(tx *gorm.DB) error {
+		added, err := es.appendEvent(tx, req.Experiment, eventType, topic, &at, payload)
+		if err != nil || !added {
+			// A redelivered event must not move the experiment back to an
+			// earlier status
+			return err
+		}
+		// The experiment row may not exist yet if events arrive out of order,
+		// the event itself is always kept
+		if err := tx.Model(&models.Experiment{}).Where("id = ?", req.Experiment).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update experiment: %w", err)
+		}
+		return nil
+	})
+}
+
+// appendEvent adds an event to the experiment's log and reports whether it
+// was new, a redelivered event is already in the log
+func (es *ExperimentService) appendEvent(tx *gorm.DB, experimentID, eventType, topic string, at *time.Time, payload []byte) (bool, error) {
+	event := models.ExperimentEvent{
+		ExperimentID: experimentID,
+		Type:         eventType,
+		Topic:        topic,
+		Timestamp:    at,
+		Payload:      string(payload),
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&event)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to store event: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// unixToTime converts the producer's float seconds since epoch to a time
+func unixToTime(ts float64) time.Time {
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"postgres_service/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// statements opens a database that records the SQL of every insert instead
+// of running it
+func statements(t *testing.T) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sql []string
+	db.Callback().Create().After("gorm:create").Register("test:record", func(tx *gorm.DB) {
+		sql = append(sql, tx.Statement.SQL.String())
+	})
+	return db, &sql
+}
+
+func TestAppendEventIgnoresRedelivery(t *testing.T) {
+	db, sql := statements(t)
+	es := &ExperimentService{db: db}
+	at := time.Unix(1700000000, 0).UTC()
+
+	if _, err := es.appendEvent(db, "exp", ExperimentStarted, "group2", &at, []byte(`{}`)); err != nil {
+		t.Fatalf("appendEvent() = %v", err)
+	}
+	if len(*sql) != 1 || !strings.Contains((*sql)[0], "ON CONFLICT DO NOTHING") {
+		t.Errorf("inserted with %q, want conflicts ignored", *sql)
+	}
+}
+
+// TestRecordEventTwice needs a database, e.g.
+// POSTGRES_TEST_DSN="host=localhost user=postgres password=password dbname=test"
+func TestRecordEventTwice(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Experiment{}, &models.ExperimentEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	es := &ExperimentService{db: db}
+	id := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	configured := []byte(fmt.Sprintf(`{"experiment": %q, "researcher": "r@example.com", "sensors": ["a"]}`, id))
+	started := []byte(fmt.Sprintf(`{"experiment": %q, "timestamp": 1700000000.5}`, id))
+	terminated := []byte(fmt.Sprintf(`{"experiment": %q, "timestamp": 1700000010}`, id))
+
+	tests := []struct {
+		eventType string
+		payload   []byte
+	}{
+		{ExperimentConfigured, configured},
+		{ExperimentConfigured, configured},
+		{ExperimentStarted, started},
+		{ExperimentStarted, started},
+		{ExperimentTerminated, terminated},
+		// Redelivered after termination
+		{ExperimentStarted, started},
+	}
+	for _, tt := range tests {
+		if err := es.RecordEvent(tt.eventType, "group2", tt.payload); err != nil {
+			t.Fatalf("RecordEvent(%s) = %v", tt.eventType, err)
+		}
+	}
+
+	var count int64
+	if err := db.Model(&models.ExperimentEvent{}).Where("experiment_id = ?", id).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("stored %d events, want each of the 3 once", count)
+	}
+	experiment, err := es.GetExperiment(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if experiment.Status != "terminated" {
+		t.Errorf("status %q after a redelivered experiment_started, want terminated", experiment.Status)
+	}
+}
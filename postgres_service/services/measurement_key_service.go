@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"postgres_service/config"
+	"postgres_service/models"
+
+	"gorm.io/gorm"
+)
+
+// maxKeysPerRequest bounds a single lookup or claim batch
+const maxKeysPerRequest = 10000
+
+// MeasurementKeyService stores the idempotency keys of forwarded readings
+type MeasurementKeyService struct {
+	db *gorm.DB
+}
+
+// NewMeasurementKeyService creates a new measurement key service instance
+func NewMeasurementKeyService() *MeasurementKeyService {
+	return &MeasurementKeyService{
+		db: config.GetDB(),
+	}
+}
+
+// Existing returns the subset of keys that were already claimed
+func (ms *MeasurementKeyService) Existing(keys []models.MeasurementKey) ([]models.MeasurementKey, error) {
+	if err := validateKeys(keys); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return []models.MeasurementKey{}, nil
+	}
+
+	tuples := make([][]interface{}, len(keys))
+	for i, key := range keys {
+		tuples[i] = []interface{}{key.ExperimentID, key.SensorID, key.MeasurementID}
+	}
+
+	existing := []models.MeasurementKey{}
+	if err := ms.db.Where("(experiment_id, sensor_id, measurement_id) IN ?", tuples).Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up measurement keys: %w", err)
+	}
+	return existing, nil
+}
+
+// Claim stores keys and returns the ones that were new, keys that already
+// exist are left untouched. Concurrent claims of a key return it to one
+// caller only.
+func (ms *MeasurementKeyService) Claim(keys []models.MeasurementKey) ([]models.MeasurementKey, error) {
+	if err := validateKeys(keys); err != nil {
+		return nil, err
+	}
+	claimed := []models.MeasurementKey{}
+	if len(keys) == 0 {
+		return claimed, nil
+	}
+
+	now := time.Now()
+	rows := make([]string, len(keys))
+	args := make([]interface{}, 0, 4*len(keys))
+	for i, key := range keys {
+		rows[i] = "(?, ?, ?, ?)"
+		args = append(args, key.ExperimentID, key.SensorID, key.MeasurementID, now)
+	}
+	query := "INSERT INTO measurement_keys (experiment_id, sensor_id, measurement_id, created_at) VALUES " +
+		strings.Join(rows, ", ") + " ON CONFLICT DO NOTHING RETURNING experiment_id, sensor_id, measurement_id, created_at"
+	err := ms.db.Raw(query, args...).Scan(&claimed).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim measurement keys: %w", err)
+	}
+	return claimed, nil
+}
+
+func validateKeys(keys []models.MeasurementKey) error {
+	if len(keys) > maxKeysPerRequest {
+		return fmt.Errorf("%w: at most %d keys per request", ErrInvalidEvent, maxKeysPerRequest)
+	}
+	for _, key := range keys {
+		if key.ExperimentID == "" || key.SensorID == "" || key.MeasurementID == "" {
+			return fmt.Errorf("%w: experiment_id, sensor_id and measurement_id are required", ErrInvalidEvent)
+		}
+	}
+	return nil
+}